@@ -0,0 +1,135 @@
+// Copyright 2022 c-fraser
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	extend "github.com/c-fraser/extendz/pkg/client"
+	"github.com/c-fraser/extendz/pkg/config"
+	"github.com/c-fraser/extendz/pkg/credential"
+	"github.com/urfave/cli/v2"
+)
+
+// keyringService is the service name of the passwords in the OS keyring.
+const keyringService = "extendz"
+
+// profilePassword returns the password of the profile, the EXTEND_PASSWORD environment variable if set,
+// otherwise the password from the credential source of the profile.
+func profilePassword(c *cli.Context, profile config.Profile) (string, error) {
+	if password := os.Getenv(config.EnvPassword); password != "" {
+		return password, nil
+	}
+	source, err := credentialSource(c, profile)
+	if err != nil {
+		return "", err
+	}
+	password, err := source.Get(credential.Account(profile.Server, profile.Email))
+	if errors.Is(err, credential.ErrNotFound) {
+		return "", fmt.Errorf(
+			"no password for %s, run 'extendz login' or set the '%s' environment variable",
+			profile.Email,
+			config.EnvPassword)
+	}
+	return password, err
+}
+
+// credentialSource returns the credential.Source of the profile.
+func credentialSource(c *cli.Context, profile config.Profile) (credential.Source, error) {
+	switch profile.Auth {
+	case config.AuthKeyring:
+		return credential.Keyring(keyringService), nil
+	case config.AuthFile:
+		path, _, err := loadConfig(c)
+		if err != nil {
+			return nil, err
+		}
+		path = filepath.Join(filepath.Dir(path), "credentials")
+		return credential.File(path, passphrase(path)), nil
+	case config.AuthCommand:
+		return credential.Command(profile.PasswordCommand), nil
+	case config.AuthPrompt:
+		return credential.Prompt(os.Stdin, os.Stderr), nil
+	case config.AuthEnv:
+		return nil, fmt.Errorf("the '%s' environment variable must be set", config.EnvPassword)
+	default:
+		return nil, fmt.Errorf("unknown auth %q", profile.Auth)
+	}
+}
+
+// credentialStore returns the credential.Store of the profile, an error if the auth of the profile
+// doesn't store passwords.
+func credentialStore(c *cli.Context, profile config.Profile) (credential.Store, error) {
+	if !profile.Auth.Stores() {
+		return nil, fmt.Errorf(
+			"the %s auth doesn't store passwords, use the %s or %s auth",
+			profile.Auth,
+			config.AuthKeyring,
+			config.AuthFile)
+	}
+	source, err := credentialSource(c, profile)
+	if err != nil {
+		return nil, err
+	}
+	return source.(credential.Store), nil
+}
+
+// passphrase returns the passphrase of the credentials file at the path, the EXTENDZ_PASSPHRASE
+// environment variable if set, otherwise read from the terminal.
+func passphrase(path string) func() ([]byte, error) {
+	return func() ([]byte, error) {
+		if passphrase := os.Getenv(config.EnvPassphrase); passphrase != "" {
+			return []byte(passphrase), nil
+		}
+		_, _ = fmt.Fprintf(os.Stderr, "Passphrase for %s: ", path)
+		passphrase, err := credential.ReadSecret(os.Stdin, os.Stderr)
+		return []byte(passphrase), err
+	}
+}
+
+// verifyPassword returns an error unless the email and password sign in to the Extend API at the
+// server. The Client doesn't fail to sign in given an error response, so the status, and token, of
+// the sign in response are checked.
+func verifyPassword(server, email, password string, logger *slog.Logger) error {
+	var status int
+	var token string
+	observe := extend.Observe(func(call *extend.Call, result *extend.Result, _ error, _ time.Duration) {
+		if call.Operation != "SignIn" || result == nil {
+			return
+		}
+		status = result.StatusCode
+		if response, ok := result.Response.(*extend.LoginSignUpResponse); ok {
+			token = response.Token
+		}
+	})
+	c, err := extend.NewClient(server, email, password, extend.WithLogger(logger), extend.WithMiddleware(observe))
+	if err != nil {
+		return fmt.Errorf("failed to sign in as %s: %w", email, err)
+	}
+	defer c.Close()
+	if status < 200 || status >= 300 {
+		return fmt.Errorf("failed to sign in as %s: %d %s", email, status, http.StatusText(status))
+	}
+	if token == "" {
+		return fmt.Errorf("failed to sign in as %s: no token was returned", email)
+	}
+	return nil
+}
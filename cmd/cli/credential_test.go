@@ -0,0 +1,51 @@
+// Copyright 2022 c-fraser
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestVerifyPassword(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var login struct {
+			Password string `json:"testPassword"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&login)
+		switch login.Password {
+		case "correct":
+			_, _ = w.Write([]byte(`{"token": "token", "refreshToken": "refresh"}`))
+		case "tokenless":
+			_, _ = w.Write([]byte(`{}`))
+		default:
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = w.Write([]byte(`{"error": "Unauthorized", "message": "Invalid credentials"}`))
+		}
+	}))
+	defer server.Close()
+
+	logger := newLogger(false)
+	if err := verifyPassword(server.URL, "jane@example.com", "correct", logger); err != nil {
+		t.Errorf("Failed to verify password: %v", err)
+	}
+	for _, password := range []string{"wrong", "tokenless"} {
+		if err := verifyPassword(server.URL, "jane@example.com", password, logger); err == nil {
+			t.Errorf("Unexpected verification of password %q", password)
+		}
+	}
+}
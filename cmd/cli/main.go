@@ -15,43 +15,252 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"io"
+	"log/slog"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+	_ "time/tzdata"
 
 	"github.com/c-fraser/extendz"
+	"github.com/c-fraser/extendz/pkg/anomaly"
+	"github.com/c-fraser/extendz/pkg/batch"
 	extend "github.com/c-fraser/extendz/pkg/client"
-	"github.com/hokaccha/go-prettyjson"
+	"github.com/c-fraser/extendz/pkg/config"
+	"github.com/c-fraser/extendz/pkg/credential"
+	"github.com/c-fraser/extendz/pkg/declines"
+	"github.com/c-fraser/extendz/pkg/export"
+	"github.com/c-fraser/extendz/pkg/mirror"
+	"github.com/c-fraser/extendz/pkg/plan"
+	"github.com/c-fraser/extendz/pkg/policy"
+	"github.com/c-fraser/extendz/pkg/reconcile"
+	"github.com/c-fraser/extendz/pkg/recurrence"
+	"github.com/c-fraser/extendz/pkg/watch"
 	"github.com/urfave/cli/v2"
 )
 
-const (
-	extendApiBaseUrl = "https://api.paywithextend.com/"
-	emailEnv         = "EXTEND_EMAIL"
-	passwordEnv      = "EXTEND_PASSWORD"
-)
-
 // main is the entry point into the extendz CLI application.
 func main() {
-	email := os.Getenv(emailEnv)
-	password := os.Getenv(passwordEnv)
-	if email == "" || password == "" {
-		log.Fatalf("The '%s' and '%s' environment variables must be set", emailEnv, passwordEnv)
-	}
-	client, err := extend.NewClient(extendApiBaseUrl, email, password)
-	if err != nil {
-		log.Fatalf("Failed to initialize Extend API client: %v", err)
-	}
+	logger := newLogger(false)
+	var client *extend.Client
 
 	app := cli.NewApp()
 	app.Name = "extendz"
 	app.Usage = "A tool for interacting with the Extend API"
 	app.Version = extendz.VERSION
+	app.EnableBashCompletion = true
+	app.Flags = []cli.Flag{
+		&cli.BoolFlag{
+			Name:  "debug",
+			Usage: "log the (redacted) Extend API requests and responses",
+		},
+		&cli.StringFlag{
+			Name:    "output",
+			Aliases: []string{"o"},
+			Usage:   "the output format (json, yaml, table, csv, template=<go template>, jsonpath=<expression>), otherwise the output of the profile",
+		},
+		&cli.StringFlag{
+			Name:    "profile",
+			Aliases: []string{"p"},
+			Usage:   "the name of the configuration profile to use, otherwise the current profile",
+			EnvVars: []string{config.EnvProfile},
+		},
+		&cli.StringFlag{
+			Name:    "config",
+			Usage:   "the path of the configuration file",
+			EnvVars: []string{config.EnvConfig},
+		},
+	}
+	var profile config.Profile
+	// authenticate signs in to the Extend API as the profile, it's the Before of the commands which
+	// use the client, so the other (offline) commands never authenticate.
+	authenticate := func(c *cli.Context) error {
+		if client != nil || completing() {
+			return nil
+		}
+		if profile.Email == "" {
+			return fmt.Errorf("the email of the profile (or '%s') must be set", config.EnvEmail)
+		}
+		password, err := profilePassword(c, profile)
+		if err != nil {
+			return err
+		}
+		client, err = extend.NewClient(
+			profile.Server,
+			profile.Email,
+			password,
+			extend.WithLogger(logger),
+			extend.WithMiddleware(extend.Logging(logger)))
+		if err != nil {
+			return fmt.Errorf("failed to initialize Extend API client: %w", err)
+		}
+		return nil
+	}
+	app.Before = func(c *cli.Context) error {
+		logger = newLogger(c.Bool("debug"))
+		if completing() {
+			return nil
+		}
+		var err error
+		profile, err = loadProfile(c)
+		if err != nil {
+			return err
+		}
+		if !c.IsSet("output") {
+			return c.Set("output", profile.Output)
+		}
+		return nil
+	}
+	// batchCommand returns the command which runs the batch operation.
+	batchCommand := func(operation batch.Operation, usage string) *cli.Command {
+		return &cli.Command{
+			Name:  string(operation),
+			Usage: usage,
+			Before: func(c *cli.Context) error {
+				if c.Bool("dry-run") {
+					return nil
+				}
+				return authenticate(c)
+			},
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Name:     "input",
+					Aliases:  []string{"i"},
+					Usage:    "the path of the CSV or JSON Lines file of the rows",
+					Required: true,
+				},
+				&cli.StringFlag{
+					Name:  "results",
+					Usage: "the path of the results file, otherwise <input>.results.<csv|jsonl>",
+				},
+				&cli.IntFlag{
+					Name:  "concurrency",
+					Usage: "the maximum number of requests in flight",
+					Value: 4,
+				},
+				&cli.BoolFlag{
+					Name:  "dry-run",
+					Usage: "validate the rows without sending the requests",
+				},
+			},
+			Action: func(c *cli.Context) error {
+				input := c.String("input")
+				format, err := batch.FormatOf(input)
+				if err != nil {
+					return err
+				}
+				f, err := os.Open(input)
+				if err != nil {
+					return err
+				}
+				rows, err := batch.Read(f, format)
+				_ = f.Close()
+				if err != nil {
+					return err
+				}
+				var api batch.API
+				if client != nil {
+					api = client
+				}
+				results, err := batch.Run(
+					c.Context,
+					api,
+					operation,
+					rows,
+					batch.WithConcurrency(c.Int("concurrency")),
+					batch.WithDryRun(c.Bool("dry-run")))
+				if err != nil {
+					return err
+				}
+				path := c.String("results")
+				if path == "" {
+					path = strings.TrimSuffix(input, filepath.Ext(input)) + ".results" + filepath.Ext(input)
+				}
+				out, err := os.Create(path)
+				if err != nil {
+					return err
+				}
+				if err := batch.Write(out, format, results); err != nil {
+					_ = out.Close()
+					return err
+				}
+				if err := out.Close(); err != nil {
+					return err
+				}
+				summary := batch.Summary(results)
+				if err := printResponse(c, map[string]any{
+					"results":   path,
+					"succeeded": summary[batch.Succeeded],
+					"failed":    summary[batch.Failed],
+					"skipped":   summary[batch.Skipped],
+					"valid":     summary[batch.Valid],
+				}); err != nil {
+					return err
+				}
+				if n := summary[batch.Failed]; n > 0 {
+					return fmt.Errorf("%d of %d rows failed, re-run the failed rows with --input %s", n, len(rows), path)
+				}
+				return nil
+			},
+		}
+	}
+	// newPlan returns the plan of the manifest, the state, and the path of the state.
+	newPlan := func(c *cli.Context) (*plan.Plan, *plan.State, string, error) {
+		f, err := os.Open(c.String("manifest"))
+		if err != nil {
+			return nil, nil, "", err
+		}
+		manifest, err := plan.ReadManifest(f)
+		_ = f.Close()
+		if err != nil {
+			return nil, nil, "", err
+		}
+		path := c.String("state")
+		state, err := plan.LoadState(path)
+		if err != nil {
+			return nil, nil, "", err
+		}
+		if err := state.Resolve(client); err != nil {
+			return nil, nil, "", err
+		}
+		live, err := extend.AllVirtualCards(client, extend.VirtualCardPageableRequest{})
+		if err != nil {
+			return nil, nil, "", err
+		}
+		p, err := plan.New(manifest, state, live)
+		return p, state, path, err
+	}
+	planFlags := []cli.Flag{
+		&cli.StringFlag{
+			Name:     "manifest",
+			Aliases:  []string{"f"},
+			Usage:    "the path of the YAML manifest of the virtual cards",
+			Required: true,
+		},
+		&cli.StringFlag{
+			Name:  "state",
+			Usage: "the path of the state file, which records the virtual cards owned by the manifest",
+			Value: "extendz.state.json",
+		},
+	}
+	app.After = func(c *cli.Context) error {
+		if client != nil {
+			client.Close()
+		}
+		return nil
+	}
 	app.Commands = cli.Commands{
 		&cli.Command{
-			Name:  "get-user-virtual-cards",
-			Usage: "Get the virtual cards for a user",
+			Name:   "get-user-virtual-cards",
+			Usage:  "Get the virtual cards for a user",
+			Before: authenticate,
 			Flags: []cli.Flag{
 				&cli.StringFlag{
 					Name:     "request",
@@ -73,12 +282,13 @@ func main() {
 				if err != nil {
 					return err
 				}
-				return printResponse(response)
+				return printResponse(c, response)
 			},
 		},
 		&cli.Command{
-			Name:  "get-virtual-card",
-			Usage: "Get a virtual card",
+			Name:   "get-virtual-card",
+			Usage:  "Get a virtual card",
+			Before: authenticate,
 			Flags: []cli.Flag{
 				&cli.StringFlag{
 					Name:     "id",
@@ -93,12 +303,13 @@ func main() {
 				if err != nil {
 					return err
 				}
-				return printResponse(response)
+				return printResponse(c, response)
 			},
 		},
 		&cli.Command{
-			Name:  "get-virtual-card-transactions",
-			Usage: "Get the transactions for a virtual card",
+			Name:   "get-virtual-card-transactions",
+			Usage:  "Get the transactions for a virtual card",
+			Before: authenticate,
 			Flags: []cli.Flag{
 				&cli.StringFlag{
 					Name:     "id",
@@ -106,7 +317,7 @@ func main() {
 					Usage:    "the virtual card ID",
 					Required: true,
 				},
-				&cli.StringFlag{
+				&cli.IntFlag{
 					Name:     "count",
 					Aliases:  []string{"c"},
 					Usage:    "the number of transactions to get",
@@ -115,38 +326,61 @@ func main() {
 				&cli.StringFlag{
 					Name:     "before",
 					Aliases:  []string{"b"},
-					Usage:    "get transactions before timestamp",
+					Usage:    "get transactions before timestamp (e.g. 2020-01-01T01:01:12.123+0000)",
 					Required: false,
 				},
 				&cli.StringFlag{
 					Name:     "after",
 					Aliases:  []string{"a"},
-					Usage:    "get transactions after timestamp",
+					Usage:    "get transactions after timestamp (e.g. 2020-01-01T01:01:12.123+0000)",
 					Required: false,
 				},
 				&cli.StringFlag{
 					Name:     "status",
 					Aliases:  []string{"s"},
-					Usage:    "the comma-delimited list of transaction statuses to get",
+					Usage:    "the comma-delimited list of transaction statuses to get (" + strings.Join(extend.Names(extend.TransactionStatuses()), ", ") + ")",
 					Required: false,
 				},
 			},
+			BashComplete: completeFlagValues(map[string][]string{
+				"status": extend.Names(extend.TransactionStatuses()),
+			}),
 			Action: func(c *cli.Context) error {
 				id := c.String("id")
-				count := c.Int("count")
-				before := c.String("before")
-				after := c.String("after")
-				status := c.String("status")
-				response, err := client.GetVirtualCardTransactions(id, count, before, after, status)
+				before, err := extend.ParseTimestamp(c.String("before"))
 				if err != nil {
 					return err
 				}
-				return printResponse(response)
+				after, err := extend.ParseTimestamp(c.String("after"))
+				if err != nil {
+					return err
+				}
+				statuses, err := parseList(c.String("status"), extend.ParseTransactionStatus)
+				if err != nil {
+					return err
+				}
+				request := extend.VirtualCardTransactionsRequest{
+					Count:    c.Int("count"),
+					Before:   before.Time,
+					After:    after.Time,
+					Statuses: statuses,
+				}
+				response, err := client.GetVirtualCardTransactions(id, &request)
+				if err != nil {
+					return err
+				}
+				return printResponse(c, response)
 			},
 		},
 		&cli.Command{
 			Name:  "create-virtual-card",
 			Usage: "Create a virtual card",
+			Before: func(c *cli.Context) error {
+				if c.Bool("validate-only") {
+					return nil
+				}
+				return authenticate(c)
+			},
 			Flags: []cli.Flag{
 				&cli.StringFlag{
 					Name:     "request",
@@ -154,6 +388,14 @@ func main() {
 					Usage:    "the https://developer.paywithextend.com/#tocS_CreateVirtualCardRequest JSON",
 					Required: true,
 				},
+				&cli.BoolFlag{
+					Name:  "validate-only",
+					Usage: "only validate the request, without sending it",
+				},
+				&cli.StringFlag{
+					Name:  "idempotency-key",
+					Usage: "the key which makes retrying the creation (with the same key) not create a duplicate card",
+				},
 			},
 			Action: func(c *cli.Context) error {
 				s := c.String("request")
@@ -162,16 +404,31 @@ func main() {
 				if err != nil {
 					return err
 				}
+				if c.IsSet("idempotency-key") {
+					request.IdempotencyKey = c.String("idempotency-key")
+					if err := extend.ValidateIdempotencyKey(request.IdempotencyKey); err != nil {
+						return err
+					}
+				}
+				if c.Bool("validate-only") {
+					return printValidation(c, request.Validate())
+				}
 				response, err := client.CreateVirtualCard(&request)
 				if err != nil {
 					return err
 				}
-				return printResponse(response)
+				return printResponse(c, response)
 			},
 		},
 		&cli.Command{
 			Name:  "update-virtual-card",
 			Usage: "Update a virtual card",
+			Before: func(c *cli.Context) error {
+				if c.Bool("validate-only") {
+					return nil
+				}
+				return authenticate(c)
+			},
 			Flags: []cli.Flag{
 				&cli.StringFlag{
 					Name:     "id",
@@ -185,6 +442,10 @@ func main() {
 					Usage:    "the https://developer.paywithextend.com/#tocS_UpdateVirtualCardRequest JSON",
 					Required: true,
 				},
+				&cli.BoolFlag{
+					Name:  "validate-only",
+					Usage: "only validate the request, without sending it",
+				},
 			},
 			Action: func(c *cli.Context) error {
 				id := c.String("id")
@@ -194,16 +455,20 @@ func main() {
 				if err != nil {
 					return err
 				}
+				if c.Bool("validate-only") {
+					return printValidation(c, request.Validate())
+				}
 				response, err := client.UpdateVirtualCard(id, &request)
 				if err != nil {
 					return err
 				}
-				return printResponse(response)
+				return printResponse(c, response)
 			},
 		},
 		&cli.Command{
-			Name:  "cancel-virtual-card",
-			Usage: "Cancel a virtual card",
+			Name:   "cancel-virtual-card",
+			Usage:  "Cancel a virtual card",
+			Before: authenticate,
 			Flags: []cli.Flag{
 				&cli.StringFlag{
 					Name:     "id",
@@ -218,12 +483,13 @@ func main() {
 				if err != nil {
 					return err
 				}
-				return printResponse(response)
+				return printResponse(c, response)
 			},
 		},
 		&cli.Command{
-			Name:  "reject-virtual-card",
-			Usage: "Reject a virtual card",
+			Name:   "reject-virtual-card",
+			Usage:  "Reject a virtual card",
+			Before: authenticate,
 			Flags: []cli.Flag{
 				&cli.StringFlag{
 					Name:     "id",
@@ -238,23 +504,1035 @@ func main() {
 				if err != nil {
 					return err
 				}
-				return printResponse(response)
+				return printResponse(c, response)
+			},
+		},
+		&cli.Command{
+			Name:  "recurrence",
+			Usage: "Inspect the recurrence of a virtual card",
+			Subcommands: cli.Commands{
+				&cli.Command{
+					Name:  "preview",
+					Usage: "Preview the upcoming resets, and future budget, of a recurring virtual card",
+					Before: func(c *cli.Context) error {
+						if c.String("id") == "" {
+							return nil
+						}
+						return authenticate(c)
+					},
+					Flags: []cli.Flag{
+						&cli.StringFlag{
+							Name:    "id",
+							Aliases: []string{"i"},
+							Usage:   "the ID of the recurring virtual card",
+						},
+						&cli.StringFlag{
+							Name:    "recurrence",
+							Aliases: []string{"r"},
+							Usage:   "the https://developer.paywithextend.com/#tocS_Recurrence JSON, instead of a virtual card",
+						},
+						&cli.StringFlag{
+							Name:  "currency",
+							Usage: "the currency of the recurrence balance",
+							Value: "USD",
+						},
+						&cli.StringFlag{
+							Name:  "timezone",
+							Usage: "the IANA time zone of the recurrence (e.g. America/New_York)",
+							Value: "UTC",
+						},
+						&cli.StringFlag{
+							Name:  "from",
+							Usage: "preview the resets from timestamp (e.g. 2020-01-01T01:01:12.123+0000), instead of now",
+						},
+						&cli.IntFlag{
+							Name:    "limit",
+							Aliases: []string{"l"},
+							Usage:   "the maximum number of resets to preview",
+							Value:   12,
+						},
+					},
+					Action: func(c *cli.Context) error {
+						var schedule recurrence.Schedule
+						switch {
+						case c.String("id") != "":
+							response, err := client.GetVirtualCard(c.String("id"))
+							if err != nil {
+								return err
+							}
+							schedule, err = recurrence.ForVirtualCard(response.VirtualCard)
+							if err != nil {
+								return err
+							}
+						case c.String("recurrence") != "":
+							err := json.Unmarshal([]byte(c.String("recurrence")), &schedule.Recurrence)
+							if err != nil {
+								return err
+							}
+							schedule.Currency = c.String("currency")
+							schedule.Location, err = time.LoadLocation(c.String("timezone"))
+							if err != nil {
+								return err
+							}
+						default:
+							return errors.New("either the 'id' or 'recurrence' flag must be set")
+						}
+						from := time.Now()
+						if s := c.String("from"); s != "" {
+							t, err := extend.ParseTimestamp(s)
+							if err != nil {
+								return err
+							}
+							from = t.In(schedule.Location)
+						}
+						preview, err := schedule.Preview(from, c.Int("limit"))
+						if err != nil {
+							return err
+						}
+						return printResponse(c, preview)
+					},
+				},
+			},
+		},
+		&cli.Command{
+			Name:  "batch",
+			Usage: "Create, update or cancel virtual cards in bulk, from a CSV or JSON Lines file",
+			Subcommands: cli.Commands{
+				batchCommand(batch.Create, "Create a virtual card per row"),
+				batchCommand(batch.Update, "Update the virtual card of each row (by id)"),
+				batchCommand(batch.Cancel, "Cancel the virtual card of each row (by id)"),
+			},
+		},
+		&cli.Command{
+			Name:   "plan",
+			Usage:  "Show the changes which reconcile the virtual cards with a manifest",
+			Before: authenticate,
+			Flags:  planFlags,
+			Action: func(c *cli.Context) error {
+				p, _, _, err := newPlan(c)
+				if err != nil {
+					return err
+				}
+				return printResponse(c, p)
+			},
+		},
+		&cli.Command{
+			Name:   "apply",
+			Usage:  "Apply the changes which reconcile the virtual cards with a manifest",
+			Before: authenticate,
+			Flags: append(planFlags, &cli.BoolFlag{
+				Name:  "auto-approve",
+				Usage: "apply the changes without confirming them",
+			}),
+			Action: func(c *cli.Context) error {
+				p, state, path, err := newPlan(c)
+				if err != nil {
+					return err
+				}
+				if p.IsEmpty() {
+					_, _ = fmt.Fprintln(os.Stderr, "No changes")
+					return nil
+				}
+				if !c.Bool("auto-approve") {
+					if err := writeResponse(os.Stderr, "table", false, p); err != nil {
+						return err
+					}
+					_, _ = fmt.Fprintf(os.Stderr, "Apply the %d changes? [y/N]: ", len(p.Changes))
+					answer, err := credential.ReadLine(os.Stdin)
+					if err != nil {
+						return err
+					}
+					if !strings.EqualFold(answer, "y") && !strings.EqualFold(answer, "yes") {
+						return errors.New("apply cancelled")
+					}
+				}
+				err = plan.Apply(client, p, state, func(state *plan.State) error { return state.Save(path) })
+				if err != nil {
+					return err
+				}
+				return printResponse(c, p)
+			},
+		},
+		&cli.Command{
+			Name:   "sync",
+			Usage:  "Mirror the virtual cards, and their transactions, into a SQLite database",
+			Before: authenticate,
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Name:  "db",
+					Usage: "the path of the SQLite database",
+					Value: "extend.sqlite",
+				},
+				&cli.DurationFlag{
+					Name:  "lookback",
+					Usage: "how long before the last synced transaction to sync the (changed) transactions again",
+					Value: 7 * 24 * time.Hour,
+				},
+			},
+			Action: func(c *cli.Context) error {
+				m, err := mirror.Open(c.String("db"), mirror.WithLookback(c.Duration("lookback")))
+				if err != nil {
+					return err
+				}
+				defer m.Close()
+				stats, err := m.Sync(c.Context, client)
+				if err != nil {
+					return err
+				}
+				return printResponse(c, stats)
+			},
+		},
+		&cli.Command{
+			Name:   "watch",
+			Usage:  "Watch the virtual cards, and notify of expiring, low balance, missed recurrence and declines",
+			Before: authenticate,
+			Flags: []cli.Flag{
+				&cli.DurationFlag{
+					Name:  "interval",
+					Usage: "the time between the scans of the virtual cards",
+					Value: 5 * time.Minute,
+				},
+				&cli.BoolFlag{
+					Name:  "once",
+					Usage: "scan the virtual cards once, then exit",
+				},
+				&cli.StringSliceFlag{
+					Name:  "kind",
+					Usage: "a kind of alert (" + strings.Join(extend.Names(watch.Kinds()), ", ") + "), otherwise every kind",
+				},
+				&cli.DurationFlag{
+					Name:  "expiry-window",
+					Usage: "how long before the validTo, or activeUntil, of a virtual card it's expiring",
+					Value: 7 * 24 * time.Hour,
+				},
+				&cli.Float64Flag{
+					Name:  "low-balance",
+					Usage: "the fraction of the limit of a virtual card below which its balance is low",
+					Value: 0.1,
+				},
+				&cli.DurationFlag{
+					Name:  "recurrence-grace",
+					Usage: "how long after the next recurrence of a virtual card the recurrence is missed",
+					Value: time.Hour,
+				},
+				&cli.DurationFlag{
+					Name:  "lookback",
+					Usage: "how long before the first scan declined transactions are alerted",
+					Value: 24 * time.Hour,
+				},
+				&cli.StringSliceFlag{
+					Name:  "webhook",
+					Usage: "a URL to POST each alert to, as JSON",
+				},
+				&cli.StringSliceFlag{
+					Name:  "exec",
+					Usage: "a shell command to run for each alert, with the alert as JSON on stdin",
+				},
+				&cli.StringFlag{
+					Name:  "smtp-addr",
+					Usage: "the host:port of the SMTP relay to email each alert via",
+				},
+				&cli.StringFlag{
+					Name:  "smtp-from",
+					Usage: "the address to email the alerts from",
+					Value: "extendz@localhost",
+				},
+				&cli.StringSliceFlag{
+					Name:  "smtp-to",
+					Usage: "an address to email the alerts to",
+				},
+				&cli.BoolFlag{
+					Name:  "quiet",
+					Usage: "don't write the alerts to stdout",
+				},
+			},
+			BashComplete: completeFlagValues(map[string][]string{
+				"kind": extend.Names(watch.Kinds()),
+			}),
+			Action: func(c *cli.Context) error {
+				var notifiers []watch.Notifier
+				if !c.Bool("quiet") {
+					notifiers = append(notifiers, watch.Writer(os.Stdout))
+				}
+				for _, url := range c.StringSlice("webhook") {
+					notifiers = append(notifiers, watch.Webhook(url))
+				}
+				for _, command := range c.StringSlice("exec") {
+					notifiers = append(notifiers, watch.Command(command))
+				}
+				if addr := c.String("smtp-addr"); addr != "" {
+					to := c.StringSlice("smtp-to")
+					if len(to) == 0 {
+						return errors.New("--smtp-to is required with --smtp-addr")
+					}
+					notifiers = append(notifiers, watch.SMTP(addr, c.String("smtp-from"), to...))
+				}
+				options := []watch.Option{
+					watch.WithInterval(c.Duration("interval")),
+					watch.WithExpiryWindow(c.Duration("expiry-window")),
+					watch.WithLowBalance(c.Float64("low-balance")),
+					watch.WithRecurrenceGrace(c.Duration("recurrence-grace")),
+					watch.WithLookback(c.Duration("lookback")),
+					watch.WithLogger(logger),
+				}
+				if values := c.StringSlice("kind"); len(values) > 0 {
+					kinds := make([]watch.Kind, len(values))
+					for i, v := range values {
+						kinds[i] = watch.Kind(v)
+						if !contains(extend.Names(watch.Kinds()), v) {
+							return fmt.Errorf("unknown alert kind %q, expected one of %s", v, strings.Join(extend.Names(watch.Kinds()), ", "))
+						}
+					}
+					options = append(options, watch.WithKinds(kinds...))
+				}
+				w := watch.New(client, watch.Notifiers(notifiers...), options...)
+				if c.Bool("once") {
+					_, err := w.Scan(c.Context)
+					return err
+				}
+				ctx, stop := signal.NotifyContext(c.Context, os.Interrupt, syscall.SIGTERM)
+				defer stop()
+				if err := w.Run(ctx); !errors.Is(err, context.Canceled) {
+					return err
+				}
+				return nil
+			},
+		},
+		&cli.Command{
+			Name:   "declines",
+			Usage:  "Report the declined transactions, by cause, reason, merchant and MCC, and the fixes of the virtual cards",
+			Before: authenticate,
+			Flags: []cli.Flag{
+				&cli.StringSliceFlag{
+					Name:    "card",
+					Aliases: []string{"c"},
+					Usage:   "the ID of a virtual card to analyze the declines of, instead of every virtual card",
+				},
+				&cli.StringFlag{
+					Name:  "since",
+					Usage: "analyze declines after timestamp (e.g. 2020-01-01T01:01:12.123+0000)",
+				},
+				&cli.StringFlag{
+					Name:  "until",
+					Usage: "analyze declines before timestamp (e.g. 2020-01-01T01:01:12.123+0000)",
+				},
+			},
+			Action: func(c *cli.Context) error {
+				since, err := extend.ParseTimestamp(c.String("since"))
+				if err != nil {
+					return err
+				}
+				until, err := extend.ParseTimestamp(c.String("until"))
+				if err != nil {
+					return err
+				}
+				request := extend.VirtualCardTransactionsRequest{
+					After:    since.Time,
+					Before:   until.Time,
+					Statuses: []extend.TransactionStatus{extend.TransactionStatusDeclined, extend.TransactionStatusAvsFail},
+				}
+				cards, transactions, err := cardTransactions(client, c.StringSlice("card"), false, request)
+				if err != nil {
+					return err
+				}
+				return printResponse(c, declines.Analyze(cards, transactions))
+			},
+		},
+		&cli.Command{
+			Name:   "anomalies",
+			Usage:  "Score the unusual transactions, for fraud review",
+			Before: authenticate,
+			Flags: []cli.Flag{
+				&cli.StringSliceFlag{
+					Name:    "card",
+					Aliases: []string{"c"},
+					Usage:   "the ID of a virtual card to detect the anomalies of, instead of every virtual card",
+				},
+				&cli.StringFlag{
+					Name:  "since",
+					Usage: "detect anomalies after timestamp (e.g. 2020-01-01T01:01:12.123+0000)",
+				},
+				&cli.StringFlag{
+					Name:  "scope",
+					Usage: "the history to compare each transaction with (" + strings.Join(extend.Names(anomaly.Scopes()), ", ") + ")",
+					Value: string(anomaly.Card),
+				},
+				&cli.Float64Flag{
+					Name:  "min-score",
+					Usage: "the score, between 0 and 1, below which anomalies are ignored",
+				},
+				&cli.Float64Flag{
+					Name:  "outlier-threshold",
+					Usage: "the robust z-score above which an amount is an outlier",
+					Value: 3.5,
+				},
+				&cli.IntFlag{
+					Name:  "min-history",
+					Usage: "the number of transactions before amounts, and merchant countries, are compared with the history",
+					Value: 5,
+				},
+				&cli.IntFlag{
+					Name:  "burst",
+					Usage: "the number of authorizations within the burst window which is a burst",
+					Value: 5,
+				},
+				&cli.DurationFlag{
+					Name:  "burst-window",
+					Usage: "the window of a burst of authorizations",
+					Value: 10 * time.Minute,
+				},
+			},
+			BashComplete: completeFlagValues(map[string][]string{
+				"scope": extend.Names(anomaly.Scopes()),
+			}),
+			Action: func(c *cli.Context) error {
+				scope := anomaly.Scope(c.String("scope"))
+				if !contains(extend.Names(anomaly.Scopes()), string(scope)) {
+					return fmt.Errorf("unknown scope %q, expected one of %s", scope, strings.Join(extend.Names(anomaly.Scopes()), ", "))
+				}
+				since, err := extend.ParseTimestamp(c.String("since"))
+				if err != nil {
+					return err
+				}
+				request := extend.VirtualCardTransactionsRequest{After: since.Time}
+				cards, transactions, err := cardTransactions(client, c.StringSlice("card"), false, request)
+				if err != nil {
+					return err
+				}
+				detector := anomaly.New(
+					anomaly.WithScope(scope),
+					anomaly.WithMinScore(c.Float64("min-score")),
+					anomaly.WithOutlierThreshold(c.Float64("outlier-threshold")),
+					anomaly.WithMinHistory(c.Int("min-history")),
+					anomaly.WithBurst(c.Int("burst"), c.Duration("burst-window")))
+				return printResponse(c, detector.Detect(cards, transactions))
+			},
+		},
+		&cli.Command{
+			Name:  "policy",
+			Usage: "Enforce the spend policy on the virtual cards and transactions",
+			Subcommands: cli.Commands{
+				&cli.Command{
+					Name:   "check",
+					Usage:  "Report (and optionally remediate) the violations of the policy",
+					Before: authenticate,
+					Flags: []cli.Flag{
+						&cli.StringFlag{
+							Name:     "policy",
+							Aliases:  []string{"f"},
+							Usage:    "the path of the YAML policy",
+							Required: true,
+						},
+						&cli.StringSliceFlag{
+							Name:    "card",
+							Aliases: []string{"c"},
+							Usage:   "the ID of a virtual card to check, instead of every active virtual card",
+						},
+						&cli.StringFlag{
+							Name:  "since",
+							Usage: "check transactions after timestamp (e.g. 2020-01-01T01:01:12.123+0000)",
+						},
+						&cli.BoolFlag{
+							Name:  "remediate",
+							Usage: "apply the remediation of the violations of the rules",
+						},
+						&cli.BoolFlag{
+							Name:  "auto-approve",
+							Usage: "remediate the violations without confirming them",
+						},
+					},
+					Action: func(c *cli.Context) error {
+						f, err := os.Open(c.String("policy"))
+						if err != nil {
+							return err
+						}
+						p, err := policy.ReadPolicy(f)
+						_ = f.Close()
+						if err != nil {
+							return err
+						}
+						since, err := extend.ParseTimestamp(c.String("since"))
+						if err != nil {
+							return err
+						}
+						request := extend.VirtualCardTransactionsRequest{After: since.Time}
+						cards, transactions, err := cardTransactions(client, c.StringSlice("card"), true, request)
+						if err != nil {
+							return err
+						}
+						violations := p.Check(cards, transactions)
+						remediable := 0
+						for _, v := range violations {
+							if v.Remediation != policy.None {
+								remediable++
+							}
+						}
+						if c.Bool("remediate") && remediable > 0 {
+							if !c.Bool("auto-approve") {
+								if err := writeResponse(os.Stderr, "table", false, violations); err != nil {
+									return err
+								}
+								_, _ = fmt.Fprintf(os.Stderr, "Remediate the %d violations? [y/N]: ", remediable)
+								answer, err := credential.ReadLine(os.Stdin)
+								if err != nil {
+									return err
+								}
+								if !strings.EqualFold(answer, "y") && !strings.EqualFold(answer, "yes") {
+									return errors.New("remediation cancelled")
+								}
+							}
+							if err := policy.Remediate(client, violations); err != nil {
+								return err
+							}
+						}
+						if err := printResponse(c, violations); err != nil {
+							return err
+						}
+						outstanding := 0
+						for _, v := range violations {
+							if !v.Remediated {
+								outstanding++
+							}
+						}
+						if outstanding > 0 {
+							return fmt.Errorf("%d policy violations", outstanding)
+						}
+						return nil
+					},
+				},
+			},
+		},
+		&cli.Command{
+			Name:   "reconcile",
+			Usage:  "Reconcile the transactions with a CSV ledger, e.g. a bank statement, or ERP, export",
+			Before: authenticate,
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Name:     "ledger",
+					Aliases:  []string{"l"},
+					Usage:    "the path of the ledger CSV",
+					Required: true,
+				},
+				&cli.StringFlag{
+					Name:  "currency",
+					Usage: "the currency of the ledger entries without a currency",
+					Value: "USD",
+				},
+				&cli.StringFlag{Name: "date-column", Usage: "the name of the date column of the ledger"},
+				&cli.StringFlag{Name: "amount-column", Usage: "the name of the amount column of the ledger"},
+				&cli.StringFlag{Name: "currency-column", Usage: "the name of the currency column of the ledger"},
+				&cli.StringFlag{Name: "description-column", Usage: "the name of the description (merchant) column of the ledger"},
+				&cli.StringFlag{Name: "reference-column", Usage: "the name of the reference column of the ledger"},
+				&cli.BoolFlag{
+					Name:  "decimal-comma",
+					Usage: "the decimal separator of the ledger amounts is a comma, e.g. 1.234,56",
+				},
+				&cli.StringSliceFlag{
+					Name:    "card",
+					Aliases: []string{"c"},
+					Usage:   "the ID of a virtual card to reconcile the transactions of, instead of every virtual card",
+				},
+				&cli.StringFlag{
+					Name:  "since",
+					Usage: "reconcile transactions after timestamp, otherwise the window before the first entry",
+				},
+				&cli.StringFlag{
+					Name:  "until",
+					Usage: "reconcile transactions before timestamp, otherwise the window after the last entry",
+				},
+				&cli.DurationFlag{
+					Name:  "window",
+					Usage: "the maximum time between an entry and its transaction",
+					Value: 72 * time.Hour,
+				},
+				&cli.Int64Flag{
+					Name:  "tolerance",
+					Usage: "the difference, in minor units (e.g. cents), of amounts which are equal",
+				},
+				&cli.Float64Flag{
+					Name:  "fx-tolerance",
+					Usage: "the fraction by which the amount of a foreign transaction may differ in the billing currency",
+					Value: 0.01,
+				},
+			},
+			Action: func(c *cli.Context) error {
+				f, err := os.Open(c.String("ledger"))
+				if err != nil {
+					return err
+				}
+				var options []reconcile.LedgerOption
+				if c.Bool("decimal-comma") {
+					options = append(options, reconcile.WithDecimalComma())
+				}
+				entries, err := reconcile.ReadLedger(f, reconcile.Columns{
+					Date:        c.String("date-column"),
+					Amount:      c.String("amount-column"),
+					Currency:    c.String("currency-column"),
+					Description: c.String("description-column"),
+					Reference:   c.String("reference-column"),
+				}, c.String("currency"), options...)
+				_ = f.Close()
+				if err != nil {
+					return err
+				}
+				since, err := extend.ParseTimestamp(c.String("since"))
+				if err != nil {
+					return err
+				}
+				until, err := extend.ParseTimestamp(c.String("until"))
+				if err != nil {
+					return err
+				}
+				request := extend.VirtualCardTransactionsRequest{After: since.Time, Before: until.Time}
+				window := c.Duration("window")
+				for _, entry := range entries {
+					if !c.IsSet("since") && (request.After.IsZero() || entry.Date.Add(-window).Before(request.After)) {
+						request.After = entry.Date.Add(-window)
+					}
+					if !c.IsSet("until") && entry.Date.Add(window).After(request.Before) {
+						request.Before = entry.Date.Add(window)
+					}
+				}
+				_, transactions, err := cardTransactions(client, c.StringSlice("card"), false, request)
+				if err != nil {
+					return err
+				}
+				return printResponse(c, reconcile.Reconcile(
+					transactions,
+					entries,
+					reconcile.WithWindow(window),
+					reconcile.WithTolerance(c.Int64("tolerance")),
+					reconcile.WithFXTolerance(c.Float64("fx-tolerance"))))
+			},
+		},
+		&cli.Command{
+			Name:  "export",
+			Usage: "Export data for accounting tools",
+			Subcommands: cli.Commands{
+				&cli.Command{
+					Name:   "transactions",
+					Usage:  "Export the transactions of virtual cards as CSV, OFX or QIF",
+					Before: authenticate,
+					Flags: []cli.Flag{
+						&cli.StringFlag{
+							Name:    "format",
+							Aliases: []string{"f"},
+							Usage:   "the export format (" + strings.Join(extend.Names(export.Formats()), ", ") + ")",
+							Value:   string(export.CSV),
+						},
+						&cli.StringSliceFlag{
+							Name:    "card",
+							Aliases: []string{"c"},
+							Usage:   "the ID of a virtual card to export the transactions of, instead of every virtual card",
+						},
+						&cli.StringFlag{
+							Name:  "since",
+							Usage: "export transactions after timestamp (e.g. 2020-01-01T01:01:12.123+0000)",
+						},
+						&cli.StringFlag{
+							Name:  "until",
+							Usage: "export transactions before timestamp (e.g. 2020-01-01T01:01:12.123+0000)",
+						},
+						&cli.StringFlag{
+							Name:  "columns",
+							Usage: "the comma-delimited columns of the CSV export",
+						},
+						&cli.StringFlag{
+							Name:  "timezone",
+							Usage: "the IANA time zone of the exported dates (e.g. America/New_York)",
+							Value: "UTC",
+						},
+						&cli.StringFlag{
+							Name:  "file",
+							Usage: "the file to export to, instead of stdout",
+						},
+					},
+					BashComplete: completeFlagValues(map[string][]string{
+						"format": extend.Names(export.Formats()),
+					}),
+					Action: func(c *cli.Context) error {
+						var request extend.VirtualCardTransactionsRequest
+						since, err := extend.ParseTimestamp(c.String("since"))
+						if err != nil {
+							return err
+						}
+						until, err := extend.ParseTimestamp(c.String("until"))
+						if err != nil {
+							return err
+						}
+						request.After, request.Before = since.Time, until.Time
+						loc, err := time.LoadLocation(c.String("timezone"))
+						if err != nil {
+							return err
+						}
+						options := []export.Option{export.WithLocation(loc)}
+						if s := c.String("columns"); s != "" {
+							columns, err := export.ParseColumns(s)
+							if err != nil {
+								return err
+							}
+							options = append(options, export.WithColumns(columns...))
+						}
+						write := func(out io.Writer) error {
+							w, err := export.NewWriter(out, export.Format(c.String("format")), options...)
+							if err != nil {
+								return err
+							}
+							ids := c.StringSlice("card")
+							if len(ids) == 0 {
+								cards, err := extend.AllVirtualCards(client, extend.VirtualCardPageableRequest{})
+								if err != nil {
+									return err
+								}
+								for _, vc := range cards {
+									ids = append(ids, vc.ID)
+								}
+							}
+							for _, id := range ids {
+								if err := extend.EachVirtualCardTransaction(client, id, request, w.Write); err != nil {
+									return err
+								}
+							}
+							return w.Close()
+						}
+						path := c.String("file")
+						if path == "" {
+							return write(os.Stdout)
+						}
+						out, err := os.Create(path)
+						if err != nil {
+							return err
+						}
+						if err := write(out); err != nil {
+							_ = out.Close()
+							return err
+						}
+						return out.Close()
+					},
+				},
+			},
+		},
+		&cli.Command{
+			Name:  "login",
+			Usage: "Store the password of the profile, via the auth of the profile",
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Name:  "email",
+					Usage: "the email address to sign in with, otherwise the email of the profile",
+				},
+				&cli.BoolFlag{
+					Name:  "password-stdin",
+					Usage: "read the password from stdin, instead of prompting for it",
+				},
+			},
+			Action: func(c *cli.Context) error {
+				path, cfg, err := loadConfig(c)
+				if err != nil {
+					return err
+				}
+				name := cfg.Selected(c.String("profile"))
+				stored, err := cfg.Profile(c.String("profile"))
+				if err != nil {
+					return err
+				}
+				profile := stored.Override(os.Getenv)
+				if email := c.String("email"); email != "" {
+					profile.Email = email
+				}
+				if profile.Email == "" {
+					_, _ = fmt.Fprint(os.Stderr, "Email: ")
+					profile.Email, err = credential.ReadLine(os.Stdin)
+					if err != nil {
+						return err
+					}
+				}
+				store, err := credentialStore(c, profile)
+				if err != nil {
+					return err
+				}
+				account := credential.Account(profile.Server, profile.Email)
+				var password string
+				if c.Bool("password-stdin") {
+					password, err = credential.ReadLine(os.Stdin)
+				} else {
+					password, err = credential.Prompt(os.Stdin, os.Stderr).Get(account)
+				}
+				if err != nil {
+					return err
+				}
+				if err := verifyPassword(profile.Server, profile.Email, password, logger); err != nil {
+					return err
+				}
+				if err := store.Set(account, password); err != nil {
+					return err
+				}
+				if stored.Email == "" {
+					stored.Email = profile.Email
+					if err := cfg.Set(name, stored); err != nil {
+						return err
+					}
+					return cfg.Save(path)
+				}
+				return nil
+			},
+		},
+		&cli.Command{
+			Name:  "logout",
+			Usage: "Delete the stored password of the profile",
+			Action: func(c *cli.Context) error {
+				profile, err := loadProfile(c)
+				if err != nil {
+					return err
+				}
+				store, err := credentialStore(c, profile)
+				if err != nil {
+					return err
+				}
+				err = store.Delete(credential.Account(profile.Server, profile.Email))
+				if errors.Is(err, credential.ErrNotFound) {
+					return fmt.Errorf("no password is stored for %s", profile.Email)
+				}
+				return err
+			},
+		},
+		&cli.Command{
+			Name:  "config",
+			Usage: "Manage the configuration profiles",
+			Subcommands: cli.Commands{
+				&cli.Command{
+					Name:      "create",
+					Usage:     "Create (or replace) a profile",
+					ArgsUsage: "<name>",
+					Flags: []cli.Flag{
+						&cli.StringFlag{
+							Name:  "server",
+							Usage: "the URL of the Extend API",
+							Value: config.DefaultServer,
+						},
+						&cli.StringFlag{
+							Name:  "email",
+							Usage: "the email address to sign in with",
+						},
+						&cli.StringFlag{
+							Name:  "auth",
+							Usage: "the method to get the password with (" + strings.Join(extend.Names(config.Auths()), ", ") + ")",
+							Value: string(config.AuthKeyring),
+						},
+						&cli.StringFlag{
+							Name:  "password-command",
+							Usage: "the (shell) command which prints the password, for the command auth",
+						},
+						&cli.StringFlag{
+							Name:  "output",
+							Usage: "the default output format",
+						},
+						&cli.BoolFlag{
+							Name:  "use",
+							Usage: "use the profile as the current profile",
+						},
+					},
+					BashComplete: completeFlagValues(map[string][]string{
+						"auth": extend.Names(config.Auths()),
+					}),
+					Action: func(c *cli.Context) error {
+						name := c.Args().First()
+						if name == "" {
+							return errors.New("the name of the profile must be given")
+						}
+						path, cfg, err := loadConfig(c)
+						if err != nil {
+							return err
+						}
+						err = cfg.Set(name, config.Profile{
+							Server:          c.String("server"),
+							Email:           c.String("email"),
+							Auth:            config.Auth(c.String("auth")),
+							PasswordCommand: c.String("password-command"),
+							Output:          c.String("output"),
+						})
+						if err != nil {
+							return err
+						}
+						if c.Bool("use") {
+							cfg.Current = name
+						}
+						return cfg.Save(path)
+					},
+				},
+				&cli.Command{
+					Name:  "list",
+					Usage: "List the profiles",
+					Action: func(c *cli.Context) error {
+						_, cfg, err := loadConfig(c)
+						if err != nil {
+							return err
+						}
+						type entry struct {
+							Name    string `json:"name"`
+							Current bool   `json:"current"`
+							config.Profile
+						}
+						entries := make([]entry, 0, len(cfg.Profiles))
+						for _, name := range cfg.Names() {
+							entries = append(entries, entry{
+								Name:    name,
+								Current: name == cfg.Current,
+								Profile: cfg.Profiles[name],
+							})
+						}
+						return printResponse(c, entries)
+					},
+				},
+				&cli.Command{
+					Name:      "use",
+					Usage:     "Use a profile as the current profile",
+					ArgsUsage: "<name>",
+					Action: func(c *cli.Context) error {
+						path, cfg, err := loadConfig(c)
+						if err != nil {
+							return err
+						}
+						if err := cfg.Use(c.Args().First()); err != nil {
+							return err
+						}
+						return cfg.Save(path)
+					},
+				},
 			},
 		},
 	}
 
-	err = app.Run(os.Args)
+	err := app.Run(os.Args)
 	if err != nil {
-		log.Fatal(err)
+		logger.Error(err.Error())
+		os.Exit(1)
+	}
+}
+
+// newLogger returns the logger of the CLI application, which writes to stderr.
+//
+// Only warnings and errors are logged, unless debug is enabled, in which case the (redacted)
+// Extend API requests and responses are logged too.
+func newLogger(debug bool) *slog.Logger {
+	level := slog.LevelWarn
+	if debug {
+		level = slog.LevelDebug
 	}
+	return slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: level}))
 }
 
-// printResponse prints the response as (pretty) JSON.
-func printResponse(response any) error {
-	b, err := prettyjson.Marshal(response)
+// loadConfig returns the path, and the (loaded) configuration, of the configuration file.
+func loadConfig(c *cli.Context) (string, *config.Config, error) {
+	path := c.String("config")
+	if path == "" {
+		var err error
+		path, err = config.Path()
+		if err != nil {
+			return "", nil, err
+		}
+	}
+	cfg, err := config.Load(path)
 	if err != nil {
-		return err
+		return "", nil, err
+	}
+	return path, cfg, nil
+}
+
+// cardTransactions returns the virtual cards (with the IDs, otherwise every virtual card, or every
+// active virtual card), and their transactions matching the request.
+func cardTransactions(
+	client *extend.Client,
+	ids []string,
+	active bool,
+	request extend.VirtualCardTransactionsRequest,
+) ([]extend.VirtualCard, []extend.Transaction, error) {
+	var cards []extend.VirtualCard
+	if len(ids) > 0 {
+		for _, id := range ids {
+			response, err := client.GetVirtualCard(id)
+			if err != nil {
+				return nil, nil, err
+			}
+			cards = append(cards, response.VirtualCard)
+		}
+	} else {
+		var cardsRequest extend.VirtualCardPageableRequest
+		if active {
+			cardsRequest.Statuses = []extend.VirtualCardStatus{extend.VirtualCardStatusActive}
+		}
+		var err error
+		if cards, err = extend.AllVirtualCards(client, cardsRequest); err != nil {
+			return nil, nil, err
+		}
+	}
+	var transactions []extend.Transaction
+	for _, vc := range cards {
+		err := extend.EachVirtualCardTransaction(client, vc.ID, request, func(tx extend.Transaction) error {
+			if tx.VirtualCardID == "" {
+				tx.VirtualCardID = vc.ID
+			}
+			transactions = append(transactions, tx)
+			return nil
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	return cards, transactions, nil
+}
+
+// loadProfile returns the selected profile, overridden by the environment variables.
+func loadProfile(c *cli.Context) (config.Profile, error) {
+	_, cfg, err := loadConfig(c)
+	if err != nil {
+		return config.Profile{}, err
+	}
+	profile, err := cfg.Profile(c.String("profile"))
+	if err != nil {
+		return config.Profile{}, err
+	}
+	return profile.Override(os.Getenv), nil
+}
+
+// completing returns whether the CLI application is run to generate shell completions.
+func completing() bool {
+	return len(os.Args) > 0 && os.Args[len(os.Args)-1] == "--generate-bash-completion"
+}
+
+// completeFlagValues returns a cli.BashCompleteFunc which completes the values of the flags (by
+// name or alias), otherwise the flags of the command.
+func completeFlagValues(values map[string][]string) cli.BashCompleteFunc {
+	return func(c *cli.Context) {
+		if len(os.Args) > 2 {
+			previous := strings.TrimLeft(os.Args[len(os.Args)-2], "-")
+			for _, flag := range c.Command.Flags {
+				for _, name := range flag.Names() {
+					if name != previous {
+						continue
+					}
+					for _, value := range values[flag.Names()[0]] {
+						_, _ = fmt.Fprintln(c.App.Writer, value)
+					}
+					return
+				}
+			}
+		}
+		cli.DefaultCompleteWithFlags(c.Command)(c)
+	}
+}
+
+// parseList parses the comma-delimited list of enum values, ignoring empty elements.
+func parseList[E ~string](text string, parse func(string) (E, error)) ([]E, error) {
+	var values []E
+	for _, s := range strings.Split(text, ",") {
+		if s = strings.TrimSpace(s); s == "" {
+			continue
+		}
+		v, err := parse(s)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, v)
 	}
-	fmt.Println(string(b))
-	return nil
+	return values, nil
 }
@@ -0,0 +1,465 @@
+// Copyright 2022 c-fraser
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"text/template"
+
+	"github.com/c-fraser/extendz/pkg/anomaly"
+	extend "github.com/c-fraser/extendz/pkg/client"
+	"github.com/c-fraser/extendz/pkg/declines"
+	"github.com/c-fraser/extendz/pkg/export"
+	"github.com/c-fraser/extendz/pkg/plan"
+	"github.com/c-fraser/extendz/pkg/reconcile"
+	"github.com/hokaccha/go-prettyjson"
+	"github.com/urfave/cli/v2"
+	"golang.org/x/term"
+	"gopkg.in/yaml.v3"
+)
+
+// printValidation prints the invalid fields of the request validation error (if any), and returns
+// an error if the request is invalid.
+func printValidation(c *cli.Context, err error) error {
+	var invalid *extend.ValidationError
+	if err != nil && !errors.As(err, &invalid) {
+		return err
+	}
+	if invalid == nil {
+		invalid = &extend.ValidationError{Fields: []extend.FieldError{}}
+	}
+	if err := printResponse(c, invalid); err != nil {
+		return err
+	}
+	if len(invalid.Fields) > 0 {
+		return extend.ErrInvalidRequest
+	}
+	return nil
+}
+
+// printResponse prints the response to stdout in the --output format, with color if stdout is a
+// terminal.
+func printResponse(c *cli.Context, response any) error {
+	color := term.IsTerminal(int(os.Stdout.Fd())) && os.Getenv("NO_COLOR") == ""
+	return writeResponse(os.Stdout, c.String("output"), color, response)
+}
+
+// writeResponse writes the response in the output format.
+func writeResponse(w io.Writer, output string, color bool, response any) error {
+	format, arg, _ := strings.Cut(output, "=")
+	switch format {
+	case "json":
+		var b []byte
+		var err error
+		if color {
+			b, err = prettyjson.Marshal(response)
+		} else {
+			b, err = json.MarshalIndent(response, "", "  ")
+		}
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(w, string(b))
+		return err
+	case "yaml":
+		return writeYAML(w, response)
+	case "table", "csv":
+		header, rows, err := tabulate(response)
+		if err != nil {
+			return err
+		}
+		if format == "csv" {
+			cw := csv.NewWriter(w)
+			_ = cw.Write(header)
+			_ = cw.WriteAll(rows)
+			return cw.Error()
+		}
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, strings.ToUpper(strings.Join(header, "\t")))
+		for _, row := range rows {
+			fmt.Fprintln(tw, strings.Join(row, "\t"))
+		}
+		return tw.Flush()
+	case "template", "go-template":
+		t, err := template.New("output").Parse(arg)
+		if err != nil {
+			return fmt.Errorf("invalid output template: %w", err)
+		}
+		var b bytes.Buffer
+		if err := t.Execute(&b, response); err != nil {
+			return err
+		}
+		if b.Len() > 0 && !bytes.HasSuffix(b.Bytes(), []byte("\n")) {
+			b.WriteByte('\n')
+		}
+		_, err = w.Write(b.Bytes())
+		return err
+	case "jsonpath":
+		v, err := generic(response)
+		if err != nil {
+			return err
+		}
+		results, err := jsonPath(v, arg)
+		if err != nil {
+			return err
+		}
+		for _, r := range results {
+			if _, err := fmt.Fprintln(w, scalar(r)); err != nil {
+				return err
+			}
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown output format %q", output)
+	}
+}
+
+// writeYAML writes the response as YAML, with the fields in the order of the JSON of the response.
+func writeYAML(w io.Writer, response any) error {
+	b, err := json.Marshal(response)
+	if err != nil {
+		return err
+	}
+	// JSON is YAML, which is decoded into a node (to preserve the order of the fields) and encoded in
+	// the block style, quoting only the strings which would otherwise be decoded as another type.
+	var node yaml.Node
+	if err := yaml.Unmarshal(b, &node); err != nil {
+		return err
+	}
+	var block func(n *yaml.Node)
+	block = func(n *yaml.Node) {
+		n.Style = 0
+		for _, c := range n.Content {
+			block(c)
+		}
+	}
+	block(&node)
+	e := yaml.NewEncoder(w)
+	e.SetIndent(2)
+	if err := e.Encode(&node); err != nil {
+		return err
+	}
+	return e.Close()
+}
+
+// tabulate returns the header and rows of the response, with specific columns for the virtual cards
+// and transactions, otherwise the (top-level) fields of the response JSON.
+func tabulate(response any) ([]string, [][]string, error) {
+	switch r := response.(type) {
+	case *extend.VirtualCardsResponse:
+		header, rows := virtualCardRows(r.VirtualCards)
+		return header, rows, nil
+	case *extend.VirtualCardResponse:
+		header, rows := virtualCardRows([]extend.VirtualCard{r.VirtualCard})
+		return header, rows, nil
+	case *extend.TransactionsResponse:
+		header, rows := transactionRows(r.Transactions)
+		return header, rows, nil
+	case *extend.ValidationError:
+		rows := make([][]string, len(r.Fields))
+		for i, f := range r.Fields {
+			rows[i] = []string{f.Field, f.Message}
+		}
+		return []string{"field", "message"}, rows, nil
+	case []anomaly.Anomaly:
+		header, rows := anomalyRows(r)
+		return header, rows, nil
+	case *reconcile.Report:
+		return r.Header(), r.Rows(), nil
+	case *declines.Report:
+		header, rows := declineRows(r)
+		return header, rows, nil
+	case *plan.Plan:
+		header, rows := planRows(r)
+		return header, rows, nil
+	}
+	v, err := generic(response)
+	if err != nil {
+		return nil, nil, err
+	}
+	switch v := v.(type) {
+	case map[string]any:
+		var rows [][]string
+		for _, k := range keys(v) {
+			rows = append(rows, []string{k, scalar(v[k])})
+		}
+		return []string{"field", "value"}, rows, nil
+	case []any:
+		var header []string
+		for _, e := range v {
+			if o, ok := e.(map[string]any); ok {
+				for _, k := range keys(o) {
+					if !contains(header, k) {
+						header = append(header, k)
+					}
+				}
+			}
+		}
+		if header == nil {
+			header = []string{"value"}
+		}
+		var rows [][]string
+		for _, e := range v {
+			o, ok := e.(map[string]any)
+			if !ok {
+				rows = append(rows, []string{scalar(e)})
+				continue
+			}
+			row := make([]string, len(header))
+			for i, k := range header {
+				if value, ok := o[k]; ok {
+					row[i] = scalar(value)
+				}
+			}
+			rows = append(rows, row)
+		}
+		return header, rows, nil
+	default:
+		return []string{"value"}, [][]string{{scalar(v)}}, nil
+	}
+}
+
+// virtualCardRows returns the header and rows of the virtual cards.
+func virtualCardRows(cards []extend.VirtualCard) ([]string, [][]string) {
+	rows := make([][]string, len(cards))
+	for i, vc := range cards {
+		rows[i] = []string{
+			vc.ID,
+			vc.DisplayName,
+			string(vc.Status),
+			vc.Balance().String(),
+			vc.Limit().String(),
+			vc.Last4,
+			vc.ValidTo.String(),
+			strconv.FormatBool(vc.Recurs),
+		}
+	}
+	return []string{"id", "name", "status", "balance", "limit", "last4", "valid to", "recurs"}, rows
+}
+
+// transactionRows returns the header and rows of the transactions.
+func transactionRows(transactions []extend.Transaction) ([]string, [][]string) {
+	rows := make([][]string, len(transactions))
+	for i, tx := range transactions {
+		rows[i] = []string{
+			tx.ID,
+			export.Date(tx).String(),
+			string(tx.Status),
+			string(tx.Type),
+			export.Amount(tx).String(),
+			tx.MerchantName,
+			tx.Mcc,
+			tx.VirtualCardID,
+		}
+	}
+	return []string{"id", "date", "status", "type", "amount", "merchant", "mcc", "card"}, rows
+}
+
+// anomalyRows returns the header and rows of the anomalies.
+func anomalyRows(anomalies []anomaly.Anomaly) ([]string, [][]string) {
+	rows := make([][]string, len(anomalies))
+	for i, a := range anomalies {
+		findings := make([]string, len(a.Findings))
+		for j, f := range a.Findings {
+			findings[j] = string(f.Signal) + ": " + f.Explanation
+		}
+		rows[i] = []string{
+			strconv.FormatFloat(a.Score, 'f', 2, 64),
+			a.TransactionID,
+			a.CardID,
+			a.MerchantName,
+			a.Amount,
+			extend.NewTimestamp(a.AuthedAt).String(),
+			strings.Join(findings, "; "),
+		}
+	}
+	return []string{"score", "transaction", "card", "merchant", "amount", "authed at", "findings"}, rows
+}
+
+// declineRows returns the header and rows of the report, a row per group, then per fix.
+func declineRows(r *declines.Report) ([]string, [][]string) {
+	var rows [][]string
+	for _, g := range []struct {
+		name   string
+		groups []declines.Group
+	}{{"cause", r.ByCause}, {"reason", r.ByReason}, {"merchant", r.ByMerchant}, {"mcc", r.ByMcc}} {
+		for _, group := range g.groups {
+			key := group.Key
+			if group.Description != "" {
+				key += " (" + group.Description + ")"
+			}
+			rows = append(rows, []string{g.name, key, strconv.Itoa(group.Declines), strings.Join(group.Cards, " "), ""})
+		}
+	}
+	for _, f := range r.Fixes {
+		rows = append(rows, []string{"fix", string(f.Cause), strconv.Itoa(len(f.Transactions)), f.CardID, f.Action})
+	}
+	return []string{"group", "key", "declines", "cards", "fix"}, rows
+}
+
+// planRows returns the header and rows of the plan, a row per field, and warning, of each change.
+func planRows(p *plan.Plan) ([]string, [][]string) {
+	var rows [][]string
+	for _, change := range p.Changes {
+		row := []string{string(change.Action), change.Name, change.CardID}
+		if len(change.Fields) == 0 && len(change.Warnings) == 0 {
+			rows = append(rows, append(row, "", "", ""))
+		}
+		for _, f := range change.Fields {
+			rows = append(rows, append(row[:3:3], f.Field, f.From, f.To))
+		}
+		for _, w := range change.Warnings {
+			rows = append(rows, append(row[:3:3], "warning", "", w))
+		}
+	}
+	return []string{"action", "name", "card", "field", "from", "to"}, rows
+}
+
+// generic returns the response as generic JSON (maps, slices and scalars).
+func generic(response any) (any, error) {
+	b, err := json.Marshal(response)
+	if err != nil {
+		return nil, err
+	}
+	var v any
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.UseNumber()
+	return v, d.Decode(&v)
+}
+
+// scalar returns the generic JSON value as text, strings unquoted and the others as (compact) JSON.
+func scalar(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	default:
+		b, _ := json.Marshal(v)
+		return string(b)
+	}
+}
+
+// keys returns the sorted keys of the JSON object.
+func keys(o map[string]any) []string {
+	k := make([]string, 0, len(o))
+	for key := range o {
+		k = append(k, key)
+	}
+	sort.Strings(k)
+	return k
+}
+
+// contains returns whether the value is in the values.
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// jsonPath returns the values of the generic JSON selected by the JSONPath expression, which
+// supports a subset of JSONPath: fields (.name or ['name']), indices ([0], [-1]) and wildcards (.*
+// or [*]), optionally enclosed in braces, e.g. "{.virtualCards[*].id}".
+func jsonPath(v any, expr string) ([]any, error) {
+	path := strings.TrimSpace(expr)
+	path = strings.TrimSuffix(strings.TrimPrefix(path, "{"), "}")
+	path = strings.TrimPrefix(path, "$")
+	values := []any{v}
+	for path != "" {
+		var next []any
+		switch {
+		case strings.HasPrefix(path, ".*"), strings.HasPrefix(path, "[*]"):
+			if strings.HasPrefix(path, ".*") {
+				path = path[2:]
+			} else {
+				path = path[3:]
+			}
+			for _, value := range values {
+				switch value := value.(type) {
+				case []any:
+					next = append(next, value...)
+				case map[string]any:
+					for _, k := range keys(value) {
+						next = append(next, value[k])
+					}
+				}
+			}
+		case strings.HasPrefix(path, "."):
+			end := strings.IndexAny(path[1:], ".[")
+			if end < 0 {
+				end = len(path) - 1
+			}
+			name := path[1 : end+1]
+			path = path[end+1:]
+			next = fields(values, name)
+		case strings.HasPrefix(path, "["):
+			end := strings.Index(path, "]")
+			if end < 0 {
+				return nil, fmt.Errorf("invalid JSONPath %q", expr)
+			}
+			selector := path[1:end]
+			path = path[end+1:]
+			if name, ok := strings.CutPrefix(selector, "'"); ok {
+				next = fields(values, strings.TrimSuffix(name, "'"))
+				break
+			}
+			i, err := strconv.Atoi(selector)
+			if err != nil {
+				return nil, fmt.Errorf("invalid JSONPath %q: %w", expr, err)
+			}
+			for _, value := range values {
+				if a, ok := value.([]any); ok {
+					j := i
+					if j < 0 {
+						j += len(a)
+					}
+					if j >= 0 && j < len(a) {
+						next = append(next, a[j])
+					}
+				}
+			}
+		default:
+			return nil, fmt.Errorf("invalid JSONPath %q", expr)
+		}
+		values = next
+	}
+	return values, nil
+}
+
+// fields returns the field, of the name, of the JSON objects in the values.
+func fields(values []any, name string) []any {
+	var next []any
+	for _, value := range values {
+		if o, ok := value.(map[string]any); ok {
+			if f, ok := o[name]; ok {
+				next = append(next, f)
+			}
+		}
+	}
+	return next
+}
@@ -0,0 +1,64 @@
+// Copyright 2022 c-fraser
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	extend "github.com/c-fraser/extendz/pkg/client"
+)
+
+func TestWriteResponse(t *testing.T) {
+	response := &extend.VirtualCardsResponse{
+		Pagination: extend.Pagination{NumberOfPages: 1},
+		VirtualCards: []extend.VirtualCard{
+			{ID: "vc_1", DisplayName: "Travel", Status: extend.VirtualCardStatusActive, Currency: "USD", BalanceCents: 1234},
+			{ID: "vc_2", DisplayName: "Meals", Status: extend.VirtualCardStatusCancelled, Currency: "USD"},
+		},
+	}
+	for output, expected := range map[string]string{
+		"table": "ID    NAME    STATUS     BALANCE    LIMIT     LAST4  VALID TO  RECURS\n" +
+			"vc_1  Travel  ACTIVE     12.34 USD  0.00 USD                   false\n" +
+			"vc_2  Meals   CANCELLED  0.00 USD   0.00 USD                   false\n",
+		"csv": "id,name,status,balance,limit,last4,valid to,recurs\n" +
+			"vc_1,Travel,ACTIVE,12.34 USD,0.00 USD,,,false\n" +
+			"vc_2,Meals,CANCELLED,0.00 USD,0.00 USD,,,false\n",
+		"jsonpath={.virtualCards[*].id}":                  "vc_1\nvc_2\n",
+		"jsonpath=$.virtualCards[-1]['displayName']":      "Meals\n",
+		"template={{range .VirtualCards}}{{.ID}} {{end}}": "vc_1 vc_2 \n",
+		`template={{(index .VirtualCards 0).Balance}}`:    "12.34 USD\n",
+		"jsonpath=.pagination":                            `{"numberOfPages":1,"page":0,"pageItemCount":0,"totalItems":0}` + "\n",
+	} {
+		var b bytes.Buffer
+		if err := writeResponse(&b, output, false, response); err != nil {
+			t.Errorf("Failed to write %s output: %v", output, err)
+			continue
+		}
+		if actual := b.String(); actual != expected {
+			t.Errorf("Unexpected %s output:\n%s", output, actual)
+		}
+	}
+	var b bytes.Buffer
+	if err := writeResponse(&b, "yaml", false, response); err != nil {
+		t.Errorf("Failed to write yaml output: %v", err)
+	}
+	if !bytes.HasPrefix(b.Bytes(), []byte("pagination:\n  page: 0\n")) || !bytes.Contains(b.Bytes(), []byte("    expires: \"\"\n")) {
+		t.Errorf("Unexpected yaml output:\n%s", b.String())
+	}
+	if err := writeResponse(&bytes.Buffer{}, "xml", false, response); err == nil {
+		t.Errorf("Unexpected output of unknown format")
+	}
+}
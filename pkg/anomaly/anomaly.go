@@ -0,0 +1,366 @@
+// Copyright 2022 c-fraser
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package anomaly detects unusual transactions, for fraud review, offline from the transaction
+// history of the virtual cards (or cardholders).
+//
+// Each transaction is compared with the transactions before it, in the same scope (virtual card,
+// or cardholder), and each Signal found scores the transaction between 0 and 1. The Score of an
+// Anomaly combines the scores of its findings as independent probabilities, so it's also between 0
+// and 1, and higher when more signals are found.
+package anomaly
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/c-fraser/extendz/pkg/client"
+)
+
+// Signal is a kind of unusual activity.
+type Signal string
+
+const (
+	// AmountOutlier is a transaction amount which is an outlier of the amounts of the history.
+	AmountOutlier Signal = "amount-outlier"
+	// NewCountry is the first transaction of a merchant country.
+	NewCountry Signal = "new-country"
+	// Burst is a transaction of a burst of authorizations.
+	Burst Signal = "burst"
+	// ForeignExchange is a transaction in a foreign currency, exchanged to the billing currency.
+	ForeignExchange Signal = "foreign-exchange"
+	// OutsideValidity is a transaction before the ValidFrom, or after the ValidTo, of its virtual
+	// card.
+	OutsideValidity Signal = "outside-validity"
+)
+
+// Signals returns the Signal values.
+func Signals() []Signal {
+	return []Signal{AmountOutlier, NewCountry, Burst, ForeignExchange, OutsideValidity}
+}
+
+// Scope is the history which a transaction is compared with.
+type Scope string
+
+const (
+	// Card compares a transaction with the transactions of its virtual card.
+	Card Scope = "card"
+	// Cardholder compares a transaction with the transactions of its cardholder.
+	Cardholder Scope = "cardholder"
+)
+
+// Scopes returns the Scope values.
+func Scopes() []Scope {
+	return []Scope{Card, Cardholder}
+}
+
+// Anomaly is an unusual transaction.
+type Anomaly struct {
+	TransactionID string    `json:"transactionId"`
+	CardID        string    `json:"cardId"`
+	CardName      string    `json:"cardName"`
+	Cardholder    string    `json:"cardholder"`
+	MerchantName  string    `json:"merchantName"`
+	Amount        string    `json:"amount"`
+	AuthedAt      time.Time `json:"authedAt"`
+	// Score is the combined score of the findings, between 0 and 1.
+	Score    float64   `json:"score"`
+	Findings []Finding `json:"findings"`
+}
+
+// Finding is a Signal found for a transaction.
+type Finding struct {
+	Signal Signal `json:"signal"`
+	// Score is the score of the Signal, between 0 and 1.
+	Score       float64 `json:"score"`
+	Explanation string  `json:"explanation"`
+}
+
+// Detector detects the anomalies of transactions.
+type Detector struct {
+	scope Scope
+	// threshold is the robust z-score above which an amount is an outlier.
+	threshold float64
+	// history is the number of transactions of the scope before the amounts, and merchant
+	// countries, of a transaction are compared with the history.
+	history int
+	// burst is the number of authorizations within the window which is a burst.
+	burst  int
+	window time.Duration
+	// minScore is the Score below which anomalies are ignored.
+	minScore float64
+}
+
+// Option configures a Detector.
+type Option func(d *Detector)
+
+// WithScope configures the Scope of the history of each transaction. The default is Card.
+func WithScope(scope Scope) Option {
+	return func(d *Detector) {
+		d.scope = scope
+	}
+}
+
+// WithOutlierThreshold configures the robust z-score (per the median, and median absolute
+// deviation, of the amounts of the history) above which an amount is an AmountOutlier. The default
+// is 3.5.
+func WithOutlierThreshold(threshold float64) Option {
+	return func(d *Detector) {
+		d.threshold = threshold
+	}
+}
+
+// WithMinHistory configures the number of transactions before the amounts, and merchant countries,
+// of the transactions of a scope are compared with its history. The default is 5.
+func WithMinHistory(n int) Option {
+	return func(d *Detector) {
+		d.history = n
+	}
+}
+
+// WithBurst configures the number of authorizations within the window which is a Burst. The
+// default is 5 authorizations within 10 minutes.
+func WithBurst(n int, window time.Duration) Option {
+	return func(d *Detector) {
+		d.burst = n
+		d.window = window
+	}
+}
+
+// WithMinScore configures the Score below which anomalies are ignored. The default is 0, so every
+// transaction with a finding is an Anomaly.
+func WithMinScore(score float64) Option {
+	return func(d *Detector) {
+		d.minScore = score
+	}
+}
+
+// New returns a Detector.
+func New(options ...Option) *Detector {
+	d := &Detector{
+		scope:     Card,
+		threshold: 3.5,
+		history:   5,
+		burst:     5,
+		window:    10 * time.Minute,
+	}
+	for _, option := range options {
+		option(d)
+	}
+	return d
+}
+
+// history is the transactions of a scope, before the transaction being compared.
+type history struct {
+	// amounts are the amounts of the transactions, by billing currency.
+	amounts map[string][]float64
+	// countries are the merchant countries of the transactions.
+	countries map[string]bool
+	// authorizations are the times of the authorizations, in order.
+	authorizations []time.Time
+	// count is the number of transactions.
+	count int
+}
+
+// Detect returns the anomalies of the (approved) transactions of the virtual cards, by descending
+// Score. The transactions are compared in order of their authorization.
+func (d *Detector) Detect(cards []client.VirtualCard, transactions []client.Transaction) []Anomaly {
+	byID := make(map[string]client.VirtualCard, len(cards))
+	for _, vc := range cards {
+		byID[vc.ID] = vc
+	}
+	var approved []client.Transaction
+	for _, tx := range transactions {
+		switch tx.Status {
+		case client.TransactionStatusDeclined, client.TransactionStatusAvsFail, client.TransactionStatusAuthReversal:
+			continue
+		}
+		if tx.Type != client.TransactionTypeCredit {
+			approved = append(approved, tx)
+		}
+	}
+	sort.SliceStable(approved, func(i, j int) bool { return approved[i].AuthedAt.Before(approved[j].AuthedAt.Time) })
+
+	histories := make(map[string]*history)
+	anomalies := []Anomaly{}
+	for _, tx := range approved {
+		key := tx.VirtualCardID
+		if d.scope == Cardholder {
+			key = cardholder(tx)
+		}
+		h, ok := histories[key]
+		if !ok {
+			h = &history{amounts: make(map[string][]float64), countries: make(map[string]bool)}
+			histories[key] = h
+		}
+		vc := byID[tx.VirtualCardID]
+		findings := d.findings(vc, tx, h)
+		h.add(tx)
+		if len(findings) == 0 {
+			continue
+		}
+		a := Anomaly{
+			TransactionID: tx.ID,
+			CardID:        tx.VirtualCardID,
+			CardName:      tx.VcnDisplayName,
+			Cardholder:    cardholder(tx),
+			MerchantName:  tx.MerchantName,
+			Amount:        tx.AuthBillingAmount().String(),
+			AuthedAt:      tx.AuthedAt.Time,
+			Findings:      findings,
+		}
+		if a.CardName == "" {
+			a.CardName = vc.DisplayName
+		}
+		unlikely := 1.0
+		for _, f := range findings {
+			unlikely *= 1 - f.Score
+		}
+		a.Score = round(1 - unlikely)
+		if a.Score >= d.minScore {
+			anomalies = append(anomalies, a)
+		}
+	}
+	sort.SliceStable(anomalies, func(i, j int) bool { return anomalies[i].Score > anomalies[j].Score })
+	return anomalies
+}
+
+// findings returns the findings of the transaction of the virtual card, compared with the history.
+func (d *Detector) findings(vc client.VirtualCard, tx client.Transaction, h *history) []Finding {
+	var findings []Finding
+	find := func(signal Signal, score float64, format string, args ...any) {
+		findings = append(findings, Finding{
+			Signal:      signal,
+			Score:       round(math.Max(0, math.Min(1, score))),
+			Explanation: fmt.Sprintf(format, args...),
+		})
+	}
+	amounts := h.amounts[tx.AuthBillingCurrency]
+	if len(amounts) > 0 && len(amounts) >= d.history {
+		median, deviation := medianDeviation(amounts)
+		// The scale of a normal distribution of the deviation, or 10% of the median if the amounts
+		// are (mostly) the same.
+		scale := 1.4826 * deviation
+		if scale == 0 {
+			scale = math.Max(median*0.1, 1)
+		}
+		amount := float64(tx.AuthBillingAmountCents)
+		if z := (amount - median) / scale; z > d.threshold {
+			find(AmountOutlier, z/(2*d.threshold), "%s is %.1f deviations above the median %s of %d transactions",
+				tx.AuthBillingAmount(), z, client.NewMoney(int64(median), tx.AuthBillingCurrency), len(amounts))
+		}
+	}
+	if country := strings.ToUpper(tx.MerchantCountry); country != "" && h.count >= d.history && len(h.countries) > 0 && !h.countries[country] {
+		find(NewCountry, 0.5, "first transaction in %s, after %d transactions in %s",
+			country, h.count, strings.Join(sorted(h.countries), ", "))
+	}
+	if d.burst > 0 && !tx.AuthedAt.IsZero() {
+		n := 1
+		for i := len(h.authorizations) - 1; i >= 0 && tx.AuthedAt.Sub(h.authorizations[i]) <= d.window; i-- {
+			n++
+		}
+		if n >= d.burst {
+			find(Burst, 0.5+0.5*float64(n-d.burst)/float64(d.burst), "%d authorizations within %s", n, d.window)
+		}
+	}
+	if foreign(tx) {
+		find(ForeignExchange, 0.3, "%s exchanged to %s at %s",
+			tx.AuthMerchantAmount(), tx.AuthBillingAmount(), rate(tx.AuthExchangeRate))
+	}
+	if at := tx.AuthedAt; !at.IsZero() && vc.ID != "" {
+		switch {
+		case !vc.ValidFrom.IsZero() && at.Before(vc.ValidFrom.Time):
+			find(OutsideValidity, 0.9, "authorized at %s, before the card was valid from %s", at, vc.ValidFrom)
+		case !vc.ValidTo.IsZero() && at.After(vc.ValidTo.Time):
+			find(OutsideValidity, 0.9, "authorized at %s, after the card was valid to %s", at, vc.ValidTo)
+		}
+	}
+	return findings
+}
+
+// add the transaction to the history.
+func (h *history) add(tx client.Transaction) {
+	h.count++
+	h.amounts[tx.AuthBillingCurrency] = append(h.amounts[tx.AuthBillingCurrency], float64(tx.AuthBillingAmountCents))
+	if country := strings.ToUpper(tx.MerchantCountry); country != "" {
+		h.countries[country] = true
+	}
+	if !tx.AuthedAt.IsZero() {
+		h.authorizations = append(h.authorizations, tx.AuthedAt.Time)
+	}
+}
+
+// foreign returns whether the transaction was exchanged from a foreign currency.
+func foreign(tx client.Transaction) bool {
+	if !tx.AuthExchangeRate.IsIdentity() {
+		return true
+	}
+	return tx.AuthMerchantCurrency != "" && tx.AuthBillingCurrency != "" &&
+		!strings.EqualFold(tx.AuthMerchantCurrency, tx.AuthBillingCurrency)
+}
+
+// rate returns the exchange rate as text, "an unknown rate" if it's absent.
+func rate(r client.ExchangeRate) string {
+	if r == "" {
+		return "an unknown rate"
+	}
+	return string(r)
+}
+
+// cardholder returns the cardholder of the transaction, by email, else ID.
+func cardholder(tx client.Transaction) string {
+	if tx.CardholderEmail != "" {
+		return tx.CardholderEmail
+	}
+	return tx.CardholderID
+}
+
+// medianDeviation returns the median, and median absolute deviation, of the values.
+func medianDeviation(values []float64) (float64, float64) {
+	m := median(values)
+	deviations := make([]float64, len(values))
+	for i, v := range values {
+		deviations[i] = math.Abs(v - m)
+	}
+	return m, median(deviations)
+}
+
+// median returns the median of the values.
+func median(values []float64) float64 {
+	s := append([]float64(nil), values...)
+	sort.Float64s(s)
+	n := len(s)
+	if n%2 == 1 {
+		return s[n/2]
+	}
+	return (s[n/2-1] + s[n/2]) / 2
+}
+
+// sorted returns the keys of the set, sorted.
+func sorted(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for k := range set {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// round returns the score rounded to 2 decimal places.
+func round(score float64) float64 {
+	return math.Round(score*100) / 100
+}
@@ -0,0 +1,109 @@
+// Copyright 2022 c-fraser
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package anomaly
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/c-fraser/extendz/pkg/client"
+)
+
+func TestDetect(t *testing.T) {
+	start := time.Date(2024, time.January, 1, 12, 0, 0, 0, time.UTC)
+	cards := []client.VirtualCard{
+		{
+			ID:          "vc_1",
+			DisplayName: "Card",
+			ValidFrom:   client.NewTimestamp(start),
+			ValidTo:     client.NewTimestamp(start.AddDate(0, 1, 0)),
+		},
+	}
+	tx := func(id string, at time.Time, cents int, country string) client.Transaction {
+		return client.Transaction{
+			ID:                     id,
+			VirtualCardID:          "vc_1",
+			CardholderEmail:        "jane@example.com",
+			Status:                 client.TransactionStatusCleared,
+			AuthBillingAmountCents: cents,
+			AuthBillingCurrency:    "USD",
+			MerchantCountry:        country,
+			AuthedAt:               client.NewTimestamp(at),
+		}
+	}
+	var transactions []client.Transaction
+	for i := 0; i < 6; i++ {
+		transactions = append(transactions, tx(fmt.Sprintf("tx_%d", i), start.AddDate(0, 0, i), 1000+i*10, "US"))
+	}
+	large := tx("tx_large", start.AddDate(0, 0, 7), 50000, "US")
+	abroad := tx("tx_abroad", start.AddDate(0, 0, 8), 1020, "FR")
+	abroad.AuthMerchantAmountCents, abroad.AuthMerchantCurrency, abroad.AuthExchangeRate = 940, "EUR", "1.085"
+	late := tx("tx_late", start.AddDate(0, 2, 0), 1000, "US")
+	declined := tx("tx_declined", start.AddDate(0, 0, 9), 90000, "US")
+	declined.Status = client.TransactionStatusDeclined
+	transactions = append(transactions, late, declined, abroad, large)
+	for i := 0; i < 5; i++ {
+		transactions = append(transactions, tx(fmt.Sprintf("tx_burst_%d", i), start.AddDate(0, 0, 10).Add(time.Duration(i)*time.Minute), 1000, "US"))
+	}
+
+	anomalies := New().Detect(cards, transactions)
+	signals := make(map[string][]Signal)
+	for _, a := range anomalies {
+		for _, f := range a.Findings {
+			signals[a.TransactionID] = append(signals[a.TransactionID], f.Signal)
+		}
+	}
+	expected := map[string][]Signal{
+		"tx_large":   {AmountOutlier},
+		"tx_abroad":  {NewCountry, ForeignExchange},
+		"tx_late":    {OutsideValidity},
+		"tx_burst_4": {Burst},
+	}
+	if fmt.Sprint(signals) != fmt.Sprint(expected) {
+		t.Errorf("Unexpected anomalies: %v", signals)
+	}
+	if len(anomalies) == 0 || anomalies[0].TransactionID != "tx_large" || anomalies[0].Score != 1 {
+		t.Errorf("Unexpected highest anomaly: %+v", anomalies)
+	}
+	for _, a := range anomalies {
+		if a.TransactionID == "tx_abroad" && a.Score != 0.65 {
+			t.Errorf("Unexpected combined score: %v", a.Score)
+		}
+	}
+	if anomalies := New(WithMinScore(0.8)).Detect(cards, transactions); len(anomalies) != 2 {
+		t.Errorf("Unexpected anomalies above the minimum score: %+v", anomalies)
+	}
+}
+
+func TestDetectWithoutHistory(t *testing.T) {
+	tx := client.Transaction{
+		ID:                     "tx_1",
+		VirtualCardID:          "vc_1",
+		Status:                 client.TransactionStatusCleared,
+		AuthBillingAmountCents: 1000,
+		AuthBillingCurrency:    "USD",
+		MerchantCountry:        "US",
+		AuthedAt:               client.NewTimestamp(time.Date(2024, time.January, 1, 12, 0, 0, 0, time.UTC)),
+	}
+	for _, n := range []int{0, 1} {
+		if anomalies := New(WithMinHistory(n)).Detect(nil, []client.Transaction{tx}); len(anomalies) != 0 {
+			t.Errorf("Unexpected anomalies with a minimum history of %d: %v", n, anomalies)
+		}
+	}
+	if anomalies := New(WithMinHistory(0)).Detect(nil, nil); len(anomalies) != 0 {
+		t.Errorf("Unexpected anomalies: %v", anomalies)
+	}
+}
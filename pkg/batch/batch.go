@@ -0,0 +1,373 @@
+// Copyright 2022 c-fraser
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package batch creates, updates or cancels virtual cards in bulk, from the rows of a CSV or JSON
+// Lines file.
+//
+// The fields of a row are the (JSON) fields of the CreateVirtualCardRequest or
+// UpdateVirtualCardRequest, e.g. creditCardId, recipient, displayName and balanceCents, with nested
+// fields by dotted name (e.g. recurrence.period). The update and cancel rows also have the id of
+// the virtual card. The CSV values are converted to the type of the field, so slices and structs
+// (e.g. validMccRanges) are JSON. Empty values are omitted.
+//
+// The results of a batch are the input rows with the result_status, result_card_id and
+// result_error fields. A results file is a valid input, in which the succeeded rows are skipped, so
+// the failed rows of a batch are re-run by running the results.
+//
+// Each created virtual card has an idempotency key (see client.Client.CreateVirtualCard), from the
+// idempotency_key field of the row, which is generated (and written to the results) if unset. So
+// re-running a row whose creation failed, e.g. timed out, doesn't create a duplicate card.
+package batch
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Format is the format of an input, or results, file.
+type Format string
+
+const (
+	CSV   Format = "csv"
+	JSONL Format = "jsonl"
+)
+
+// Formats returns the file formats.
+func Formats() []Format {
+	return []Format{CSV, JSONL}
+}
+
+// FormatOf returns the Format of the file at the path, by its extension.
+func FormatOf(path string) (Format, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".csv":
+		return CSV, nil
+	case ".jsonl", ".ndjson":
+		return JSONL, nil
+	default:
+		return "", fmt.Errorf("unknown format of %s, expected a .csv or .jsonl file", path)
+	}
+}
+
+// The names of the result fields of a row.
+const (
+	ResultStatus = "result_status"
+	ResultCardID = "result_card_id"
+	ResultError  = "result_error"
+)
+
+// IdempotencyKey is the name of the idempotency key field of a row.
+const IdempotencyKey = "idempotency_key"
+
+// id is the name of the virtual card ID field of a row.
+const id = "id"
+
+// Row is a record of an input file.
+type Row struct {
+	// Number is the (1-based) number of the row, excluding the CSV header.
+	Number int
+	// Fields are the names of the fields, in input order.
+	Fields []string
+	// Values are the values of the fields, strings for CSV, otherwise JSON values.
+	Values map[string]any
+}
+
+// String returns the string value of the field, empty if unset.
+func (r Row) String(field string) string {
+	switch v := r.Values[field].(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	default:
+		data, _ := json.Marshal(v)
+		return string(data)
+	}
+}
+
+// Read the rows of the input in the format.
+func Read(r io.Reader, format Format) ([]Row, error) {
+	switch format {
+	case CSV:
+		return readCSV(r)
+	case JSONL:
+		return readJSONL(r)
+	default:
+		return nil, fmt.Errorf("unknown batch format %q, expected one of csv, jsonl", format)
+	}
+}
+
+// readCSV reads the rows of the CSV, with a header of the field names.
+func readCSV(r io.Reader) ([]Row, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+	header, err := reader.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	for i, field := range header {
+		header[i] = strings.TrimSpace(strings.TrimPrefix(field, "\ufeff"))
+	}
+	var rows []Row
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return rows, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		row := Row{Number: len(rows) + 1, Fields: header, Values: make(map[string]any, len(header))}
+		for i, value := range record {
+			if value != "" {
+				row.Values[header[i]] = value
+			}
+		}
+		rows = append(rows, row)
+	}
+}
+
+// readJSONL reads the rows of the JSON objects, one per line.
+func readJSONL(r io.Reader) ([]Row, error) {
+	var rows []Row
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		row := Row{Number: len(rows) + 1}
+		fields, err := objectKeys(line)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse row %d: %w", row.Number, err)
+		}
+		if err := json.Unmarshal(line, &row.Values); err != nil {
+			return nil, fmt.Errorf("failed to parse row %d: %w", row.Number, err)
+		}
+		row.Fields = fields
+		rows = append(rows, row)
+	}
+	return rows, scanner.Err()
+}
+
+// objectKeys returns the keys, in order, of the JSON object.
+func objectKeys(data []byte) ([]string, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	if t, err := decoder.Token(); err != nil || t != json.Delim('{') {
+		return nil, errors.New("expected a JSON object")
+	}
+	var keys []string
+	for decoder.More() {
+		t, err := decoder.Token()
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, t.(string))
+		var skip json.RawMessage
+		if err := decoder.Decode(&skip); err != nil {
+			return nil, err
+		}
+	}
+	return keys, nil
+}
+
+// decode the (request) fields of the row into the value, an error if a field is unknown or its
+// value doesn't match the type of the field.
+func decode(row Row, v any) error {
+	object := make(map[string]any)
+	t := reflect.TypeOf(v).Elem()
+	for _, field := range row.Fields {
+		value, ok := row.Values[field]
+		if !ok || field == id || field == IdempotencyKey || strings.HasPrefix(field, "result_") {
+			continue
+		}
+		path := strings.Split(field, ".")
+		ft, ok := fieldType(t, path)
+		if !ok {
+			return fmt.Errorf("unknown field %q", field)
+		}
+		if s, ok := value.(string); ok {
+			converted, err := convert(s, ft)
+			if err != nil {
+				return fmt.Errorf("invalid %s %q: %w", field, s, err)
+			}
+			value = converted
+		}
+		o := object
+		for _, name := range path[:len(path)-1] {
+			nested, ok := o[name].(map[string]any)
+			if !ok {
+				nested = make(map[string]any)
+				o[name] = nested
+			}
+			o = nested
+		}
+		o[path[len(path)-1]] = value
+	}
+	data, err := json.Marshal(object)
+	if err != nil {
+		return err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	return decoder.Decode(v)
+}
+
+// fieldType returns the type of the (nested) field with the JSON names of the path.
+func fieldType(t reflect.Type, path []string) (reflect.Type, bool) {
+	for _, name := range path {
+		for t.Kind() == reflect.Pointer {
+			t = t.Elem()
+		}
+		if t.Kind() != reflect.Struct {
+			return nil, false
+		}
+		found := false
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if tag, _, _ := strings.Cut(f.Tag.Get("json"), ","); tag == name {
+				t, found = f.Type, true
+				break
+			}
+		}
+		if !found {
+			return nil, false
+		}
+	}
+	return t, true
+}
+
+// unmarshaler is the type of json.Unmarshaler.
+var unmarshaler = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+
+// convert the (CSV) text to the JSON value of the type.
+func convert(text string, t reflect.Type) (any, error) {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return text, nil
+	case reflect.Bool:
+		return strconv.ParseBool(text)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.ParseInt(text, 10, 64)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.ParseUint(text, 10, 64)
+	case reflect.Float32, reflect.Float64:
+		return strconv.ParseFloat(text, 64)
+	case reflect.Struct:
+		if reflect.PointerTo(t).Implements(unmarshaler) && !strings.HasPrefix(strings.TrimSpace(text), "{") {
+			// e.g. a Timestamp, which is a JSON string
+			return text, nil
+		}
+	}
+	var value any
+	if err := json.Unmarshal([]byte(text), &value); err != nil {
+		return nil, errors.New("expected JSON")
+	}
+	return value, nil
+}
+
+// Write the results, as rows with the result fields, to the writer in the format.
+func Write(w io.Writer, format Format, results []Result) error {
+	var fields []string
+	for _, result := range results {
+		for _, field := range result.Row.Fields {
+			if !strings.HasPrefix(field, "result_") && !contains(fields, field) {
+				fields = append(fields, field)
+			}
+		}
+	}
+	for _, result := range results {
+		if result.IdempotencyKey != "" && !contains(fields, IdempotencyKey) {
+			fields = append(fields, IdempotencyKey)
+		}
+	}
+	fields = append(fields, ResultStatus, ResultCardID, ResultError)
+	switch format {
+	case CSV:
+		writer := csv.NewWriter(w)
+		if err := writer.Write(fields); err != nil {
+			return err
+		}
+		for _, result := range results {
+			row := result.row()
+			record := make([]string, len(fields))
+			for i, field := range fields {
+				record[i] = row.String(field)
+			}
+			if err := writer.Write(record); err != nil {
+				return err
+			}
+		}
+		writer.Flush()
+		return writer.Error()
+	case JSONL:
+		for _, result := range results {
+			row := result.row()
+			var b bytes.Buffer
+			b.WriteByte('{')
+			n := 0
+			for _, field := range fields {
+				value, ok := row.Values[field]
+				if !ok {
+					continue
+				}
+				if n > 0 {
+					b.WriteByte(',')
+				}
+				n++
+				key, _ := json.Marshal(field)
+				data, err := json.Marshal(value)
+				if err != nil {
+					return err
+				}
+				b.Write(key)
+				b.WriteByte(':')
+				b.Write(data)
+			}
+			b.WriteString("}\n")
+			if _, err := w.Write(b.Bytes()); err != nil {
+				return err
+			}
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown batch format %q, expected one of csv, jsonl", format)
+	}
+}
+
+// contains returns whether the values contain the value.
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,224 @@
+// Copyright 2022 c-fraser
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package batch
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/c-fraser/extendz/pkg/client"
+)
+
+const createCSV = `creditCardId,recipient,displayName,balanceCents,validTo,recurs,recurrence.period,recurrence.balanceCents,recurrence.terminator,recurrence.byMonthDay,validMccRanges
+cc_1,a@example.com,Vendor A,10000,2030-01-01T00:00:00.000+0000,true,MONTHLY,10000,NONE,1,"[{""lowest"":""5811"",""highest"":""5814""}]"
+cc_1,b@example.com,Vendor B,0,,,,,,,
+cc_1,fail@example.com,Vendor C,500,,,,,,,
+`
+
+// testAPI is an API which creates cards with sequential IDs, and fails for the fail@example.com
+// recipient.
+type testAPI struct {
+	mu       sync.Mutex
+	created  []client.CreateVirtualCardRequest
+	updated  map[string]client.UpdateVirtualCardRequest
+	inflight atomic.Int32
+	peak     atomic.Int32
+}
+
+func (a *testAPI) call(f func() (*client.VirtualCardResponse, error)) (*client.VirtualCardResponse, error) {
+	n := a.inflight.Add(1)
+	defer a.inflight.Add(-1)
+	for {
+		peak := a.peak.Load()
+		if n <= peak || a.peak.CompareAndSwap(peak, n) {
+			break
+		}
+	}
+	time.Sleep(5 * time.Millisecond)
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return f()
+}
+
+func (a *testAPI) CreateVirtualCard(request *client.CreateVirtualCardRequest) (*client.VirtualCardResponse, error) {
+	return a.call(func() (*client.VirtualCardResponse, error) {
+		if request.Recipient == "fail@example.com" {
+			return nil, errors.New("recipient not found")
+		}
+		a.created = append(a.created, *request)
+		return &client.VirtualCardResponse{VirtualCard: client.VirtualCard{ID: fmt.Sprintf("vc_%s", request.DisplayName[7:])}}, nil
+	})
+}
+
+func (a *testAPI) UpdateVirtualCard(id string, request *client.UpdateVirtualCardRequest) (*client.VirtualCardResponse, error) {
+	return a.call(func() (*client.VirtualCardResponse, error) {
+		if a.updated == nil {
+			a.updated = make(map[string]client.UpdateVirtualCardRequest)
+		}
+		a.updated[id] = *request
+		return &client.VirtualCardResponse{VirtualCard: client.VirtualCard{ID: id}}, nil
+	})
+}
+
+func (a *testAPI) CancelVirtualCard(id string) (*client.VirtualCardResponse, error) {
+	return a.call(func() (*client.VirtualCardResponse, error) {
+		return &client.VirtualCardResponse{VirtualCard: client.VirtualCard{ID: id}}, nil
+	})
+}
+
+func TestDecode(t *testing.T) {
+	rows, err := Read(strings.NewReader(createCSV), CSV)
+	if err != nil {
+		t.Fatalf("Failed to read rows: %v", err)
+	}
+	if len(rows) != 3 {
+		t.Fatalf("Unexpected rows: %v", rows)
+	}
+	var request client.CreateVirtualCardRequest
+	if err := decode(rows[0], &request); err != nil {
+		t.Fatalf("Failed to decode row: %v", err)
+	}
+	if request.BalanceCents != 10000 || !request.Recurs || request.Recurrence.Period != client.RecurrencePeriodMonthly ||
+		request.Recurrence.ByMonthDay != 1 || len(request.ValidMccRanges) != 1 ||
+		request.ValidTo.Year() != 2030 {
+		t.Errorf("Unexpected request: %+v", request)
+	}
+	unknown := Row{Fields: []string{"displayname"}, Values: map[string]any{"displayname": "x"}}
+	if err := decode(unknown, &request); err == nil {
+		t.Errorf("Unexpected decode of unknown field")
+	}
+	invalid := Row{Fields: []string{"balanceCents"}, Values: map[string]any{"balanceCents": "12.50"}}
+	if err := decode(invalid, &request); err == nil {
+		t.Errorf("Unexpected decode of invalid value")
+	}
+}
+
+func TestRunCreate(t *testing.T) {
+	rows, err := Read(strings.NewReader(createCSV), CSV)
+	if err != nil {
+		t.Fatalf("Failed to read rows: %v", err)
+	}
+	api := &testAPI{}
+	results, err := Run(context.Background(), api, Create, rows, WithConcurrency(2))
+	if err != nil {
+		t.Fatalf("Failed to run batch: %v", err)
+	}
+	expected := []Status{Succeeded, Failed, Failed}
+	for i, r := range results {
+		if r.Status != expected[i] || r.Number != i+1 {
+			t.Errorf("Unexpected result %d: %+v", i, r)
+		}
+	}
+	if results[0].CardID != "vc_A" {
+		t.Errorf("Unexpected card ID: %s", results[0].CardID)
+	}
+	if !strings.Contains(results[1].Error, "balanceCents") || results[2].Error != "recipient not found" {
+		t.Errorf("Unexpected errors: %v, %v", results[1].Error, results[2].Error)
+	}
+	if peak := api.peak.Load(); peak > 2 {
+		t.Errorf("Unexpected concurrency: %d", peak)
+	}
+
+	// re-run the results, after fixing the failed rows, only the failed rows are created
+	var b bytes.Buffer
+	if err := Write(&b, CSV, results); err != nil {
+		t.Fatalf("Failed to write results: %v", err)
+	}
+	if !strings.Contains(b.String(), ","+results[2].IdempotencyKey+",failed,") {
+		t.Errorf("Unexpected results, without idempotency key: %s", b.String())
+	}
+	keys := map[int]string{}
+	for _, r := range results {
+		keys[r.Number] = r.IdempotencyKey
+	}
+	if keys[1] == "" || keys[2] != "" {
+		t.Errorf("Unexpected idempotency keys, only of the valid rows: %v", keys)
+	}
+	fixed := strings.Replace(strings.Replace(b.String(), "Vendor B,0", "Vendor B,100", 1), "fail@", "c@", 1)
+	rows, err = Read(strings.NewReader(fixed), CSV)
+	if err != nil {
+		t.Fatalf("Failed to read results: %v", err)
+	}
+	results, err = Run(context.Background(), api, Create, rows)
+	if err != nil {
+		t.Fatalf("Failed to run batch: %v", err)
+	}
+	expected = []Status{Skipped, Succeeded, Succeeded}
+	for i, r := range results {
+		if r.Status != expected[i] {
+			t.Errorf("Unexpected result %d: %+v", i, r)
+		}
+	}
+	if results[0].CardID != "vc_A" || len(api.created) != 3 {
+		t.Errorf("Unexpected re-run: %+v, %d", results[0], len(api.created))
+	}
+	if r := results[2]; r.IdempotencyKey != keys[r.Number] {
+		t.Errorf("Unexpected idempotency key of re-run: %+v", r)
+	}
+}
+
+func TestRunUpdate(t *testing.T) {
+	input := `{"id":"vc_1","balanceCents":2500,"notes":"raised"}
+{"id":"vc_2"}
+{"balanceCents":100}
+`
+	rows, err := Read(strings.NewReader(input), JSONL)
+	if err != nil {
+		t.Fatalf("Failed to read rows: %v", err)
+	}
+	api := &testAPI{}
+	results, err := Run(context.Background(), api, Update, rows)
+	if err != nil {
+		t.Fatalf("Failed to run batch: %v", err)
+	}
+	expected := []Status{Succeeded, Failed, Failed}
+	for i, r := range results {
+		if r.Status != expected[i] {
+			t.Errorf("Unexpected result %d: %+v", i, r)
+		}
+	}
+	if update := api.updated["vc_1"]; *update.BalanceCents != 2500 || *update.Notes != "raised" || update.Currency != nil {
+		t.Errorf("Unexpected update: %+v", update)
+	}
+	var b bytes.Buffer
+	if err := Write(&b, JSONL, results); err != nil {
+		t.Fatalf("Failed to write results: %v", err)
+	}
+	line := strings.Split(b.String(), "\n")[0]
+	if line != `{"id":"vc_1","balanceCents":2500,"notes":"raised","result_status":"succeeded","result_card_id":"vc_1"}` {
+		t.Errorf("Unexpected results: %s", line)
+	}
+}
+
+func TestRunDryRun(t *testing.T) {
+	rows, err := Read(strings.NewReader("id\nvc_1\n\nvc_2\n"), CSV)
+	if err != nil {
+		t.Fatalf("Failed to read rows: %v", err)
+	}
+	results, err := Run(context.Background(), nil, Cancel, rows, WithDryRun(true))
+	if err != nil {
+		t.Fatalf("Failed to run batch: %v", err)
+	}
+	if summary := Summary(results); summary[Valid] != 2 || len(results) != 2 {
+		t.Errorf("Unexpected results: %+v", results)
+	}
+}
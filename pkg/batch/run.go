@@ -0,0 +1,228 @@
+// Copyright 2022 c-fraser
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package batch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/c-fraser/extendz/pkg/client"
+)
+
+// Operation is the operation of a batch.
+type Operation string
+
+const (
+	Create Operation = "create"
+	Update Operation = "update"
+	Cancel Operation = "cancel"
+)
+
+// API is the subset of the client.Client operations used by Run.
+type API interface {
+	CreateVirtualCard(request *client.CreateVirtualCardRequest) (*client.VirtualCardResponse, error)
+	UpdateVirtualCard(id string, request *client.UpdateVirtualCardRequest) (*client.VirtualCardResponse, error)
+	CancelVirtualCard(id string) (*client.VirtualCardResponse, error)
+}
+
+// Status is the status of the Result of a row.
+type Status string
+
+const (
+	// Succeeded is a row whose operation succeeded.
+	Succeeded Status = "succeeded"
+	// Failed is a row which is invalid, or whose operation failed.
+	Failed Status = "failed"
+	// Skipped is a row which succeeded in a previous run, per its result fields.
+	Skipped Status = "skipped"
+	// Valid is a row which is valid, in a dry run.
+	Valid Status = "valid"
+)
+
+// Result is the result of the operation of a row.
+type Result struct {
+	Row    Row    `json:"-"`
+	Number int    `json:"row"`
+	Status Status `json:"status"`
+	CardID string `json:"cardId,omitempty"`
+	Error  string `json:"error,omitempty"`
+	// IdempotencyKey is the idempotency key of the creation of the virtual card.
+	IdempotencyKey string `json:"idempotencyKey,omitempty"`
+}
+
+// row returns the Row with the result fields.
+func (r Result) row() Row {
+	values := make(map[string]any, len(r.Row.Values)+3)
+	for k, v := range r.Row.Values {
+		values[k] = v
+	}
+	if r.IdempotencyKey != "" {
+		values[IdempotencyKey] = r.IdempotencyKey
+	}
+	values[ResultStatus] = string(r.Status)
+	delete(values, ResultCardID)
+	delete(values, ResultError)
+	if r.CardID != "" {
+		values[ResultCardID] = r.CardID
+	}
+	if r.Error != "" {
+		values[ResultError] = r.Error
+	}
+	return Row{Number: r.Row.Number, Fields: r.Row.Fields, Values: values}
+}
+
+// Summary counts the Result values by Status.
+func Summary(results []Result) map[Status]int {
+	summary := make(map[Status]int)
+	for _, r := range results {
+		summary[r.Status]++
+	}
+	return summary
+}
+
+// config is the configuration of Run.
+type config struct {
+	concurrency int
+	dryRun      bool
+}
+
+// Option configures Run.
+type Option func(c *config)
+
+// WithConcurrency configures the maximum number of operations in flight, which is 4 otherwise.
+func WithConcurrency(n int) Option {
+	return func(c *config) {
+		if n > 0 {
+			c.concurrency = n
+		}
+	}
+}
+
+// WithDryRun configures Run to only decode, and validate, the rows, without calling the API.
+func WithDryRun(enabled bool) Option {
+	return func(c *config) {
+		c.dryRun = enabled
+	}
+}
+
+// Run the operation for each of the rows, returning a Result per row, in the order of the rows.
+//
+// The rows which fail don't stop the batch, unless the context is done, in which case the rows
+// which weren't run fail with the context error.
+func Run(ctx context.Context, api API, operation Operation, rows []Row, options ...Option) ([]Result, error) {
+	switch operation {
+	case Create, Update, Cancel:
+	default:
+		return nil, fmt.Errorf("unknown batch operation %q, expected one of create, update, cancel", operation)
+	}
+	c := config{concurrency: 4}
+	for _, option := range options {
+		option(&c)
+	}
+	results := make([]Result, len(rows))
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < c.concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				results[i] = run(api, operation, rows[i], c.dryRun)
+			}
+		}()
+	}
+	next := 0
+feed:
+	for ; next < len(rows); next++ {
+		select {
+		case indexes <- next:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(indexes)
+	wg.Wait()
+	for i := next; i < len(rows); i++ {
+		results[i] = Result{Row: rows[i], Number: rows[i].Number, Status: Failed, Error: ctx.Err().Error()}
+	}
+	return results, nil
+}
+
+// run the operation for the row.
+func run(api API, operation Operation, row Row, dryRun bool) Result {
+	result := Result{Row: row, Number: row.Number, IdempotencyKey: row.String(IdempotencyKey)}
+	if Status(row.String(ResultStatus)) == Succeeded || Status(row.String(ResultStatus)) == Skipped {
+		result.Status = Skipped
+		result.CardID = row.String(ResultCardID)
+		return result
+	}
+	call, err := prepare(api, operation, row, &result)
+	switch {
+	case err != nil:
+		result.Status, result.Error = Failed, err.Error()
+	case dryRun:
+		result.Status = Valid
+	default:
+		response, err := call()
+		if err != nil {
+			result.Status, result.Error = Failed, err.Error()
+			break
+		}
+		result.Status, result.CardID = Succeeded, response.VirtualCard.ID
+	}
+	return result
+}
+
+// prepare decodes, and validates, the request of the row, returning the call of the operation. The
+// ID of the virtual card (if known), and idempotency key of a creation, are set on the result.
+func prepare(api API, operation Operation, row Row, result *Result) (func() (*client.VirtualCardResponse, error), error) {
+	cardID := strings.TrimSpace(row.String(id))
+	result.CardID = cardID
+	if operation != Create && cardID == "" {
+		return nil, errors.New("the id of the virtual card is required")
+	}
+	switch operation {
+	case Create:
+		var request client.CreateVirtualCardRequest
+		if err := decode(row, &request); err != nil {
+			return nil, err
+		}
+		if err := request.Validate(); err != nil {
+			return nil, err
+		}
+		if result.IdempotencyKey == "" {
+			result.IdempotencyKey = client.NewIdempotencyKey()
+		}
+		request.IdempotencyKey = result.IdempotencyKey
+		return func() (*client.VirtualCardResponse, error) { return api.CreateVirtualCard(&request) }, nil
+	case Update:
+		var request client.UpdateVirtualCardRequest
+		if err := decode(row, &request); err != nil {
+			return nil, err
+		}
+		if request.IsEmpty() {
+			return nil, errors.New("the update has no fields")
+		}
+		if err := request.Validate(); err != nil {
+			return nil, err
+		}
+		return func() (*client.VirtualCardResponse, error) { return api.UpdateVirtualCard(cardID, &request) }, nil
+	default:
+		return func() (*client.VirtualCardResponse, error) { return api.CancelVirtualCard(cardID) }, nil
+	}
+}
@@ -16,12 +16,12 @@ package client
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
+	"log/slog"
 	"net/http"
-	"net/url"
-	"strconv"
 	"sync/atomic"
 	"time"
 )
@@ -29,7 +29,7 @@ import (
 // Client makes RESTful calls to https://developer.paywithextend.com/#extend-api endpoints.
 //
 // Authentication (token retrieval and renewal) is automatically managed by the Client via the given
-// username and testPassword.
+// email and password.
 //
 // Close should be invoked upon exit to release Client resources.
 type Client struct {
@@ -47,10 +47,20 @@ type Client struct {
 	validity time.Duration
 	// closed is the channel used to stop the refreshToken goroutine.
 	closed chan struct{}
+	// middleware wraps each Call made by the Client.
+	middleware []Middleware
+	// handler makes each Call, through the middleware.
+	handler Handler
+	// logger logs the Client events.
+	logger *slog.Logger
+	// validate is whether requests are validated before they're sent.
+	validate bool
+	// idempotent is whether an idempotency key is generated for each CreateVirtualCardRequest.
+	idempotent bool
 }
 
-// NewClient initializes and returns (a reference to) a Client.
-func NewClient(server, email, password string) (*Client, error) {
+// NewClient initializes and returns (a reference to) a Client configured with the options.
+func NewClient(server, email, password string, options ...Option) (*Client, error) {
 	c := &Client{
 		server:   server,
 		email:    email,
@@ -59,11 +69,18 @@ func NewClient(server, email, password string) (*Client, error) {
 		aToken:   &atomic.Value{},
 		validity: 10 * time.Minute,
 		closed:   make(chan struct{}, 1),
+		logger:   discard,
+		validate: true,
 	}
+	for _, option := range options {
+		option(c)
+	}
+	c.handler = chain(c.send, c.middleware...)
 	response, err := c.signIn()
 	if err != nil {
 		return nil, err
 	}
+	c.logger.Debug("Signed in to the Extend API", slog.String("email", email), slog.Any("response", response))
 	c.aToken.Store(response.Token)
 	go c.refreshToken(response.RefreshToken)
 	return c, nil
@@ -95,8 +112,10 @@ func (c *Client) refreshToken(token string) {
 		default:
 			response, err := c.renewAuth(token)
 			if err != nil {
+				c.logger.Warn("Failed to renew the Extend API token", slog.Any("error", err))
 				continue
 			}
+			c.logger.Debug("Renewed the Extend API token", slog.Any("response", response))
 			c.aToken.Swap(response.Token)
 			token = response.RefreshToken
 		}
@@ -105,16 +124,21 @@ func (c *Client) refreshToken(token string) {
 
 // Close the Client.
 func (c *Client) Close() {
-	_ = c.signOut()
+	if err := c.signOut(); err != nil {
+		c.logger.Warn("Failed to sign out of the Extend API", slog.Any("error", err))
+	}
 	c.closed <- struct{}{}
 }
 
 // signIn -> https://developer.paywithextend.com/#sign-in.
 func (c *Client) signIn() (*LoginSignUpResponse, error) {
 	return do[LoginRequest, LoginSignUpResponse](
-		c.client,
-		http.MethodPost,
-		c.server+"/signin",
+		c,
+		&Call{
+			Operation: "SignIn",
+			Method:    http.MethodPost,
+			URL:       c.server + "/signin",
+		},
 		unauthenticated,
 		&LoginRequest{Email: c.email, Password: c.password})
 }
@@ -122,9 +146,12 @@ func (c *Client) signIn() (*LoginSignUpResponse, error) {
 // renewAuth -> https://developer.paywithextend.com/#renew-auth.
 func (c *Client) renewAuth(token string) (*LoginSignUpResponse, error) {
 	return do[RefreshTokenLoginRequest, LoginSignUpResponse](
-		c.client,
-		http.MethodPost,
-		c.server+"/renewauth",
+		c,
+		&Call{
+			Operation: "RenewAuth",
+			Method:    http.MethodPost,
+			URL:       c.server + "/renewauth",
+		},
 		unauthenticated,
 		&RefreshTokenLoginRequest{RefreshToken: token})
 }
@@ -132,9 +159,12 @@ func (c *Client) renewAuth(token string) (*LoginSignUpResponse, error) {
 // signOut -> https://developer.paywithextend.com/#sign-out.
 func (c *Client) signOut() error {
 	_, err := do[LogoutRequest, any](
-		c.client,
-		http.MethodDelete,
-		c.server+"/signout",
+		c,
+		&Call{
+			Operation: "SignOut",
+			Method:    http.MethodDelete,
+			URL:       c.server + "/signout",
+		},
 		c.token(),
 		&LogoutRequest{})
 	return err
@@ -143,71 +173,150 @@ func (c *Client) signOut() error {
 // ForgotPassword -> https://developer.paywithextend.com/#forgot-password.
 func (c *Client) ForgotPassword(email string) (*Response, error) {
 	return do[ForgotPasswordRequest, Response](
-		c.client,
-		http.MethodPost,
-		c.server+"/forgot",
+		c,
+		&Call{
+			Operation: "ForgotPassword",
+			Method:    http.MethodPost,
+			URL:       c.server + "/forgot",
+		},
 		c.token(),
 		&ForgotPasswordRequest{Email: email})
 }
 
 // GetUserVirtualCards -> https://developer.paywithextend.com/#get-user-virtual-cards.
 func (c *Client) GetUserVirtualCards(request *VirtualCardPageableRequest) (*VirtualCardsResponse, error) {
-	return do[VirtualCardPageableRequest, VirtualCardsResponse](
-		c.client,
-		http.MethodGet,
-		c.server+"/virtualcards",
+	u, err := withQuery(c.server+"/virtualcards", request)
+	if err != nil {
+		return nil, err
+	}
+	return do[any, VirtualCardsResponse](
+		c,
+		&Call{
+			Operation: "GetUserVirtualCards",
+			Method:    http.MethodGet,
+			URL:       u,
+		},
 		c.token(),
-		request)
+		empty)
 }
 
 // GetVirtualCard -> https://developer.paywithextend.com/#get-virtual-card.
 func (c *Client) GetVirtualCard(id string) (*VirtualCardResponse, error) {
 	return do[any, VirtualCardResponse](
-		c.client,
-		http.MethodGet,
-		c.server+"/virtualcards/"+id,
+		c,
+		&Call{
+			Operation: "GetVirtualCard",
+			Method:    http.MethodGet,
+			URL:       c.server + "/virtualcards/" + id,
+			CardID:    id,
+		},
 		c.token(),
 		empty)
 }
 
 // GetVirtualCardTransactions -> https://developer.paywithextend.com/#get-virtual-card-transactions.
-func (c *Client) GetVirtualCardTransactions(id string, count int, before, after, status string) (*TransactionsResponse, error) {
-	v := url.Values{}
-	if count > 0 && count <= 500 {
-		v.Add("count", strconv.Itoa(count))
+//
+// A Count which isn't between 1 and 500 is omitted, so the default number of transactions is got.
+func (c *Client) GetVirtualCardTransactions(id string, request *VirtualCardTransactionsRequest) (*TransactionsResponse, error) {
+	if request != nil && (request.Count < 1 || request.Count > 500) {
+		clamped := *request
+		clamped.Count = 0
+		request = &clamped
 	}
-	if before != "" {
-		v.Add("before", before)
+	u, err := withQuery(c.server+"/virtualcards/"+id+"/transactions", request)
+	if err != nil {
+		return nil, err
 	}
-	if after != "" {
-		v.Add("after", after)
+	return do[any, TransactionsResponse](
+		c,
+		&Call{
+			Operation: "GetVirtualCardTransactions",
+			Method:    http.MethodGet,
+			URL:       u,
+			CardID:    id,
+		},
+		c.token(),
+		empty)
+}
+
+// CreateVirtualCard -> https://developer.paywithextend.com/#create-virtual-card.
+//
+// A ValidationError is returned, without sending the request, if the request is invalid.
+//
+// The creation is idempotent if the request has an IdempotencyKey, which is generated (and set on
+// the request, to reuse when retrying) if the Client is configured WithIdempotency. The key is sent
+// in the IdempotencyKeyHeader, and recorded in the Notes of the VirtualCard, so the VirtualCard
+// created by a previous attempt (e.g. which timed out) is found, and returned, rather than
+// creating a duplicate. See FindVirtualCardByIdempotencyKey.
+func (c *Client) CreateVirtualCard(request *CreateVirtualCardRequest) (*VirtualCardResponse, error) {
+	if c.validate && request != nil {
+		if err := request.Validate(); err != nil {
+			return nil, err
+		}
+	}
+	call := &Call{
+		Operation: "CreateVirtualCard",
+		Method:    http.MethodPost,
+		URL:       c.server + "/virtualcards",
 	}
-	if status != "" {
-		v.Add("status", status)
+	if request == nil || (request.IdempotencyKey == "" && !c.idempotent) {
+		return do[CreateVirtualCardRequest, VirtualCardResponse](c, call, c.token(), request)
 	}
-	u := c.server + "/virtualcards/" + id + "/transactions"
-	if len(v) > 0 {
-		u += "?" + v.Encode()
+	if request.IdempotencyKey == "" {
+		request.IdempotencyKey = NewIdempotencyKey()
+	} else {
+		if err := ValidateIdempotencyKey(request.IdempotencyKey); err != nil {
+			return nil, err
+		}
+		// the request may be a retry of a creation which succeeded
+		vc, err := FindVirtualCardByIdempotencyKey(c, request)
+		if err != nil {
+			return nil, err
+		}
+		if vc != nil {
+			c.logIdempotentCreation(request.IdempotencyKey, vc)
+			return &VirtualCardResponse{VirtualCard: *vc}, nil
+		}
 	}
-	return do[any, TransactionsResponse](c.client, http.MethodGet, u, c.token(), empty)
+	keyed := *request
+	keyed.Notes = NotesWithIdempotencyKey(request.Notes, request.IdempotencyKey)
+	call.Header = http.Header{IdempotencyKeyHeader: {request.IdempotencyKey}}
+	response, err := do[CreateVirtualCardRequest, VirtualCardResponse](c, call, c.token(), &keyed)
+	if err == nil && response.VirtualCard.ID != "" {
+		return response, nil
+	}
+	// the virtual card may have been created, even though the response wasn't received
+	vc, findErr := FindVirtualCardByIdempotencyKey(c, request)
+	if findErr == nil && vc != nil {
+		c.logIdempotentCreation(request.IdempotencyKey, vc)
+		return &VirtualCardResponse{VirtualCard: *vc}, nil
+	}
+	return response, err
 }
 
-// CreateVirtualCard -> https://developer.paywithextend.com/#create-virtual-card.
-func (c *Client) CreateVirtualCard(request *CreateVirtualCardRequest) (*VirtualCardResponse, error) {
-	return do[CreateVirtualCardRequest, VirtualCardResponse](
-		c.client,
-		http.MethodPost,
-		c.server+"/virtualcards",
-		c.token(),
-		request)
+// logIdempotentCreation logs the VirtualCard found, rather than created, for the idempotency key.
+func (c *Client) logIdempotentCreation(key string, vc *VirtualCard) {
+	c.logger.Debug(
+		"Found the virtual card created with the idempotency key",
+		slog.String("key", key),
+		slog.String("id", vc.ID))
 }
 
 // UpdateVirtualCard -> https://developer.paywithextend.com/#update-virtual-card.
 func (c *Client) UpdateVirtualCard(id string, request *UpdateVirtualCardRequest) (*VirtualCardResponse, error) {
+	if c.validate && request != nil {
+		if err := request.Validate(); err != nil {
+			return nil, err
+		}
+	}
 	return do[UpdateVirtualCardRequest, VirtualCardResponse](
-		c.client,
-		http.MethodPut,
-		c.server+"/virtualcards/"+id,
+		c,
+		&Call{
+			Operation: "UpdateVirtualCard",
+			Method:    http.MethodPut,
+			URL:       c.server + "/virtualcards/" + id,
+			CardID:    id,
+		},
 		c.token(),
 		request)
 }
@@ -215,9 +324,13 @@ func (c *Client) UpdateVirtualCard(id string, request *UpdateVirtualCardRequest)
 // CancelVirtualCard -> https://developer.paywithextend.com/#cancel-virtual-card.
 func (c *Client) CancelVirtualCard(id string) (*VirtualCardResponse, error) {
 	return do[any, VirtualCardResponse](
-		c.client,
-		http.MethodPut,
-		c.server+"/virtualcards/"+id+"/cancel",
+		c,
+		&Call{
+			Operation: "CancelVirtualCard",
+			Method:    http.MethodPut,
+			URL:       c.server + "/virtualcards/" + id + "/cancel",
+			CardID:    id,
+		},
 		c.token(),
 		empty)
 }
@@ -225,33 +338,54 @@ func (c *Client) CancelVirtualCard(id string) (*VirtualCardResponse, error) {
 // RejectVirtualCard -> https://developer.paywithextend.com/#reject-virtual-card.
 func (c *Client) RejectVirtualCard(id string) (*VirtualCardResponse, error) {
 	return do[any, VirtualCardResponse](
-		c.client,
-		http.MethodPut,
-		c.server+"/virtualcards/"+id+"/reject",
+		c,
+		&Call{
+			Operation: "RejectVirtualCard",
+			Method:    http.MethodPut,
+			URL:       c.server + "/virtualcards/" + id + "/reject",
+			CardID:    id,
+		},
 		c.token(),
 		empty)
 }
 
-// do an HTTP request with the method, url, token, and body, using the client.
-func do[rq any, rs any](client *http.Client, method, url, token string, in *rq) (*rs, error) {
-	var reader io.Reader
+// do the Call, an HTTP request with the token and body, using the Client.
+func do[rq any, rs any](c *Client, call *Call, token string, in *rq) (*rs, error) {
+	if call.Header == nil {
+		call.Header = http.Header{}
+	}
+	call.response = new(rs)
 	if in != nil {
-		data, err := json.Marshal(in)
+		call.Request = in
+	}
+	call.Header.Add("Content-Type", "application/json")
+	call.Header.Add("Accept", "application/vnd.paywithextend.v2021-03-12+json")
+	if token != unauthenticated {
+		call.Header.Add("Authorization", fmt.Sprintf("Bearer %s", token))
+	}
+	result, err := c.handler(withLogger(context.Background(), c.logger), call)
+	if err != nil {
+		return nil, err
+	}
+	return result.Response.(*rs), nil
+}
+
+// send the Call as an HTTP request using the Client.client.
+func (c *Client) send(ctx context.Context, call *Call) (*Result, error) {
+	var reader io.Reader
+	if call.Request != nil {
+		data, err := json.Marshal(call.Request)
 		if err != nil {
 			return nil, err
 		}
 		reader = bytes.NewReader(data)
 	}
-	request, err := http.NewRequest(method, url, reader)
+	request, err := http.NewRequestWithContext(ctx, call.Method, call.URL, reader)
 	if err != nil {
 		return nil, err
 	}
-	request.Header.Add("Content-Type", "application/json")
-	request.Header.Add("Accept", "application/vnd.paywithextend.v2021-03-12+json")
-	if token != unauthenticated {
-		request.Header.Add("Authorization", fmt.Sprintf("Bearer %s", token))
-	}
-	response, err := client.Do(request)
+	request.Header = call.Header.Clone()
+	response, err := c.client.Do(request)
 	if err != nil {
 		return nil, err
 	}
@@ -260,12 +394,22 @@ func do[rq any, rs any](client *http.Client, method, url, token string, in *rq)
 	if err != nil {
 		return nil, err
 	}
-	var out rs
+	result := &Result{
+		StatusCode: response.StatusCode,
+		Header:     response.Header,
+		Body:       data,
+		Response:   call.response,
+		Attempts:   1,
+	}
+	if response.StatusCode == http.StatusTooManyRequests {
+		result.RateLimits = 1
+	}
 	if len(data) > 0 {
-		err = json.Unmarshal(data, &out)
-		if err != nil {
-			return nil, err
+		// the Result is returned with the error, e.g. of a plain text 429 or 503 response, so the
+		// middleware can retry the Call, or observe the status
+		if err := json.Unmarshal(data, call.response); err != nil {
+			return result, fmt.Errorf("invalid %d response: %w", response.StatusCode, err)
 		}
 	}
-	return &out, err
+	return result, nil
 }
@@ -23,6 +23,7 @@ import (
 	"net/http/httptest"
 	"reflect"
 	"testing"
+	"time"
 )
 
 const (
@@ -108,8 +109,8 @@ func TestGetUserVirtualCards(t *testing.T) {
 	server := newTestServer(
 		t,
 		http.MethodGet,
-		"/virtualcards",
-		readTestdata(t, "virtual_card_pageable_request.json"),
+		"/virtualcards?cardholder=string&cardholderOrViewer=string&creditCardId=string&issued=true&pendingRequest=true&recipient=string&search=string&sortDirection=string&sortField=string&status=string&statuses=string&statuses=ACTIVE&withPermission=string",
+		"",
 		readTestdata(t, "virtual_cards_response.json"))
 	defer server.Close()
 
@@ -126,7 +127,7 @@ func TestGetUserVirtualCards(t *testing.T) {
 		CardholderOrViewer: "string",
 		CreditCardID:       "string",
 		Status:             "string",
-		Statuses:           []string{"string"},
+		Statuses:           []VirtualCardStatus{"string", VirtualCardStatusActive},
 		Issued:             true,
 		PendingRequest:     true,
 		Search:             "string",
@@ -168,7 +169,7 @@ func TestGetVirtualCardTransactions(t *testing.T) {
 	server := newTestServer(
 		t,
 		http.MethodGet,
-		"/virtualcards/"+testVirtualCardId+"/transactions?count=25&status=CLEARED",
+		"/virtualcards/"+testVirtualCardId+"/transactions?after=2020-01-01T01%3A01%3A12.123%2B0000&count=25&status=CLEARED%2CPENDING",
 		"",
 		readTestdata(t, "transactions_response.json"))
 	defer server.Close()
@@ -176,7 +177,11 @@ func TestGetVirtualCardTransactions(t *testing.T) {
 	client := newTestClient(t, server)
 	defer client.Close()
 
-	response, err := client.GetVirtualCardTransactions(testVirtualCardId, 25, "", "", "CLEARED")
+	response, err := client.GetVirtualCardTransactions(testVirtualCardId, &VirtualCardTransactionsRequest{
+		Count:    25,
+		After:    time.Date(2020, 1, 1, 1, 1, 12, 123000000, time.UTC),
+		Statuses: []TransactionStatus{TransactionStatusCleared, TransactionStatusPending},
+	})
 	if err != nil {
 		t.Errorf("Failed to get virtual card transactions: %v", err)
 	}
@@ -185,6 +190,29 @@ func TestGetVirtualCardTransactions(t *testing.T) {
 	}
 }
 
+func TestGetVirtualCardTransactionsCount(t *testing.T) {
+	server := newTestServer(
+		t,
+		http.MethodGet,
+		"/virtualcards/"+testVirtualCardId+"/transactions",
+		"",
+		readTestdata(t, "transactions_response.json"))
+	defer server.Close()
+
+	client := newTestClient(t, server)
+	defer client.Close()
+
+	for _, count := range []int{-1, 501, 1000} {
+		request := &VirtualCardTransactionsRequest{Count: count}
+		if _, err := client.GetVirtualCardTransactions(testVirtualCardId, request); err != nil {
+			t.Errorf("Failed to get virtual card transactions with count %d: %v", count, err)
+		}
+		if request.Count != count {
+			t.Errorf("Unexpected (mutated) request count: %d", request.Count)
+		}
+	}
+}
+
 func TestCreateVirtualCard(t *testing.T) {
 	server := newTestServer(
 		t,
@@ -24,8 +24,8 @@ type User struct {
 	PhoneIsoCountry   string            `json:"phoneIsoCountry"`
 	AvatarType        string            `json:"avatarType"`
 	AvatarURL         string            `json:"avatarUrl"`
-	CreatedAt         string            `json:"createdAt"`
-	UpdatedAt         string            `json:"updatedAt"`
+	CreatedAt         Timestamp         `json:"createdAt"`
+	UpdatedAt         Timestamp         `json:"updatedAt"`
 	Currency          string            `json:"currency"`
 	Locale            string            `json:"locale"`
 	Timezone          string            `json:"timezone"`
@@ -55,14 +55,14 @@ type Pagination struct {
 // VirtualCard -> https://developer.paywithextend.com/#tocS_VirtualCard.
 type VirtualCard struct {
 	ID                    string              `json:"id"`
-	Status                string              `json:"status"`
+	Status                VirtualCardStatus   `json:"status"`
 	RecipientID           string              `json:"recipientId"`
 	Recipient             User                `json:"recipient"`
 	CardholderID          string              `json:"cardholderId"`
 	Cardholder            User                `json:"cardholder"`
 	CardImage             CardImage           `json:"cardImage"`
 	DisplayName           string              `json:"displayName"`
-	Expires               string              `json:"expires"`
+	Expires               Timestamp           `json:"expires"`
 	Currency              string              `json:"currency"`
 	LimitCents            int                 `json:"limitCents"`
 	BalanceCents          int                 `json:"balanceCents"`
@@ -71,21 +71,21 @@ type VirtualCard struct {
 	AwaitingBudget        bool                `json:"awaitingBudget"`
 	Last4                 string              `json:"last4"`
 	NumberFormat          string              `json:"numberFormat"`
-	ValidFrom             string              `json:"validFrom"`
-	ValidTo               string              `json:"validTo"`
-	InactiveSince         string              `json:"inactiveSince"`
+	ValidFrom             Timestamp           `json:"validFrom"`
+	ValidTo               Timestamp           `json:"validTo"`
+	InactiveSince         Timestamp           `json:"inactiveSince"`
 	Timezone              string              `json:"timezone"`
 	CreditCardID          string              `json:"creditCardId"`
 	Recurs                bool                `json:"recurs"`
 	Recurrence            Recurrence          `json:"recurrence"`
 	Pending               VirtualCardRevision `json:"pending"`
 	Notes                 string              `json:"notes"`
-	CreatedAt             string              `json:"createdAt"`
-	UpdatedAt             string              `json:"updatedAt"`
+	CreatedAt             Timestamp           `json:"createdAt"`
+	UpdatedAt             Timestamp           `json:"updatedAt"`
 	Address               Address             `json:"address"`
 	Direct                bool                `json:"direct"`
 	Features              VirtualCardFeature  `json:"features"`
-	ActiveUntil           string              `json:"activeUntil"`
+	ActiveUntil           Timestamp           `json:"activeUntil"`
 	MinTransactionCents   int                 `json:"minTransactionCents"`
 	MaxTransactionCents   int                 `json:"maxTransactionCents"`
 	MaxTransactionCount   int                 `json:"maxTransactionCount"`
@@ -109,31 +109,31 @@ type CardImage struct {
 
 // Recurrence -> https://developer.paywithextend.com/#tocS_Recurrence.
 type Recurrence struct {
-	ID               string `json:"id"`
-	BalanceCents     int    `json:"balanceCents"`
-	Period           string `json:"period"`
-	Interval         int    `json:"interval"`
-	Terminator       string `json:"terminator"`
-	Count            int    `json:"count"`
-	Until            string `json:"until"`
-	ByWeekDay        int    `json:"byWeekDay"`
-	ByMonthDay       int    `json:"byMonthDay"`
-	ByYearDay        int    `json:"byYearDay"`
-	PrevRecurrenceAt string `json:"prevRecurrenceAt"`
-	NextRecurrenceAt string `json:"nextRecurrenceAt"`
-	CurrentCount     int    `json:"currentCount"`
-	RemainingCount   int    `json:"remainingCount"`
-	CreatedAt        string `json:"createdAt"`
-	UpdatedAt        string `json:"updatedAt"`
+	ID               string               `json:"id"`
+	BalanceCents     int                  `json:"balanceCents"`
+	Period           RecurrencePeriod     `json:"period"`
+	Interval         int                  `json:"interval"`
+	Terminator       RecurrenceTerminator `json:"terminator"`
+	Count            int                  `json:"count"`
+	Until            Timestamp            `json:"until"`
+	ByWeekDay        int                  `json:"byWeekDay"`
+	ByMonthDay       int                  `json:"byMonthDay"`
+	ByYearDay        int                  `json:"byYearDay"`
+	PrevRecurrenceAt Timestamp            `json:"prevRecurrenceAt"`
+	NextRecurrenceAt Timestamp            `json:"nextRecurrenceAt"`
+	CurrentCount     int                  `json:"currentCount"`
+	RemainingCount   int                  `json:"remainingCount"`
+	CreatedAt        Timestamp            `json:"createdAt"`
+	UpdatedAt        Timestamp            `json:"updatedAt"`
 }
 
 // VirtualCardRevision -> https://developer.paywithextend.com/#tocS_VirtualCardRevision.
 type VirtualCardRevision struct {
 	BalanceCents       int            `json:"balanceCents"`
-	ValidFrom          string         `json:"validFrom"`
-	ValidTo            string         `json:"validTo"`
+	ValidFrom          Timestamp      `json:"validFrom"`
+	ValidTo            Timestamp      `json:"validTo"`
 	Recurs             bool           `json:"recurs"`
-	ActiveUntil        string         `json:"activeUntil"`
+	ActiveUntil        Timestamp      `json:"activeUntil"`
 	Currency           string         `json:"currency"`
 	Recurrence         Recurrence     `json:"recurrence"`
 	ReceiptAttachments map[string]any `json:"receiptAttachments"`
@@ -168,53 +168,53 @@ type MccRange struct {
 
 // Transaction -> https://developer.paywithextend.com/#tocS_TransactionListItem.
 type Transaction struct {
-	ID                          string           `json:"id"`
-	CardholderID                string           `json:"cardholderId"`
-	CardholderName              string           `json:"cardholderName"`
-	CardholderEmail             string           `json:"cardholderEmail"`
-	RecipientName               string           `json:"recipientName"`
-	RecipientEmail              string           `json:"recipientEmail"`
-	RecipientID                 string           `json:"recipientId"`
-	NameOnCard                  string           `json:"nameOnCard"`
-	Source                      string           `json:"source"`
-	VcnLast4                    string           `json:"vcnLast4"`
-	VcnDisplayName              string           `json:"vcnDisplayName"`
-	VirtualCardID               string           `json:"virtualCardId"`
-	Type                        string           `json:"type"`
-	Status                      string           `json:"status"`
-	DeclineReasons              []DeclineReason  `json:"declineReasons"`
-	ApprovalCode                string           `json:"approvalCode"`
-	AuthBillingAmountCents      int              `json:"authBillingAmountCents"`
-	AuthBillingCurrency         string           `json:"authBillingCurrency"`
-	AuthMerchantAmountCents     int              `json:"authMerchantAmountCents"`
-	AuthMerchantCurrency        string           `json:"authMerchantCurrency"`
-	AuthExchangeRate            float64          `json:"authExchangeRate"`
-	ClearingBillingAmountCents  int              `json:"clearingBillingAmountCents"`
-	ClearingBillingCurrency     string           `json:"clearingBillingCurrency"`
-	ClearingMerchantAmountCents int              `json:"clearingMerchantAmountCents"`
-	ClearingMerchantCurrency    string           `json:"clearingMerchantCurrency"`
-	ClearingExchangeRate        float64          `json:"clearingExchangeRate"`
-	Mcc                         string           `json:"mcc"`
-	MccGroup                    string           `json:"mccGroup"`
-	MccDescription              string           `json:"mccDescription"`
-	MerchantID                  string           `json:"merchantId"`
-	MerchantName                string           `json:"merchantName"`
-	MerchantAddress             string           `json:"merchantAddress"`
-	MerchantCity                string           `json:"merchantCity"`
-	MerchantState               string           `json:"merchantState"`
-	MerchantCountry             string           `json:"merchantCountry"`
-	MerchantZip                 string           `json:"merchantZip"`
-	AuthedAt                    string           `json:"authedAt"`
-	ClearedAt                   string           `json:"clearedAt"`
-	UpdatedAt                   string           `json:"updatedAt"`
-	HasAttachments              bool             `json:"hasAttachments"`
-	ReferenceID                 string           `json:"referenceId"`
-	CreditCardID                string           `json:"creditCardId"`
-	SentToExpensify             bool             `json:"sentToExpensify"`
-	SentToQuickbooks            bool             `json:"sentToQuickbooks"`
-	AttachmentsCount            int              `json:"attachmentsCount"`
-	ReferenceFields             []ReferenceField `json:"referenceFields"`
-	CreditCardDisplayName       string           `json:"creditCardDisplayName"`
+	ID                          string            `json:"id"`
+	CardholderID                string            `json:"cardholderId"`
+	CardholderName              string            `json:"cardholderName"`
+	CardholderEmail             string            `json:"cardholderEmail"`
+	RecipientName               string            `json:"recipientName"`
+	RecipientEmail              string            `json:"recipientEmail"`
+	RecipientID                 string            `json:"recipientId"`
+	NameOnCard                  string            `json:"nameOnCard"`
+	Source                      string            `json:"source"`
+	VcnLast4                    string            `json:"vcnLast4"`
+	VcnDisplayName              string            `json:"vcnDisplayName"`
+	VirtualCardID               string            `json:"virtualCardId"`
+	Type                        TransactionType   `json:"type"`
+	Status                      TransactionStatus `json:"status"`
+	DeclineReasons              []DeclineReason   `json:"declineReasons"`
+	ApprovalCode                string            `json:"approvalCode"`
+	AuthBillingAmountCents      int               `json:"authBillingAmountCents"`
+	AuthBillingCurrency         string            `json:"authBillingCurrency"`
+	AuthMerchantAmountCents     int               `json:"authMerchantAmountCents"`
+	AuthMerchantCurrency        string            `json:"authMerchantCurrency"`
+	AuthExchangeRate            ExchangeRate      `json:"authExchangeRate"`
+	ClearingBillingAmountCents  int               `json:"clearingBillingAmountCents"`
+	ClearingBillingCurrency     string            `json:"clearingBillingCurrency"`
+	ClearingMerchantAmountCents int               `json:"clearingMerchantAmountCents"`
+	ClearingMerchantCurrency    string            `json:"clearingMerchantCurrency"`
+	ClearingExchangeRate        ExchangeRate      `json:"clearingExchangeRate"`
+	Mcc                         string            `json:"mcc"`
+	MccGroup                    string            `json:"mccGroup"`
+	MccDescription              string            `json:"mccDescription"`
+	MerchantID                  string            `json:"merchantId"`
+	MerchantName                string            `json:"merchantName"`
+	MerchantAddress             string            `json:"merchantAddress"`
+	MerchantCity                string            `json:"merchantCity"`
+	MerchantState               string            `json:"merchantState"`
+	MerchantCountry             string            `json:"merchantCountry"`
+	MerchantZip                 string            `json:"merchantZip"`
+	AuthedAt                    Timestamp         `json:"authedAt"`
+	ClearedAt                   Timestamp         `json:"clearedAt"`
+	UpdatedAt                   Timestamp         `json:"updatedAt"`
+	HasAttachments              bool              `json:"hasAttachments"`
+	ReferenceID                 string            `json:"referenceId"`
+	CreditCardID                string            `json:"creditCardId"`
+	SentToExpensify             bool              `json:"sentToExpensify"`
+	SentToQuickbooks            bool              `json:"sentToQuickbooks"`
+	AttachmentsCount            int               `json:"attachmentsCount"`
+	ReferenceFields             []ReferenceField  `json:"referenceFields"`
+	CreditCardDisplayName       string            `json:"creditCardDisplayName"`
 }
 
 // DeclineReason -> https://developer.paywithextend.com/#tocS_DeclineReason.
@@ -0,0 +1,276 @@
+// Copyright 2022 c-fraser
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"fmt"
+	"strings"
+)
+
+// The enums are string types, so values which are unknown to this package (e.g. values added to the
+// Extend API later) are preserved when (un)marshalled. Use IsKnown to validate a value, or the
+// Parse function of the enum to validate (case-insensitive) input.
+
+// VirtualCardStatus is the status of a VirtualCard.
+type VirtualCardStatus string
+
+const (
+	VirtualCardStatusPending   VirtualCardStatus = "PENDING"
+	VirtualCardStatusActive    VirtualCardStatus = "ACTIVE"
+	VirtualCardStatusCancelled VirtualCardStatus = "CANCELLED"
+	VirtualCardStatusRejected  VirtualCardStatus = "REJECTED"
+	VirtualCardStatusExpired   VirtualCardStatus = "EXPIRED"
+	VirtualCardStatusClosed    VirtualCardStatus = "CLOSED"
+	VirtualCardStatusConsumed  VirtualCardStatus = "CONSUMED"
+)
+
+// VirtualCardStatuses returns the known VirtualCardStatus values.
+func VirtualCardStatuses() []VirtualCardStatus {
+	return []VirtualCardStatus{
+		VirtualCardStatusPending,
+		VirtualCardStatusActive,
+		VirtualCardStatusCancelled,
+		VirtualCardStatusRejected,
+		VirtualCardStatusExpired,
+		VirtualCardStatusClosed,
+		VirtualCardStatusConsumed,
+	}
+}
+
+// IsKnown returns whether the VirtualCardStatus is a known value.
+func (s VirtualCardStatus) IsKnown() bool {
+	return known(s, VirtualCardStatuses())
+}
+
+// ParseVirtualCardStatus returns the known VirtualCardStatus of the text.
+func ParseVirtualCardStatus(text string) (VirtualCardStatus, error) {
+	return parse("virtual card status", text, VirtualCardStatuses())
+}
+
+// TransactionStatus is the status of a Transaction.
+type TransactionStatus string
+
+const (
+	TransactionStatusPending      TransactionStatus = "PENDING"
+	TransactionStatusCleared      TransactionStatus = "CLEARED"
+	TransactionStatusDeclined     TransactionStatus = "DECLINED"
+	TransactionStatusNoMatch      TransactionStatus = "NO_MATCH"
+	TransactionStatusAvsPass      TransactionStatus = "AVS_PASS"
+	TransactionStatusAvsFail      TransactionStatus = "AVS_FAIL"
+	TransactionStatusAuthReversal TransactionStatus = "AUTH_REVERSAL"
+)
+
+// TransactionStatuses returns the known TransactionStatus values.
+func TransactionStatuses() []TransactionStatus {
+	return []TransactionStatus{
+		TransactionStatusPending,
+		TransactionStatusCleared,
+		TransactionStatusDeclined,
+		TransactionStatusNoMatch,
+		TransactionStatusAvsPass,
+		TransactionStatusAvsFail,
+		TransactionStatusAuthReversal,
+	}
+}
+
+// IsKnown returns whether the TransactionStatus is a known value.
+func (s TransactionStatus) IsKnown() bool {
+	return known(s, TransactionStatuses())
+}
+
+// ParseTransactionStatus returns the known TransactionStatus of the text.
+func ParseTransactionStatus(text string) (TransactionStatus, error) {
+	return parse("transaction status", text, TransactionStatuses())
+}
+
+// TransactionType is the type of a Transaction.
+type TransactionType string
+
+const (
+	TransactionTypeDebit  TransactionType = "DEBIT"
+	TransactionTypeCredit TransactionType = "CREDIT"
+)
+
+// TransactionTypes returns the known TransactionType values.
+func TransactionTypes() []TransactionType {
+	return []TransactionType{TransactionTypeDebit, TransactionTypeCredit}
+}
+
+// IsKnown returns whether the TransactionType is a known value.
+func (t TransactionType) IsKnown() bool {
+	return known(t, TransactionTypes())
+}
+
+// ParseTransactionType returns the known TransactionType of the text.
+func ParseTransactionType(text string) (TransactionType, error) {
+	return parse("transaction type", text, TransactionTypes())
+}
+
+// RecurrencePeriod is the period of a Recurrence.
+type RecurrencePeriod string
+
+const (
+	RecurrencePeriodDaily   RecurrencePeriod = "DAILY"
+	RecurrencePeriodWeekly  RecurrencePeriod = "WEEKLY"
+	RecurrencePeriodMonthly RecurrencePeriod = "MONTHLY"
+	RecurrencePeriodYearly  RecurrencePeriod = "YEARLY"
+)
+
+// RecurrencePeriods returns the known RecurrencePeriod values.
+func RecurrencePeriods() []RecurrencePeriod {
+	return []RecurrencePeriod{
+		RecurrencePeriodDaily,
+		RecurrencePeriodWeekly,
+		RecurrencePeriodMonthly,
+		RecurrencePeriodYearly,
+	}
+}
+
+// IsKnown returns whether the RecurrencePeriod is a known value.
+func (p RecurrencePeriod) IsKnown() bool {
+	return known(p, RecurrencePeriods())
+}
+
+// ParseRecurrencePeriod returns the known RecurrencePeriod of the text.
+func ParseRecurrencePeriod(text string) (RecurrencePeriod, error) {
+	return parse("recurrence period", text, RecurrencePeriods())
+}
+
+// RecurrenceTerminator is the condition which ends a Recurrence.
+type RecurrenceTerminator string
+
+const (
+	// RecurrenceTerminatorNone is a Recurrence which never ends.
+	RecurrenceTerminatorNone RecurrenceTerminator = "NONE"
+	// RecurrenceTerminatorCount is a Recurrence which ends after Recurrence.Count recurrences.
+	RecurrenceTerminatorCount RecurrenceTerminator = "COUNT"
+	// RecurrenceTerminatorDate is a Recurrence which ends at Recurrence.Until.
+	RecurrenceTerminatorDate RecurrenceTerminator = "DATE"
+	// RecurrenceTerminatorCountOrDate is a Recurrence which ends after Recurrence.Count recurrences
+	// or at Recurrence.Until, whichever is first.
+	RecurrenceTerminatorCountOrDate RecurrenceTerminator = "COUNT_OR_DATE"
+)
+
+// RecurrenceTerminators returns the known RecurrenceTerminator values.
+func RecurrenceTerminators() []RecurrenceTerminator {
+	return []RecurrenceTerminator{
+		RecurrenceTerminatorNone,
+		RecurrenceTerminatorCount,
+		RecurrenceTerminatorDate,
+		RecurrenceTerminatorCountOrDate,
+	}
+}
+
+// IsKnown returns whether the RecurrenceTerminator is a known value.
+func (t RecurrenceTerminator) IsKnown() bool {
+	return known(t, RecurrenceTerminators())
+}
+
+// ParseRecurrenceTerminator returns the known RecurrenceTerminator of the text.
+func ParseRecurrenceTerminator(text string) (RecurrenceTerminator, error) {
+	return parse("recurrence terminator", text, RecurrenceTerminators())
+}
+
+// SortField is the VirtualCard field to sort a VirtualCardPageableRequest by.
+type SortField string
+
+const (
+	SortFieldActiveUntil   SortField = "activeUntil"
+	SortFieldBalanceCents  SortField = "balanceCents"
+	SortFieldCreatedAt     SortField = "createdAt"
+	SortFieldDisplayName   SortField = "displayName"
+	SortFieldExpires       SortField = "expires"
+	SortFieldRecipientName SortField = "recipientName"
+	SortFieldStatus        SortField = "status"
+	SortFieldUpdatedAt     SortField = "updatedAt"
+)
+
+// SortFields returns the known SortField values.
+func SortFields() []SortField {
+	return []SortField{
+		SortFieldActiveUntil,
+		SortFieldBalanceCents,
+		SortFieldCreatedAt,
+		SortFieldDisplayName,
+		SortFieldExpires,
+		SortFieldRecipientName,
+		SortFieldStatus,
+		SortFieldUpdatedAt,
+	}
+}
+
+// IsKnown returns whether the SortField is a known value.
+func (f SortField) IsKnown() bool {
+	return known(f, SortFields())
+}
+
+// ParseSortField returns the known SortField of the text.
+func ParseSortField(text string) (SortField, error) {
+	return parse("sort field", text, SortFields())
+}
+
+// SortDirection is the direction to sort a VirtualCardPageableRequest in.
+type SortDirection string
+
+const (
+	SortDirectionAscending  SortDirection = "ASC"
+	SortDirectionDescending SortDirection = "DESC"
+)
+
+// SortDirections returns the known SortDirection values.
+func SortDirections() []SortDirection {
+	return []SortDirection{SortDirectionAscending, SortDirectionDescending}
+}
+
+// IsKnown returns whether the SortDirection is a known value.
+func (d SortDirection) IsKnown() bool {
+	return known(d, SortDirections())
+}
+
+// ParseSortDirection returns the known SortDirection of the text.
+func ParseSortDirection(text string) (SortDirection, error) {
+	return parse("sort direction", text, SortDirections())
+}
+
+// known returns whether the value is one of the values.
+func known[E ~string](value E, values []E) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// parse returns the one of the values equal to the text, ignoring case, or an error describing the
+// enum (by name) and its values.
+func parse[E ~string](name, text string, values []E) (E, error) {
+	for _, v := range values {
+		if strings.EqualFold(string(v), text) {
+			return v, nil
+		}
+	}
+	var zero E
+	return zero, fmt.Errorf("unknown %s %q, expected one of %s", name, text, strings.Join(Names(values), ", "))
+}
+
+// Names returns the names of the enum values, e.g. of TransactionStatuses.
+func Names[E ~string](values []E) []string {
+	names := make([]string, len(values))
+	for i, v := range values {
+		names[i] = string(v)
+	}
+	return names
+}
@@ -0,0 +1,71 @@
+// Copyright 2022 c-fraser
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestParseEnum(t *testing.T) {
+	for text, expected := range map[string]TransactionStatus{
+		"CLEARED":       TransactionStatusCleared,
+		"pending":       TransactionStatusPending,
+		"Auth_Reversal": TransactionStatusAuthReversal,
+	} {
+		actual, err := ParseTransactionStatus(text)
+		if err != nil {
+			t.Errorf("Failed to parse %q: %v", text, err)
+		}
+		if actual != expected {
+			t.Errorf("Unexpected transaction status parsed from %q: %s", text, actual)
+		}
+	}
+	if s, err := ParseTransactionStatus("SETTLED"); err == nil {
+		t.Errorf("Unexpected transaction status parsed from %q: %s", "SETTLED", s)
+	}
+	if d, err := ParseSortDirection("desc"); err != nil || d != SortDirectionDescending {
+		t.Errorf("Unexpected sort direction parsed from %q: %s (%v)", "desc", d, err)
+	}
+	if !RecurrenceTerminatorCountOrDate.IsKnown() || RecurrencePeriod("HOURLY").IsKnown() {
+		t.Errorf("Unexpected known enum values")
+	}
+	if names := Names([]SortDirection{SortDirectionAscending, SortDirectionDescending}); strings.Join(names, ",") != "ASC,DESC" {
+		t.Errorf("Unexpected enum names: %v", names)
+	}
+}
+
+func TestEnumJSON(t *testing.T) {
+	var vc VirtualCard
+	if err := json.Unmarshal([]byte(`{"status":"FROZEN"}`), &vc); err != nil {
+		t.Errorf("Failed to unmarshal virtual card: %v", err)
+	}
+	if vc.Status.IsKnown() {
+		t.Errorf("Unexpected known virtual card status: %s", vc.Status)
+	}
+	b, err := json.Marshal(VirtualCardPageableRequest{Statuses: []VirtualCardStatus{VirtualCardStatusActive, vc.Status}})
+	if err != nil {
+		t.Errorf("Failed to marshal request: %v", err)
+	}
+	var request map[string]any
+	if err := json.Unmarshal(b, &request); err != nil {
+		t.Errorf("Failed to unmarshal request: %v", err)
+	}
+	statuses, _ := request["statuses"].([]any)
+	if len(statuses) != 2 || statuses[0] != "ACTIVE" || statuses[1] != "FROZEN" {
+		t.Errorf("Unexpected statuses: %v", request["statuses"])
+	}
+}
@@ -0,0 +1,102 @@
+// Copyright 2022 c-fraser
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"crypto/rand"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// IdempotencyKeyHeader is the HTTP header of the idempotency key of a CreateVirtualCardRequest.
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// idempotencyMarker is the format of the idempotency key in the Notes of a VirtualCard.
+const idempotencyMarker = "[idempotency-key: %s]"
+
+// idempotencyMarkerPattern matches the idempotencyMarker in the Notes of a VirtualCard.
+var idempotencyMarkerPattern = regexp.MustCompile(`\[idempotency-key: ([^\]\s]+)\]`)
+
+// idempotencyKeyPattern matches an idempotency key which the idempotencyMarkerPattern can match.
+var idempotencyKeyPattern = regexp.MustCompile(`^[^\]\s]+$`)
+
+// NewIdempotencyKey returns a random (version 4 UUID) idempotency key.
+func NewIdempotencyKey() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// ValidateIdempotencyKey returns an error if the idempotency key is empty, or contains whitespace
+// or ']', since such a key can't be found in the Notes of the VirtualCard, so retrying the creation
+// with it would create a duplicate.
+func ValidateIdempotencyKey(key string) error {
+	if !idempotencyKeyPattern.MatchString(key) {
+		return fmt.Errorf("invalid idempotency key %q, which must not be empty or contain whitespace or ']'", key)
+	}
+	return nil
+}
+
+// IdempotencyKeyOf returns the idempotency key in the notes of a VirtualCard, empty if there is
+// none.
+func IdempotencyKeyOf(notes string) string {
+	if m := idempotencyMarkerPattern.FindStringSubmatch(notes); m != nil {
+		return m[1]
+	}
+	return ""
+}
+
+// NotesWithIdempotencyKey returns the notes with the marker of the idempotency key, replacing any
+// existing marker, as recorded in the Notes of a VirtualCard created with the key.
+func NotesWithIdempotencyKey(notes, key string) string {
+	notes = strings.TrimSpace(idempotencyMarkerPattern.ReplaceAllString(notes, ""))
+	marker := fmt.Sprintf(idempotencyMarker, key)
+	if notes == "" {
+		return marker
+	}
+	return notes + " " + marker
+}
+
+// FindVirtualCardByIdempotencyKey returns the VirtualCard created by the request, per the
+// idempotency key in its Notes, nil if there is none.
+//
+// The Extend API lacks native idempotency, so the most recently created virtual cards of the
+// credit card, which match the display name of the request, are searched for the key.
+func FindVirtualCardByIdempotencyKey(lister VirtualCardLister, request *CreateVirtualCardRequest) (*VirtualCard, error) {
+	if request.IdempotencyKey == "" {
+		return nil, nil
+	}
+	response, err := lister.GetUserVirtualCards(&VirtualCardPageableRequest{
+		Count:         virtualCardsPageSize,
+		SortField:     SortFieldCreatedAt,
+		SortDirection: SortDirectionDescending,
+		CreditCardID:  request.CreditCardID,
+		Search:        request.DisplayName,
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, vc := range response.VirtualCards {
+		if IdempotencyKeyOf(vc.Notes) == request.IdempotencyKey {
+			return &vc, nil
+		}
+	}
+	return nil, nil
+}
@@ -0,0 +1,135 @@
+// Copyright 2022 c-fraser
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestIdempotencyKeyOf(t *testing.T) {
+	key := NewIdempotencyKey()
+	if len(key) != 36 || key == NewIdempotencyKey() {
+		t.Errorf("Unexpected idempotency key: %s", key)
+	}
+	notes := NotesWithIdempotencyKey("Vendor card", key)
+	if notes != "Vendor card [idempotency-key: "+key+"]" {
+		t.Errorf("Unexpected notes: %s", notes)
+	}
+	if k := IdempotencyKeyOf(notes); k != key {
+		t.Errorf("Unexpected idempotency key of notes: %s", k)
+	}
+	if notes := NotesWithIdempotencyKey(notes, "abc"); notes != "Vendor card [idempotency-key: abc]" {
+		t.Errorf("Unexpected notes: %s", notes)
+	}
+	if k := IdempotencyKeyOf("Vendor card"); k != "" {
+		t.Errorf("Unexpected idempotency key of notes: %s", k)
+	}
+	if err := ValidateIdempotencyKey(key); err != nil {
+		t.Errorf("Unexpected invalid idempotency key: %v", err)
+	}
+	for _, k := range []string{"", "vendor card", "vendor]", "vendor\t"} {
+		if err := ValidateIdempotencyKey(k); err == nil {
+			t.Errorf("Unexpected valid idempotency key: %q", k)
+		}
+	}
+}
+
+func TestCreateVirtualCardIdempotently(t *testing.T) {
+	var mu sync.Mutex
+	var cards []VirtualCard
+	creates := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch {
+		case r.URL.Path == "/signin":
+			_, _ = fmt.Fprintf(w, `{"token": "%s", "refreshToken": "%s"}`, testToken, testToken)
+		case r.URL.Path == "/virtualcards" && r.Method == http.MethodPost:
+			creates++
+			var request CreateVirtualCardRequest
+			if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+				t.Errorf("Failed to decode request: %v", err)
+			}
+			key := r.Header.Get(IdempotencyKeyHeader)
+			if key == "" || IdempotencyKeyOf(request.Notes) != key {
+				t.Errorf("Unexpected idempotency key: %s, notes: %s", key, request.Notes)
+			}
+			cards = append(cards, VirtualCard{ID: fmt.Sprintf("vc_%d", len(cards)+1), DisplayName: request.DisplayName, Notes: request.Notes})
+			// the card is created, but the response times out
+			mu.Unlock()
+			time.Sleep(200 * time.Millisecond)
+			mu.Lock()
+		case r.URL.Path == "/virtualcards" && r.Method == http.MethodGet:
+			if search := r.URL.Query().Get("search"); search != "Vendor" {
+				t.Errorf("Unexpected search: %s", search)
+			}
+			_ = json.NewEncoder(w).Encode(VirtualCardsResponse{VirtualCards: cards})
+		}
+	}))
+	defer server.Close()
+
+	c, err := NewClient(
+		server.URL,
+		testEmail,
+		testPassword,
+		WithHTTPClient(&http.Client{Timeout: 100 * time.Millisecond}),
+		WithIdempotency(true))
+	if err != nil {
+		t.Fatalf("Failed to initialize client: %v", err)
+	}
+	defer c.Close()
+
+	request := &CreateVirtualCardRequest{
+		CreditCardID: "cc_1234",
+		Recipient:    testEmail,
+		DisplayName:  "Vendor",
+		Notes:        "Vendor card",
+		BalanceCents: 100,
+	}
+	response, err := c.CreateVirtualCard(request)
+	if err != nil {
+		t.Fatalf("Failed to create virtual card: %v", err)
+	}
+	if response.VirtualCard.ID != "vc_1" || request.IdempotencyKey == "" {
+		t.Errorf("Unexpected virtual card: %v, key: %s", response.VirtualCard, request.IdempotencyKey)
+	}
+	if request.Notes != "Vendor card" {
+		t.Errorf("Unexpected (mutated) request notes: %s", request.Notes)
+	}
+
+	// retrying the request returns the virtual card, rather than creating a duplicate
+	response, err = c.CreateVirtualCard(request)
+	if err != nil {
+		t.Fatalf("Failed to retry virtual card creation: %v", err)
+	}
+
+	// a key which can't be found in the notes is rejected, rather than creating a duplicate
+	invalid := *request
+	invalid.IdempotencyKey = "vendor card]"
+	if _, err := c.CreateVirtualCard(&invalid); err == nil {
+		t.Error("Unexpected virtual card creation with an invalid idempotency key")
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if response.VirtualCard.ID != "vc_1" || creates != 1 {
+		t.Errorf("Unexpected virtual card: %v, creates: %d", response.VirtualCard, creates)
+	}
+}
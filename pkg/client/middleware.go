@@ -0,0 +1,244 @@
+// Copyright 2022 c-fraser
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Call is an Extend API operation made by the Client.
+type Call struct {
+	// Operation is the name of the Client method making the Call, e.g. "CreateVirtualCard".
+	Operation string
+	// Method is the HTTP method of the Call.
+	Method string
+	// URL is the URL of the Call.
+	URL string
+	// CardID is the ID of the virtual card the Call operates on, if any.
+	CardID string
+	// Header is the HTTP header sent with the Call.
+	Header http.Header
+	// Request is the (typed) request payload, e.g. *CreateVirtualCardRequest, or nil.
+	Request any
+	// response is the (typed) destination of the response payload.
+	response any
+}
+
+// Result is the outcome of a Call.
+type Result struct {
+	// StatusCode is the HTTP status code of the response.
+	StatusCode int
+	// Header is the HTTP header of the response.
+	Header http.Header
+	// Body is the raw response payload.
+	Body []byte
+	// Response is the (typed) response payload, e.g. *VirtualCardResponse.
+	Response any
+	// Attempts is the number of times the Call was sent.
+	Attempts int
+	// RateLimits is the number of times the Call was rate limited.
+	RateLimits int
+}
+
+// Handler makes a Call and returns the Result.
+type Handler func(ctx context.Context, call *Call) (*Result, error)
+
+// Middleware wraps a Handler to observe or modify each Call and Result, like an
+// http.RoundTripper that is aware of the operation and the (typed) payloads.
+type Middleware func(next Handler) Handler
+
+// chain the middleware around the handler, the first Middleware is the outermost.
+func chain(handler Handler, middleware ...Middleware) Handler {
+	for i := len(middleware) - 1; i >= 0; i-- {
+		handler = middleware[i](handler)
+	}
+	return handler
+}
+
+// Header returns a Middleware that sets the header key to value on each Call.
+func Header(key, value string) Middleware {
+	return Mutate(func(call *Call) {
+		call.Header.Set(key, value)
+	})
+}
+
+// Mutate returns a Middleware that invokes mutate with each Call before it is sent.
+func Mutate(mutate func(call *Call)) Middleware {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, call *Call) (*Result, error) {
+			mutate(call)
+			return next(ctx, call)
+		}
+	}
+}
+
+// Observer is invoked with each completed Call, the Result (if any), the error (if any), and the
+// elapsed duration.
+type Observer func(call *Call, result *Result, err error, elapsed time.Duration)
+
+// Observe returns a Middleware that invokes observe after each Call, for example to record metrics.
+func Observe(observe Observer) Middleware {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, call *Call) (*Result, error) {
+			start := time.Now()
+			result, err := next(ctx, call)
+			observe(call, result, err, time.Since(start))
+			return result, err
+		}
+	}
+}
+
+// Logging returns a Middleware that logs each Call to the logger.
+//
+// Failed Calls are logged at slog.LevelError, and others at slog.LevelInfo. If the logger is enabled
+// for slog.LevelDebug, then the (redacted) headers and payloads of each Call are logged too.
+func Logging(logger *slog.Logger) Middleware {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, call *Call) (*Result, error) {
+			debug := logger.Enabled(ctx, slog.LevelDebug)
+			if debug {
+				logger.LogAttrs(
+					ctx,
+					slog.LevelDebug,
+					"Sending Extend API request",
+					slog.String("operation", call.Operation),
+					slog.String("method", call.Method),
+					slog.String("url", call.URL),
+					slog.Any("header", RedactHeader(call.Header)),
+					slog.String("body", redactPayload(call.Request)))
+			}
+			start := time.Now()
+			result, err := next(ctx, call)
+			attributes := []slog.Attr{
+				slog.String("operation", call.Operation),
+				slog.String("method", call.Method),
+				slog.String("url", call.URL),
+				slog.Duration("elapsed", time.Since(start)),
+			}
+			if err != nil {
+				logger.LogAttrs(ctx, slog.LevelError, "Extend API request failed", append(attributes, slog.Any("error", err))...)
+				return result, err
+			}
+			attributes = append(attributes, slog.Int("status", result.StatusCode), slog.Int("attempts", result.Attempts))
+			level := slog.LevelInfo
+			if result.StatusCode >= http.StatusBadRequest {
+				level = slog.LevelError
+			}
+			logger.LogAttrs(ctx, level, "Received Extend API response", attributes...)
+			if debug {
+				logger.LogAttrs(
+					ctx,
+					slog.LevelDebug,
+					"Received Extend API response payload",
+					slog.String("operation", call.Operation),
+					slog.Any("header", RedactHeader(result.Header)),
+					slog.String("body", string(Redact(result.Body))))
+			}
+			return result, err
+		}
+	}
+}
+
+// redactPayload returns the (redacted) JSON of the request payload.
+func redactPayload(request any) string {
+	if request == nil {
+		return ""
+	}
+	data, err := json.Marshal(request)
+	if err != nil {
+		return Redacted
+	}
+	return string(Redact(data))
+}
+
+// Retry returns a Middleware that retries a Call up to attempts times, with exponential backoff
+// starting from delay, if it was rate limited or failed with a server error.
+//
+// Calls which aren't idempotent (POST) are only retried if rate limited, since the Extend API may
+// have processed a Call which failed otherwise.
+func Retry(attempts int, delay time.Duration) Middleware {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, call *Call) (*Result, error) {
+			var result *Result
+			var err error
+			var limits int
+			for attempt := 1; ; attempt++ {
+				result, err = next(ctx, call)
+				if result != nil {
+					limits += result.RateLimits
+					result.Attempts = attempt
+					result.RateLimits = limits
+				}
+				if attempt >= attempts || !retryable(call, result, err) {
+					return result, err
+				}
+				wait := delay << (attempt - 1)
+				if after := retryAfter(result); after > wait {
+					wait = after
+				}
+				loggerFrom(ctx).LogAttrs(
+					ctx,
+					slog.LevelWarn,
+					"Retrying Extend API request",
+					slog.String("operation", call.Operation),
+					slog.Int("attempt", attempt),
+					slog.Duration("wait", wait),
+					slog.Any("error", retryCause(result, err)))
+				select {
+				case <-ctx.Done():
+					return result, ctx.Err()
+				case <-time.After(wait):
+				}
+			}
+		}
+	}
+}
+
+// retryable returns whether the Call may be sent again given the Result or error.
+func retryable(call *Call, result *Result, err error) bool {
+	if result != nil && result.StatusCode == http.StatusTooManyRequests {
+		return true
+	}
+	if call.Method == http.MethodPost {
+		return false
+	}
+	return err != nil || (result != nil && result.StatusCode >= http.StatusInternalServerError)
+}
+
+// retryCause returns the error describing why the Call is retried.
+func retryCause(result *Result, err error) error {
+	if err != nil {
+		return err
+	}
+	return fmt.Errorf("unexpected status %d", result.StatusCode)
+}
+
+// retryAfter returns the duration of the 'Retry-After' header in the Result, if present.
+func retryAfter(result *Result) time.Duration {
+	if result == nil {
+		return 0
+	}
+	seconds, err := strconv.Atoi(result.Header.Get("Retry-After"))
+	if err != nil {
+		return 0
+	}
+	return time.Duration(seconds) * time.Second
+}
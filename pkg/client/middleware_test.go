@@ -0,0 +1,227 @@
+// Copyright 2022 c-fraser
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMiddlewareOrder(t *testing.T) {
+	server := newTestServer(
+		t,
+		http.MethodGet,
+		"/virtualcards/"+testVirtualCardId,
+		"",
+		readTestdata(t, "virtual_card_response.json"))
+	defer server.Close()
+
+	var mu sync.Mutex
+	var order []string
+	record := func(name string) Middleware {
+		return func(next Handler) Handler {
+			return func(ctx context.Context, call *Call) (*Result, error) {
+				mu.Lock()
+				order = append(order, name+":"+call.Operation)
+				mu.Unlock()
+				return next(ctx, call)
+			}
+		}
+	}
+	client, err := NewClient(server.URL, testEmail, testPassword, WithMiddleware(record("a"), record("b")))
+	if err != nil {
+		t.Fatalf("Failed to initialize client: %v", err)
+	}
+	defer client.Close()
+
+	_, err = client.GetVirtualCard(testVirtualCardId)
+	if err != nil {
+		t.Errorf("Failed to get virtual card: %v", err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	expected := []string{"a:SignIn", "b:SignIn", "a:GetVirtualCard", "b:GetVirtualCard"}
+	if !reflect.DeepEqual(order, expected) {
+		t.Errorf("Unexpected middleware order: %v", order)
+	}
+}
+
+func TestHeaderAndMutate(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/signin" {
+			_, _ = w.Write([]byte(`{"token": "` + testToken + `"}`))
+			return
+		}
+		if value := r.Header.Get("X-Test"); value != "test" {
+			t.Errorf("Unexpected 'X-Test' header: %s", value)
+		}
+		if r.URL.Path == "/forgot" && r.URL.Query().Get("mutated") != "true" {
+			t.Errorf("Unexpected URL: %s", r.URL)
+		}
+		_, _ = w.Write([]byte(readTestdata(t, "response.json")))
+	}))
+	defer server.Close()
+
+	client, err := NewClient(
+		server.URL,
+		testEmail,
+		testPassword,
+		WithMiddleware(
+			Header("X-Test", "test"),
+			Mutate(func(call *Call) {
+				if request, ok := call.Request.(*ForgotPasswordRequest); ok {
+					request.Email = strings.ToUpper(request.Email)
+					call.URL += "?mutated=true"
+				}
+			})))
+	if err != nil {
+		t.Fatalf("Failed to initialize client: %v", err)
+	}
+	defer client.Close()
+
+	response, err := client.ForgotPassword(testEmail)
+	if err != nil {
+		t.Errorf("Failed to reset password: %v", err)
+	}
+	if response.Msg != "ok" {
+		t.Errorf("Unexpected response message: %s", response.Msg)
+	}
+}
+
+func TestObserveAndLogging(t *testing.T) {
+	server := newTestServer(
+		t,
+		http.MethodGet,
+		"/virtualcards/"+testVirtualCardId,
+		"",
+		readTestdata(t, "virtual_card_response.json"))
+	defer server.Close()
+
+	var buffer bytes.Buffer
+	var observed *Result
+	client, err := NewClient(
+		server.URL,
+		testEmail,
+		testPassword,
+		WithMiddleware(
+			Logging(slog.New(slog.NewTextHandler(&buffer, &slog.HandlerOptions{Level: slog.LevelDebug}))),
+			Observe(func(call *Call, result *Result, err error, elapsed time.Duration) {
+				if call.Operation == "GetVirtualCard" {
+					observed = result
+				}
+			})))
+	if err != nil {
+		t.Fatalf("Failed to initialize client: %v", err)
+	}
+	defer client.Close()
+
+	_, err = client.GetVirtualCard(testVirtualCardId)
+	if err != nil {
+		t.Errorf("Failed to get virtual card: %v", err)
+	}
+	if observed == nil || observed.StatusCode != http.StatusOK {
+		t.Fatalf("Unexpected observed result: %v", observed)
+	}
+	if response, ok := observed.Response.(*VirtualCardResponse); !ok || response.VirtualCard.ID != testVirtualCardId {
+		t.Errorf("Unexpected observed response: %v", observed.Response)
+	}
+	output := buffer.String()
+	if !strings.Contains(output, "operation=GetVirtualCard method=GET") {
+		t.Errorf("Unexpected log output: %s", output)
+	}
+	if strings.Contains(output, testPassword) || strings.Contains(output, testToken) {
+		t.Errorf("Unredacted log output: %s", output)
+	}
+}
+
+func TestRetry(t *testing.T) {
+	var mu sync.Mutex
+	requests := map[string]int{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/signin" {
+			_, _ = w.Write([]byte(`{"token": "` + testToken + `"}`))
+			return
+		}
+		mu.Lock()
+		requests[r.Method]++
+		n := requests[r.Method]
+		mu.Unlock()
+		switch {
+		case r.Method == http.MethodPost && n == 1:
+			w.Header().Set("Content-Type", "text/plain")
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+			_, _ = w.Write([]byte("Too Many Requests"))
+			return
+		case n < 3:
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write([]byte(readTestdata(t, "virtual_card_response.json")))
+	}))
+	defer server.Close()
+
+	var attempts int
+	client, err := NewClient(
+		server.URL,
+		testEmail,
+		testPassword,
+		WithMiddleware(
+			Observe(func(call *Call, result *Result, err error, elapsed time.Duration) {
+				if result != nil && call.Operation == "GetVirtualCard" {
+					attempts = result.Attempts
+				}
+			}),
+			Retry(3, time.Millisecond)))
+	if err != nil {
+		t.Fatalf("Failed to initialize client: %v", err)
+	}
+	defer client.Close()
+
+	response, err := client.GetVirtualCard(testVirtualCardId)
+	if err != nil {
+		t.Errorf("Failed to get virtual card: %v", err)
+	}
+	if response.VirtualCard.ID != testVirtualCardId {
+		t.Errorf("Unexpected virtual card ID: %v", response.VirtualCard)
+	}
+	if attempts != 3 {
+		t.Errorf("Unexpected attempts: %d", attempts)
+	}
+
+	_, err = client.CreateVirtualCard(&CreateVirtualCardRequest{
+		CreditCardID: "cc_1234",
+		Recipient:    testEmail,
+		DisplayName:  "My Virtual Card",
+		BalanceCents: 400000,
+	})
+	if err != nil {
+		t.Errorf("Failed to create virtual card: %v", err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	// the plain text 429 is retried, but not the 503
+	if requests[http.MethodPost] != 2 {
+		t.Errorf("Unexpected create virtual card requests: %d", requests[http.MethodPost])
+	}
+}
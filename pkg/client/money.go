@@ -0,0 +1,397 @@
+// Copyright 2022 c-fraser
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// ErrCurrencyMismatch is returned by Money operations on amounts of different currencies.
+var ErrCurrencyMismatch = errors.New("currency mismatch")
+
+// Money is an amount of a currency, in the minor units of the currency (e.g. cents).
+//
+// The Extend API represents amounts as separate minor unit and currency fields (e.g.
+// VirtualCard.LimitCents and VirtualCard.Currency), so the models retain the wire format and expose
+// Money via accessors, e.g. VirtualCard.Limit.
+type Money struct {
+	// Amount is the number of minor units of the Currency.
+	Amount int64 `json:"amount"`
+	// Currency is the ISO 4217 currency code.
+	Currency string `json:"currency"`
+}
+
+// NewMoney returns the Money of the amount, in minor units, of the currency.
+func NewMoney(amount int64, currency string) Money {
+	return Money{Amount: amount, Currency: strings.ToUpper(currency)}
+}
+
+// ParseAmount returns the Money of the decimal amount, in major units (e.g. "12.34" or "1,234.56"),
+// of the currency.
+//
+// A grouping separator (comma) must precede 3 digits, so an amount with a decimal comma, e.g.
+// "12,34", is invalid rather than misread.
+func ParseAmount(amount, currency string) (Money, error) {
+	currency = strings.ToUpper(currency)
+	digits, ok := MinorUnits(currency)
+	if !ok {
+		return Money{}, fmt.Errorf("unknown currency %q", currency)
+	}
+	s := strings.TrimSpace(amount)
+	negative := strings.HasPrefix(s, "-")
+	if negative || strings.HasPrefix(s, "+") {
+		s = s[1:]
+	}
+	whole, fraction, _ := strings.Cut(s, ".")
+	groups := strings.Split(whole, ",")
+	for _, g := range groups[1:] {
+		if len(g) != 3 {
+			return Money{}, fmt.Errorf("invalid amount %q, which may have a decimal comma", amount)
+		}
+	}
+	whole = strings.Join(groups, "")
+	if whole+fraction == "" {
+		return Money{}, fmt.Errorf("invalid amount %q", amount)
+	}
+	if len(fraction) > digits {
+		return Money{}, fmt.Errorf("amount %q has more than %d decimal places for %s", amount, digits, currency)
+	}
+	if whole == "" {
+		whole = "0"
+	}
+	units, err := strconv.ParseInt(whole+fraction+strings.Repeat("0", digits-len(fraction)), 10, 64)
+	if err != nil || strings.ContainsAny(whole+fraction, "+-") {
+		return Money{}, fmt.Errorf("invalid amount %q", amount)
+	}
+	if negative {
+		units = -units
+	}
+	return Money{Amount: units, Currency: currency}, nil
+}
+
+// ParseMoney returns the Money of the text, a decimal amount and a currency code separated by a
+// space, in either order (e.g. "12.34 USD" or "USD 12.34").
+func ParseMoney(text string) (Money, error) {
+	fields := strings.Fields(text)
+	if len(fields) != 2 {
+		return Money{}, fmt.Errorf("invalid money %q", text)
+	}
+	if _, ok := MinorUnits(fields[0]); ok {
+		return ParseAmount(fields[1], fields[0])
+	}
+	return ParseAmount(fields[0], fields[1])
+}
+
+// Decimal returns the amount of the Money in major units, e.g. "12.34".
+func (m Money) Decimal() string {
+	digits, ok := MinorUnits(m.Currency)
+	if !ok {
+		digits = 2
+	}
+	amount := m.Amount
+	sign := ""
+	if amount < 0 {
+		sign = "-"
+		amount = -amount
+	}
+	s := strconv.FormatInt(amount, 10)
+	if digits == 0 {
+		return sign + s
+	}
+	if len(s) <= digits {
+		s = strings.Repeat("0", digits-len(s)+1) + s
+	}
+	return sign + s[:len(s)-digits] + "." + s[len(s)-digits:]
+}
+
+// String returns the decimal amount and currency of the Money, e.g. "12.34 USD".
+func (m Money) String() string {
+	return m.Decimal() + " " + m.Currency
+}
+
+// IsZero returns whether the Money amount is zero.
+func (m Money) IsZero() bool {
+	return m.Amount == 0
+}
+
+// IsNegative returns whether the Money amount is negative.
+func (m Money) IsNegative() bool {
+	return m.Amount < 0
+}
+
+// Neg returns the negation of the Money.
+func (m Money) Neg() Money {
+	return Money{Amount: -m.Amount, Currency: m.Currency}
+}
+
+// Mul returns the Money multiplied by n.
+func (m Money) Mul(n int64) Money {
+	return Money{Amount: m.Amount * n, Currency: m.Currency}
+}
+
+// Add returns the sum of the Money and o, or ErrCurrencyMismatch if their currencies differ.
+func (m Money) Add(o Money) (Money, error) {
+	if err := m.sameCurrency(o); err != nil {
+		return Money{}, err
+	}
+	return Money{Amount: m.Amount + o.Amount, Currency: m.Currency}, nil
+}
+
+// Sub returns the difference of the Money and o, or ErrCurrencyMismatch if their currencies differ.
+func (m Money) Sub(o Money) (Money, error) {
+	if err := m.sameCurrency(o); err != nil {
+		return Money{}, err
+	}
+	return Money{Amount: m.Amount - o.Amount, Currency: m.Currency}, nil
+}
+
+// Cmp compares the Money and o, returning -1, 0, or +1 if the Money is less than, equal to, or
+// greater than o, or ErrCurrencyMismatch if their currencies differ.
+func (m Money) Cmp(o Money) (int, error) {
+	if err := m.sameCurrency(o); err != nil {
+		return 0, err
+	}
+	switch {
+	case m.Amount < o.Amount:
+		return -1, nil
+	case m.Amount > o.Amount:
+		return 1, nil
+	default:
+		return 0, nil
+	}
+}
+
+// sameCurrency returns ErrCurrencyMismatch if the currencies of the Money and o differ.
+func (m Money) sameCurrency(o Money) error {
+	if !strings.EqualFold(m.Currency, o.Currency) {
+		return fmt.Errorf("%w: %s and %s", ErrCurrencyMismatch, m.Currency, o.Currency)
+	}
+	return nil
+}
+
+// ExchangeRate is a currency exchange rate, which retains the exact decimal representation of the
+// JSON number, unlike a float64.
+type ExchangeRate string
+
+// MarshalJSON implements json.Marshaler.
+func (r ExchangeRate) MarshalJSON() ([]byte, error) {
+	if r == "" {
+		return []byte("null"), nil
+	}
+	return []byte(r), nil
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (r *ExchangeRate) UnmarshalJSON(data []byte) error {
+	if bytes.Equal(data, []byte("null")) {
+		*r = ""
+		return nil
+	}
+	var n json.Number
+	if err := json.Unmarshal(data, &n); err != nil {
+		return fmt.Errorf("invalid exchange rate %s: %w", data, err)
+	}
+	*r = ExchangeRate(n)
+	return nil
+}
+
+// Rat returns the ExchangeRate as a big.Rat, or nil if the rate is absent or invalid.
+func (r ExchangeRate) Rat() *big.Rat {
+	rat, ok := new(big.Rat).SetString(string(r))
+	if !ok {
+		return nil
+	}
+	return rat
+}
+
+// Float64 returns the (approximate) ExchangeRate as a float64, or 0 if the rate is absent or
+// invalid.
+func (r ExchangeRate) Float64() float64 {
+	f, _ := strconv.ParseFloat(string(r), 64)
+	return f
+}
+
+// IsIdentity returns whether the ExchangeRate is absent or exactly 1, i.e. no currency exchange.
+func (r ExchangeRate) IsIdentity() bool {
+	rat := r.Rat()
+	return rat == nil || rat.Cmp(big.NewRat(1, 1)) == 0
+}
+
+// Convert returns the Money multiplied by the ExchangeRate, in the currency, rounded half away from
+// zero to the minor units of the currency.
+func (r ExchangeRate) Convert(m Money, currency string) (Money, error) {
+	rate := r.Rat()
+	if rate == nil {
+		return Money{}, fmt.Errorf("invalid exchange rate %q", string(r))
+	}
+	from, ok := MinorUnits(m.Currency)
+	if !ok {
+		return Money{}, fmt.Errorf("unknown currency %q", m.Currency)
+	}
+	currency = strings.ToUpper(currency)
+	to, ok := MinorUnits(currency)
+	if !ok {
+		return Money{}, fmt.Errorf("unknown currency %q", currency)
+	}
+	amount := new(big.Rat).Mul(new(big.Rat).SetInt64(m.Amount), rate)
+	amount.Mul(amount, new(big.Rat).SetFrac(pow10(to), pow10(from)))
+	return Money{Amount: round(amount), Currency: currency}, nil
+}
+
+// pow10 returns 10^n.
+func pow10(n int) *big.Int {
+	return new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(n)), nil)
+}
+
+// round returns the rat rounded half away from zero.
+func round(rat *big.Rat) int64 {
+	q, r := new(big.Int).QuoRem(rat.Num(), rat.Denom(), new(big.Int))
+	if new(big.Int).Mul(new(big.Int).Abs(r), big.NewInt(2)).Cmp(rat.Denom()) >= 0 {
+		if rat.Sign() < 0 {
+			q.Sub(q, big.NewInt(1))
+		} else {
+			q.Add(q, big.NewInt(1))
+		}
+	}
+	return q.Int64()
+}
+
+// MinorUnits returns the number of minor unit (decimal) digits of the ISO 4217 currency, and
+// whether the currency is known.
+func MinorUnits(currency string) (int, bool) {
+	digits, ok := currencies[strings.ToUpper(currency)]
+	return digits, ok
+}
+
+// currencies maps the active ISO 4217 currency codes to their number of minor unit digits.
+var currencies = map[string]int{
+	"AED": 2, "AFN": 2, "ALL": 2, "AMD": 2, "ANG": 2, "AOA": 2, "ARS": 2, "AUD": 2, "AWG": 2,
+	"AZN": 2, "BAM": 2, "BBD": 2, "BDT": 2, "BGN": 2, "BHD": 3, "BIF": 0, "BMD": 2, "BND": 2,
+	"BOB": 2, "BOV": 2, "BRL": 2, "BSD": 2, "BTN": 2, "BWP": 2, "BYN": 2, "BZD": 2, "CAD": 2,
+	"CDF": 2, "CHE": 2, "CHF": 2, "CHW": 2, "CLF": 4, "CLP": 0, "CNY": 2, "COP": 2, "COU": 2,
+	"CRC": 2, "CUP": 2, "CVE": 2, "CZK": 2, "DJF": 0, "DKK": 2, "DOP": 2, "DZD": 2, "EGP": 2,
+	"ERN": 2, "ETB": 2, "EUR": 2, "FJD": 2, "FKP": 2, "GBP": 2, "GEL": 2, "GHS": 2, "GIP": 2,
+	"GMD": 2, "GNF": 0, "GTQ": 2, "GYD": 2, "HKD": 2, "HNL": 2, "HTG": 2, "HUF": 2, "IDR": 2,
+	"ILS": 2, "INR": 2, "IQD": 3, "IRR": 2, "ISK": 0, "JMD": 2, "JOD": 3, "JPY": 0, "KES": 2,
+	"KGS": 2, "KHR": 2, "KMF": 0, "KPW": 2, "KRW": 0, "KWD": 3, "KYD": 2, "KZT": 2, "LAK": 2,
+	"LBP": 2, "LKR": 2, "LRD": 2, "LSL": 2, "LYD": 3, "MAD": 2, "MDL": 2, "MGA": 2, "MKD": 2,
+	"MMK": 2, "MNT": 2, "MOP": 2, "MRU": 2, "MUR": 2, "MVR": 2, "MWK": 2, "MXN": 2, "MXV": 2,
+	"MYR": 2, "MZN": 2, "NAD": 2, "NGN": 2, "NIO": 2, "NOK": 2, "NPR": 2, "NZD": 2, "OMR": 3,
+	"PAB": 2, "PEN": 2, "PGK": 2, "PHP": 2, "PKR": 2, "PLN": 2, "PYG": 0, "QAR": 2, "RON": 2,
+	"RSD": 2, "RUB": 2, "RWF": 0, "SAR": 2, "SBD": 2, "SCR": 2, "SDG": 2, "SEK": 2, "SGD": 2,
+	"SHP": 2, "SLE": 2, "SOS": 2, "SRD": 2, "SSP": 2, "STN": 2, "SVC": 2, "SYP": 2, "SZL": 2,
+	"THB": 2, "TJS": 2, "TMT": 2, "TND": 3, "TOP": 2, "TRY": 2, "TTD": 2, "TWD": 2, "TZS": 2,
+	"UAH": 2, "UGX": 0, "USD": 2, "USN": 2, "UYI": 0, "UYU": 2, "UYW": 4, "UZS": 2, "VED": 2,
+	"VES": 2, "VND": 0, "VUV": 0, "WST": 2, "XAF": 0, "XCD": 2, "XOF": 0, "XPF": 0, "YER": 2,
+	"ZAR": 2, "ZMW": 2, "ZWG": 2,
+}
+
+// Limit returns the VirtualCard.LimitCents as Money.
+func (vc VirtualCard) Limit() Money {
+	return NewMoney(int64(vc.LimitCents), vc.Currency)
+}
+
+// Balance returns the VirtualCard.BalanceCents as Money.
+func (vc VirtualCard) Balance() Money {
+	return NewMoney(int64(vc.BalanceCents), vc.Currency)
+}
+
+// Spent returns the VirtualCard.SpentCents as Money.
+func (vc VirtualCard) Spent() Money {
+	return NewMoney(int64(vc.SpentCents), vc.Currency)
+}
+
+// LifetimeSpent returns the VirtualCard.LifetimeSpentCents as Money.
+func (vc VirtualCard) LifetimeSpent() Money {
+	return NewMoney(int64(vc.LifetimeSpentCents), vc.Currency)
+}
+
+// MinTransaction returns the VirtualCard.MinTransactionCents as Money.
+func (vc VirtualCard) MinTransaction() Money {
+	return NewMoney(int64(vc.MinTransactionCents), vc.Currency)
+}
+
+// MaxTransaction returns the VirtualCard.MaxTransactionCents as Money.
+func (vc VirtualCard) MaxTransaction() Money {
+	return NewMoney(int64(vc.MaxTransactionCents), vc.Currency)
+}
+
+// RecurrenceBalance returns the VirtualCard.Recurrence balance as Money.
+func (vc VirtualCard) RecurrenceBalance() Money {
+	return NewMoney(int64(vc.Recurrence.BalanceCents), vc.Currency)
+}
+
+// Balance returns the VirtualCardRevision.BalanceCents as Money.
+func (r VirtualCardRevision) Balance() Money {
+	return NewMoney(int64(r.BalanceCents), r.Currency)
+}
+
+// AuthBillingAmount returns the Transaction.AuthBillingAmountCents as Money.
+func (t Transaction) AuthBillingAmount() Money {
+	return NewMoney(int64(t.AuthBillingAmountCents), t.AuthBillingCurrency)
+}
+
+// AuthMerchantAmount returns the Transaction.AuthMerchantAmountCents as Money.
+func (t Transaction) AuthMerchantAmount() Money {
+	return NewMoney(int64(t.AuthMerchantAmountCents), t.AuthMerchantCurrency)
+}
+
+// ClearingBillingAmount returns the Transaction.ClearingBillingAmountCents as Money.
+func (t Transaction) ClearingBillingAmount() Money {
+	return NewMoney(int64(t.ClearingBillingAmountCents), t.ClearingBillingCurrency)
+}
+
+// ClearingMerchantAmount returns the Transaction.ClearingMerchantAmountCents as Money.
+func (t Transaction) ClearingMerchantAmount() Money {
+	return NewMoney(int64(t.ClearingMerchantAmountCents), t.ClearingMerchantCurrency)
+}
+
+// Balance returns the CreateVirtualCardRequest.BalanceCents as Money.
+func (r CreateVirtualCardRequest) Balance() Money {
+	return NewMoney(int64(r.BalanceCents), r.Currency)
+}
+
+// SetBalance sets the CreateVirtualCardRequest.BalanceCents and CreateVirtualCardRequest.Currency
+// to the Money.
+func (r *CreateVirtualCardRequest) SetBalance(m Money) {
+	r.BalanceCents = int(m.Amount)
+	r.Currency = m.Currency
+}
+
+// Balance returns the UpdateVirtualCardRequest.BalanceCents as Money, which is zero if the
+// balance is unset.
+func (r UpdateVirtualCardRequest) Balance() Money {
+	var m Money
+	if r.BalanceCents != nil {
+		m.Amount = int64(*r.BalanceCents)
+	}
+	if r.Currency != nil {
+		m.Currency = *r.Currency
+	}
+	return NewMoney(m.Amount, m.Currency)
+}
+
+// SetBalance sets the UpdateVirtualCardRequest.BalanceCents and UpdateVirtualCardRequest.Currency
+// to the Money.
+func (r *UpdateVirtualCardRequest) SetBalance(m Money) {
+	r.BalanceCents = Ptr(int(m.Amount))
+	r.Currency = Ptr(m.Currency)
+}
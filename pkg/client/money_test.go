@@ -0,0 +1,125 @@
+// Copyright 2022 c-fraser
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestParseMoney(t *testing.T) {
+	for text, expected := range map[string]Money{
+		"12.34 USD":    {Amount: 1234, Currency: "USD"},
+		"USD 12.3":     {Amount: 1230, Currency: "USD"},
+		"-0.05 usd":    {Amount: -5, Currency: "USD"},
+		"1,234 JPY":    {Amount: 1234, Currency: "JPY"},
+		"1,234.56 USD": {Amount: 123456, Currency: "USD"},
+		"1.234 KWD":    {Amount: 1234, Currency: "KWD"},
+		"4000.00 EUR":  {Amount: 400000, Currency: "EUR"},
+	} {
+		actual, err := ParseMoney(text)
+		if err != nil {
+			t.Errorf("Failed to parse %q: %v", text, err)
+		}
+		if actual != expected {
+			t.Errorf("Unexpected money parsed from %q: %v", text, actual)
+		}
+	}
+	for _, text := range []string{"12.345 USD", "1.5 JPY", "12.34 XYZ", "12.34", "1-2 USD", "--1 USD", "12,34 USD", "1,23,456.00 USD"} {
+		if m, err := ParseMoney(text); err == nil {
+			t.Errorf("Unexpected money parsed from %q: %v", text, m)
+		}
+	}
+	for _, amount := range []string{"", " ", ".", "-", "+", "-.", ",", "12,34", "1,2345", "1.2,3"} {
+		if m, err := ParseAmount(amount, "USD"); err == nil {
+			t.Errorf("Unexpected money parsed from %q: %v", amount, m)
+		}
+	}
+}
+
+func TestMoneyString(t *testing.T) {
+	for expected, m := range map[string]Money{
+		"12.34 USD":    NewMoney(1234, "usd"),
+		"0.05 USD":     NewMoney(5, "USD"),
+		"-4000.00 USD": NewMoney(-400000, "USD"),
+		"1234 JPY":     NewMoney(1234, "JPY"),
+		"1.234 KWD":    NewMoney(1234, "KWD"),
+		"0.0001 CLF":   NewMoney(1, "CLF"),
+	} {
+		if actual := m.String(); actual != expected {
+			t.Errorf("Unexpected string of %#v: %s", m, actual)
+		}
+	}
+}
+
+func TestMoneyArithmetic(t *testing.T) {
+	usd, eur := NewMoney(1000, "USD"), NewMoney(1000, "EUR")
+	sum, err := usd.Add(NewMoney(234, "USD"))
+	if err != nil || sum != NewMoney(1234, "USD") {
+		t.Errorf("Unexpected sum: %v, %v", sum, err)
+	}
+	difference, err := usd.Sub(NewMoney(1234, "USD"))
+	if err != nil || difference != NewMoney(-234, "USD") || !difference.IsNegative() {
+		t.Errorf("Unexpected difference: %v, %v", difference, err)
+	}
+	if _, err = usd.Add(eur); !errors.Is(err, ErrCurrencyMismatch) {
+		t.Errorf("Unexpected error adding mixed currencies: %v", err)
+	}
+	if _, err = usd.Sub(eur); !errors.Is(err, ErrCurrencyMismatch) {
+		t.Errorf("Unexpected error subtracting mixed currencies: %v", err)
+	}
+	if _, err = usd.Cmp(eur); !errors.Is(err, ErrCurrencyMismatch) {
+		t.Errorf("Unexpected error comparing mixed currencies: %v", err)
+	}
+	if cmp, err := usd.Cmp(sum); err != nil || cmp != -1 {
+		t.Errorf("Unexpected comparison: %d, %v", cmp, err)
+	}
+}
+
+func TestExchangeRate(t *testing.T) {
+	var tx Transaction
+	err := json.Unmarshal([]byte(readTestdata(t, "transactions_response.json")), &struct {
+		Transactions []*Transaction `json:"transactions"`
+	}{Transactions: []*Transaction{&tx}})
+	if err != nil {
+		t.Fatalf("Failed to unmarshal transactions: %v", err)
+	}
+	if tx.AuthExchangeRate != "1.2345" || tx.AuthExchangeRate.IsIdentity() {
+		t.Errorf("Unexpected exchange rate: %s", tx.AuthExchangeRate)
+	}
+	data, err := json.Marshal(tx)
+	if err != nil {
+		t.Fatalf("Failed to marshal transaction: %v", err)
+	}
+	var raw map[string]json.RawMessage
+	if err = json.Unmarshal(data, &raw); err != nil || string(raw["authExchangeRate"]) != "1.2345" {
+		t.Errorf("Unexpected exchange rate JSON: %s", raw["authExchangeRate"])
+	}
+	if amount := tx.AuthBillingAmount(); amount != NewMoney(400000, "USD") {
+		t.Errorf("Unexpected auth billing amount: %v", amount)
+	}
+	converted, err := ExchangeRate("150.5").Convert(NewMoney(1099, "USD"), "JPY")
+	if err != nil || converted != NewMoney(1654, "JPY") {
+		t.Errorf("Unexpected conversion: %v, %v", converted, err)
+	}
+	converted, err = ExchangeRate("0.0066").Convert(NewMoney(-1654, "JPY"), "USD")
+	if err != nil || converted != NewMoney(-1092, "USD") {
+		t.Errorf("Unexpected conversion: %v, %v", converted, err)
+	}
+	if !ExchangeRate("1.000").IsIdentity() || !ExchangeRate("").IsIdentity() {
+		t.Errorf("Unexpected non-identity exchange rate")
+	}
+}
@@ -0,0 +1,63 @@
+// Copyright 2022 c-fraser
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"log/slog"
+	"net/http"
+)
+
+// Option configures a Client.
+type Option func(c *Client)
+
+// WithHTTPClient configures the Client to make HTTP requests using the client.
+func WithHTTPClient(client *http.Client) Option {
+	return func(c *Client) {
+		c.client = client
+	}
+}
+
+// WithMiddleware configures the Client to make each Call through the middleware, in order.
+func WithMiddleware(middleware ...Middleware) Option {
+	return func(c *Client) {
+		c.middleware = append(c.middleware, middleware...)
+	}
+}
+
+// WithLogger configures the Client to log authentication (token retrieval and renewal) events, and
+// retries, to the logger.
+//
+// Use the Logging Middleware to log each Call.
+func WithLogger(logger *slog.Logger) Option {
+	return func(c *Client) {
+		c.logger = logger
+	}
+}
+
+// WithValidation configures whether the Client validates the CreateVirtualCardRequest and
+// UpdateVirtualCardRequest before sending it, which is enabled by default.
+func WithValidation(enabled bool) Option {
+	return func(c *Client) {
+		c.validate = enabled
+	}
+}
+
+// WithIdempotency configures whether the Client generates an idempotency key for each
+// CreateVirtualCardRequest without one, which is disabled by default.
+func WithIdempotency(enabled bool) Option {
+	return func(c *Client) {
+		c.idempotent = enabled
+	}
+}
@@ -0,0 +1,104 @@
+// Copyright 2022 c-fraser
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import "time"
+
+// VirtualCardLister gets the pages of the virtual cards of the user, e.g. the Client.
+type VirtualCardLister interface {
+	GetUserVirtualCards(request *VirtualCardPageableRequest) (*VirtualCardsResponse, error)
+}
+
+// TransactionLister gets the transactions of a virtual card, e.g. the Client.
+type TransactionLister interface {
+	GetVirtualCardTransactions(id string, request *VirtualCardTransactionsRequest) (*TransactionsResponse, error)
+}
+
+// The default number of virtual cards, or transactions, got per request.
+const (
+	virtualCardsPageSize = 100
+	transactionsPageSize = 500
+)
+
+// AllVirtualCards returns every VirtualCard matching the request, by getting each page of the
+// virtual cards. The Page of the request is ignored, and the Count defaults to 100.
+func AllVirtualCards(lister VirtualCardLister, request VirtualCardPageableRequest) ([]VirtualCard, error) {
+	if request.Count <= 0 {
+		request.Count = virtualCardsPageSize
+	}
+	var cards []VirtualCard
+	for request.Page = 0; ; request.Page++ {
+		response, err := lister.GetUserVirtualCards(&request)
+		if err != nil {
+			return nil, err
+		}
+		cards = append(cards, response.VirtualCards...)
+		if len(response.VirtualCards) == 0 || request.Page+1 >= response.Pagination.NumberOfPages {
+			return cards, nil
+		}
+	}
+}
+
+// AllVirtualCardTransactions returns every Transaction of the virtual card matching the request
+// (see EachVirtualCardTransaction).
+func AllVirtualCardTransactions(lister TransactionLister, id string, request VirtualCardTransactionsRequest) ([]Transaction, error) {
+	var transactions []Transaction
+	err := EachVirtualCardTransaction(lister, id, request, func(tx Transaction) error {
+		transactions = append(transactions, tx)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return transactions, nil
+}
+
+// EachVirtualCardTransaction calls the function with each Transaction of the virtual card matching
+// the request, page by page, stopping at the first error.
+//
+// The transactions aren't paginated, so while a full page (of request.Count, which defaults to the
+// maximum of 500, transactions) is returned, the next page is the transactions before (and at) the
+// earliest Transaction.AuthedAt of the page. The transactions are deduplicated by ID.
+func EachVirtualCardTransaction(lister TransactionLister, id string, request VirtualCardTransactionsRequest, f func(tx Transaction) error) error {
+	if request.Count <= 0 {
+		request.Count = transactionsPageSize
+	}
+	seen := make(map[string]bool)
+	for {
+		response, err := lister.GetVirtualCardTransactions(id, &request)
+		if err != nil {
+			return err
+		}
+		var earliest Timestamp
+		added := 0
+		for _, tx := range response.Transactions {
+			if earliest.IsZero() || (!tx.AuthedAt.IsZero() && tx.AuthedAt.Before(earliest.Time)) {
+				earliest = tx.AuthedAt
+			}
+			if seen[tx.ID] {
+				continue
+			}
+			seen[tx.ID] = true
+			if err := f(tx); err != nil {
+				return err
+			}
+			added++
+		}
+		if len(response.Transactions) < request.Count || added == 0 || earliest.IsZero() {
+			return nil
+		}
+		request.Before = earliest.Add(time.Millisecond)
+	}
+}
@@ -0,0 +1,75 @@
+// Copyright 2022 c-fraser
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+type virtualCardLister []VirtualCard
+
+func (l virtualCardLister) GetUserVirtualCards(request *VirtualCardPageableRequest) (*VirtualCardsResponse, error) {
+	pages := (len(l) + request.Count - 1) / request.Count
+	start := min(request.Page*request.Count, len(l))
+	end := min(start+request.Count, len(l))
+	return &VirtualCardsResponse{Pagination: Pagination{Page: request.Page, NumberOfPages: pages}, VirtualCards: l[start:end]}, nil
+}
+
+type transactionLister []Transaction
+
+func (l transactionLister) GetVirtualCardTransactions(_ string, request *VirtualCardTransactionsRequest) (*TransactionsResponse, error) {
+	var response TransactionsResponse
+	for _, tx := range l {
+		if len(response.Transactions) < request.Count && (request.Before.IsZero() || tx.AuthedAt.Before(request.Before)) {
+			response.Transactions = append(response.Transactions, tx)
+		}
+	}
+	return &response, nil
+}
+
+func TestAllVirtualCards(t *testing.T) {
+	var lister virtualCardLister
+	for i := 0; i < 5; i++ {
+		lister = append(lister, VirtualCard{ID: fmt.Sprintf("vc_%d", i)})
+	}
+	cards, err := AllVirtualCards(lister, VirtualCardPageableRequest{Count: 2})
+	if err != nil {
+		t.Errorf("Failed to get virtual cards: %v", err)
+	}
+	if len(cards) != 5 || cards[4].ID != "vc_4" {
+		t.Errorf("Unexpected virtual cards: %v", cards)
+	}
+}
+
+func TestAllVirtualCardTransactions(t *testing.T) {
+	now := time.Now()
+	var lister transactionLister
+	for i := 0; i < 7; i++ {
+		// Newest first, with two transactions at the same time.
+		lister = append(lister, Transaction{
+			ID:       fmt.Sprintf("tx_%d", i),
+			AuthedAt: NewTimestamp(now.Add(-time.Duration(i/2*2) * time.Hour)),
+		})
+	}
+	transactions, err := AllVirtualCardTransactions(lister, testVirtualCardId, VirtualCardTransactionsRequest{Count: 3})
+	if err != nil {
+		t.Errorf("Failed to get virtual card transactions: %v", err)
+	}
+	if len(transactions) != 7 {
+		t.Errorf("Unexpected virtual card transactions: %v", transactions)
+	}
+}
@@ -0,0 +1,135 @@
+// Copyright 2022 c-fraser
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"fmt"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// encodeQuery encodes the fields of the struct (pointer) as URL query parameters, per the `query`
+// struct tags of the fields, e.g. `query:"status,omitempty,comma"`.
+//
+// The tag options are:
+//   - omitempty, which omits the parameter if the field is the zero value (or an empty slice)
+//   - comma, which encodes a slice as one comma-delimited parameter, rather than a repeated
+//     parameter
+//
+// Fields without a tag (or tagged "-") and nil pointers are omitted. The supported field types are
+// strings, integers, booleans, time.Time and Timestamp (formatted per the TimestampLayout), and
+// slices of those.
+func encodeQuery(v any) (url.Values, error) {
+	values := url.Values{}
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Pointer {
+		if rv.IsNil() {
+			return values, nil
+		}
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("failed to encode %T as query parameters", v)
+	}
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		tag := rt.Field(i).Tag.Get("query")
+		if tag == "" || tag == "-" {
+			continue
+		}
+		name, options, _ := strings.Cut(tag, ",")
+		omitEmpty := strings.Contains(","+options+",", ",omitempty,")
+		comma := strings.Contains(","+options+",", ",comma,")
+		field := rv.Field(i)
+		if field.Kind() == reflect.Pointer {
+			if field.IsNil() {
+				continue
+			}
+			field = field.Elem()
+		}
+		if omitEmpty && isEmptyQueryValue(field) {
+			continue
+		}
+		if field.Kind() != reflect.Slice {
+			s, err := formatQueryValue(field)
+			if err != nil {
+				return nil, fmt.Errorf("failed to encode query parameter %q: %w", name, err)
+			}
+			values.Add(name, s)
+			continue
+		}
+		elements := make([]string, field.Len())
+		for j := range elements {
+			s, err := formatQueryValue(field.Index(j))
+			if err != nil {
+				return nil, fmt.Errorf("failed to encode query parameter %q: %w", name, err)
+			}
+			elements[j] = s
+		}
+		if comma {
+			values.Add(name, strings.Join(elements, ","))
+			continue
+		}
+		for _, s := range elements {
+			values.Add(name, s)
+		}
+	}
+	return values, nil
+}
+
+// isEmptyQueryValue returns whether the field is the zero value, or an empty slice.
+func isEmptyQueryValue(v reflect.Value) bool {
+	if z, ok := v.Interface().(interface{ IsZero() bool }); ok {
+		return z.IsZero()
+	}
+	return v.IsZero() || (v.Kind() == reflect.Slice && v.Len() == 0)
+}
+
+// formatQueryValue returns the query parameter value of the (non-slice) field.
+func formatQueryValue(v reflect.Value) (string, error) {
+	switch t := v.Interface().(type) {
+	case time.Time:
+		return t.Format(TimestampLayout), nil
+	case Timestamp:
+		return t.String(), nil
+	}
+	switch v.Kind() {
+	case reflect.String:
+		return v.String(), nil
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool()), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(v.Uint(), 10), nil
+	default:
+		return "", fmt.Errorf("unsupported type %s", v.Type())
+	}
+}
+
+// withQuery returns the URL with the query parameters encoded from the request (see encodeQuery).
+func withQuery(u string, request any) (string, error) {
+	values, err := encodeQuery(request)
+	if err != nil {
+		return "", err
+	}
+	if len(values) == 0 {
+		return u, nil
+	}
+	return u + "?" + values.Encode(), nil
+}
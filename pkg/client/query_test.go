@@ -0,0 +1,57 @@
+// Copyright 2022 c-fraser
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"testing"
+	"time"
+)
+
+func TestEncodeQuery(t *testing.T) {
+	type request struct {
+		Name     string    `query:"name"`
+		Limit    *int      `query:"limit"`
+		Tags     []string  `query:"tag,omitempty"`
+		Codes    []int     `query:"codes,comma"`
+		Since    Timestamp `query:"since,omitempty"`
+		Until    time.Time `query:"until,omitempty"`
+		Ignored  string
+		Excluded string `query:"-"`
+	}
+	values, err := encodeQuery(&request{
+		Limit:    Ptr(0),
+		Tags:     []string{"a", "b"},
+		Codes:    []int{1, 2},
+		Since:    NewTimestamp(time.Date(2020, 1, 1, 1, 1, 12, 123000000, time.UTC)),
+		Ignored:  "ignored",
+		Excluded: "excluded",
+	})
+	if err != nil {
+		t.Errorf("Failed to encode query: %v", err)
+	}
+	expected := "codes=1%2C2&limit=0&name=&since=2020-01-01T01%3A01%3A12.123%2B0000&tag=a&tag=b"
+	if actual := values.Encode(); actual != expected {
+		t.Errorf("Unexpected query: %s", actual)
+	}
+
+	if values, err := encodeQuery((*request)(nil)); err != nil || len(values) != 0 {
+		t.Errorf("Unexpected query of nil request: %v (%v)", values, err)
+	}
+	if _, err := encodeQuery(&struct {
+		Data map[string]string `query:"data"`
+	}{}); err == nil {
+		t.Errorf("Unexpected query of unsupported type")
+	}
+}
@@ -0,0 +1,156 @@
+// Copyright 2022 c-fraser
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// Redacted replaces secret values in logged data.
+const Redacted = "[REDACTED]"
+
+// secretKeys are the (lowercase) JSON keys and HTTP headers whose values are always redacted.
+var secretKeys = map[string]struct{}{
+	"authorization": {},
+	"cvc":           {},
+	"cvv":           {},
+	"password":      {},
+	"refreshtoken":  {},
+	"securitycode":  {},
+	"testpassword":  {},
+	"token":         {},
+}
+
+// cardNumber matches a sequence of 13 to 19 digits, optionally separated by spaces or dashes,
+// which may be a (full) card number.
+var cardNumber = regexp.MustCompile(`\b\d(?:[ -]?\d){12,18}\b`)
+
+// digits removes the separators from a cardNumber match.
+var digits = strings.NewReplacer(" ", "", "-", "")
+
+// Redact returns a copy of the (JSON) data with the values of secret keys, e.g. passwords and
+// tokens, and full card numbers masked.
+//
+// Data which isn't JSON only has card numbers masked.
+func Redact(data []byte) []byte {
+	var v any
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&v); err != nil {
+		return []byte(redactCardNumbers(string(data)))
+	}
+	redacted, err := json.Marshal(redactValue(v))
+	if err != nil {
+		return []byte(Redacted)
+	}
+	return redacted
+}
+
+// RedactHeader returns a copy of the header with the values of secret headers masked.
+func RedactHeader(header http.Header) http.Header {
+	redacted := header.Clone()
+	for key := range redacted {
+		if secret(key) {
+			redacted[key] = []string{Redacted}
+		}
+	}
+	return redacted
+}
+
+// redactValue masks the secret values in the decoded JSON value.
+func redactValue(v any) any {
+	switch value := v.(type) {
+	case map[string]any:
+		for key, item := range value {
+			if secret(key) {
+				value[key] = Redacted
+				continue
+			}
+			value[key] = redactValue(item)
+		}
+	case []any:
+		for i, item := range value {
+			value[i] = redactValue(item)
+		}
+	case string:
+		return redactCardNumbers(value)
+	case json.Number:
+		if s := redactCardNumbers(value.String()); s != value.String() {
+			return s
+		}
+	}
+	return v
+}
+
+// secret returns whether the values of the key are secret.
+func secret(key string) bool {
+	_, ok := secretKeys[strings.ToLower(key)]
+	return ok
+}
+
+// redactCardNumbers masks all but the last 4 digits of the (Luhn valid) card numbers in the text.
+func redactCardNumbers(text string) string {
+	return cardNumber.ReplaceAllStringFunc(text, func(match string) string {
+		number := digits.Replace(match)
+		if !luhn(number) {
+			return match
+		}
+		return strings.Repeat("*", len(number)-4) + number[len(number)-4:]
+	})
+}
+
+// luhn returns whether the number passes the Luhn checksum, as all card numbers do.
+func luhn(number string) bool {
+	sum := 0
+	for i := len(number) - 1; i >= 0; i-- {
+		d := int(number[i] - '0')
+		if (len(number)-i)%2 == 0 {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+	}
+	return sum%10 == 0
+}
+
+// LogValue implements slog.LogValuer to redact the LoginRequest.Password.
+func (r LoginRequest) LogValue() slog.Value {
+	return slog.GroupValue(slog.String("email", r.Email), slog.String("password", Redacted))
+}
+
+// LogValue implements slog.LogValuer to redact the LogoutRequest.RefreshToken.
+func (r LogoutRequest) LogValue() slog.Value {
+	return slog.GroupValue(slog.String("refreshToken", Redacted))
+}
+
+// LogValue implements slog.LogValuer to redact the RefreshTokenLoginRequest.RefreshToken.
+func (r RefreshTokenLoginRequest) LogValue() slog.Value {
+	return slog.GroupValue(slog.String("refreshToken", Redacted))
+}
+
+// LogValue implements slog.LogValuer to redact the LoginSignUpResponse tokens.
+func (r LoginSignUpResponse) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.String("user", r.User.ID),
+		slog.String("token", Redacted),
+		slog.String("refreshToken", Redacted))
+}
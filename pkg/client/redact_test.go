@@ -0,0 +1,96 @@
+// Copyright 2022 c-fraser
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRedact(t *testing.T) {
+	data, err := json.Marshal(map[string]any{
+		"email":        testEmail,
+		"testPassword": testPassword,
+		"token":        testToken,
+		"nested":       []any{map[string]any{"refreshToken": testToken}},
+		"number":       "4111 1111 1111 1111",
+		"notes":        "card 5555555555554444 was issued",
+		"id":           "1234567890123",
+		"balanceCents": 400000,
+	})
+	if err != nil {
+		t.Fatalf("Failed to marshal data: %v", err)
+	}
+	var actual map[string]any
+	err = json.Unmarshal(Redact(data), &actual)
+	if err != nil {
+		t.Fatalf("Failed to unmarshal redacted data: %v", err)
+	}
+	expected := map[string]any{
+		"email":        testEmail,
+		"testPassword": Redacted,
+		"token":        Redacted,
+		"nested":       []any{map[string]any{"refreshToken": Redacted}},
+		"number":       "************1111",
+		"notes":        "card ************4444 was issued",
+		"id":           "1234567890123",
+		"balanceCents": float64(400000),
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Unexpected redacted data: %v", actual)
+	}
+	if text := string(Redact([]byte("pan=4111111111111111"))); text != "pan=************1111" {
+		t.Errorf("Unexpected redacted text: %s", text)
+	}
+}
+
+func TestRedactHeader(t *testing.T) {
+	header := http.Header{}
+	header.Set("Authorization", "Bearer "+testToken)
+	header.Set("Accept", "application/json")
+	redacted := RedactHeader(header)
+	if value := redacted.Get("Authorization"); value != Redacted {
+		t.Errorf("Unexpected 'Authorization' header: %s", value)
+	}
+	if value := redacted.Get("Accept"); value != "application/json" {
+		t.Errorf("Unexpected 'Accept' header: %s", value)
+	}
+	if value := header.Get("Authorization"); value != "Bearer "+testToken {
+		t.Errorf("Unexpected original 'Authorization' header: %s", value)
+	}
+}
+
+func TestLogValue(t *testing.T) {
+	var buffer bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buffer, nil))
+	logger.Info(
+		"test",
+		slog.Any("login", LoginRequest{Email: testEmail, Password: testPassword}),
+		slog.Any("refresh", RefreshTokenLoginRequest{RefreshToken: testToken}),
+		slog.Any("logout", LogoutRequest{RefreshToken: testToken}),
+		slog.Any("response", &LoginSignUpResponse{Token: testToken, RefreshToken: testToken}))
+	output := buffer.String()
+	if strings.Contains(output, testPassword) || strings.Contains(output, testToken) {
+		t.Errorf("Unredacted log output: %s", output)
+	}
+	if !strings.Contains(output, testEmail) {
+		t.Errorf("Unexpected log output: %s", output)
+	}
+}
@@ -14,6 +14,8 @@
 
 package client
 
+import "time"
+
 // LoginRequest -> https://developer.paywithextend.com/#tocS_LoginRequest.
 type LoginRequest struct {
 	Email    string `json:"email"`
@@ -36,57 +38,97 @@ type ForgotPasswordRequest struct {
 }
 
 // VirtualCardPageableRequest -> https://developer.paywithextend.com/#tocS_VirtualCardPageableRequest.
+//
+// The request is sent as query parameters, the unset fields are omitted.
 type VirtualCardPageableRequest struct {
-	Count              int      `json:"count"`
-	Page               int      `json:"page"`
-	SortField          string   `json:"sortField"`
-	SortDirection      string   `json:"sortDirection"`
-	Cardholder         string   `json:"cardholder"`
-	Recipient          string   `json:"recipient"`
-	CardholderOrViewer string   `json:"cardholderOrViewer"`
-	CreditCardID       string   `json:"creditCardId"`
-	Status             string   `json:"status"`
-	Statuses           []string `json:"statuses"`
-	Issued             bool     `json:"issued"`
-	PendingRequest     bool     `json:"pendingRequest"`
-	Search             string   `json:"search"`
-	WithPermission     string   `json:"withPermission"`
+	Count              int                 `json:"count" query:"count,omitempty"`
+	Page               int                 `json:"page" query:"page,omitempty"`
+	SortField          SortField           `json:"sortField" query:"sortField,omitempty"`
+	SortDirection      SortDirection       `json:"sortDirection" query:"sortDirection,omitempty"`
+	Cardholder         string              `json:"cardholder" query:"cardholder,omitempty"`
+	Recipient          string              `json:"recipient" query:"recipient,omitempty"`
+	CardholderOrViewer string              `json:"cardholderOrViewer" query:"cardholderOrViewer,omitempty"`
+	CreditCardID       string              `json:"creditCardId" query:"creditCardId,omitempty"`
+	Status             VirtualCardStatus   `json:"status" query:"status,omitempty"`
+	Statuses           []VirtualCardStatus `json:"statuses" query:"statuses,omitempty"`
+	Issued             bool                `json:"issued" query:"issued,omitempty"`
+	PendingRequest     bool                `json:"pendingRequest" query:"pendingRequest,omitempty"`
+	Search             string              `json:"search" query:"search,omitempty"`
+	WithPermission     string              `json:"withPermission" query:"withPermission,omitempty"`
+}
+
+// VirtualCardTransactionsRequest -> https://developer.paywithextend.com/#get-virtual-card-transactions.
+//
+// The request is sent as query parameters, the unset fields are omitted.
+type VirtualCardTransactionsRequest struct {
+	// Count is the number of transactions to get, between 1 and 500.
+	Count int `json:"count" query:"count,omitempty"`
+	// Before filters the transactions to those before the time.
+	Before time.Time `json:"before" query:"before,omitempty"`
+	// After filters the transactions to those after the time.
+	After time.Time `json:"after" query:"after,omitempty"`
+	// Statuses filters the transactions to those with any of the statuses.
+	Statuses []TransactionStatus `json:"status" query:"status,omitempty,comma"`
 }
 
 // CreateVirtualCardRequest -> https://developer.paywithextend.com/#tocS_CreateVirtualCardRequest.
+//
+// The optional fields are omitted from the request if unset.
+//
+// The IdempotencyKey isn't a field of the Extend API request, see Client.CreateVirtualCard.
 type CreateVirtualCardRequest struct {
-	CreditCardID         string           `json:"creditCardId"`
-	Recipient            string           `json:"recipient"`
-	RecipientFirstName   string           `json:"recipientFirstName"`
-	RecipientLastName    string           `json:"recipientLastName"`
-	Cardholder           string           `json:"cardholder"`
-	DisplayName          string           `json:"displayName"`
-	ReferenceFields      []ReferenceField `json:"referenceFields"`
-	Notes                string           `json:"notes"`
-	BalanceCents         int              `json:"balanceCents"`
-	Direct               bool             `json:"direct"`
-	Currency             string           `json:"currency"`
-	ValidFrom            string           `json:"validFrom"`
-	ValidTo              string           `json:"validTo"`
-	Recurs               bool             `json:"recurs"`
-	Recurrence           Recurrence       `json:"recurrence"`
-	ReceiptAttachmentIds []string         `json:"receiptAttachmentIds"`
-	ValidMccRanges       []MccRange       `json:"validMccRanges"`
+	IdempotencyKey       string             `json:"-"`
+	CreditCardID         string             `json:"creditCardId"`
+	Recipient            string             `json:"recipient"`
+	RecipientFirstName   string             `json:"recipientFirstName,omitempty"`
+	RecipientLastName    string             `json:"recipientLastName,omitempty"`
+	Cardholder           string             `json:"cardholder,omitempty"`
+	DisplayName          string             `json:"displayName"`
+	ReferenceFields      []ReferenceField   `json:"referenceFields,omitempty"`
+	Notes                string             `json:"notes,omitempty"`
+	BalanceCents         int                `json:"balanceCents"`
+	Direct               bool               `json:"direct,omitempty"`
+	Currency             string             `json:"currency,omitempty"`
+	ValidFrom            *Timestamp         `json:"validFrom,omitempty"`
+	ValidTo              *Timestamp         `json:"validTo,omitempty"`
+	Recurs               bool               `json:"recurs,omitempty"`
+	Recurrence           *RecurrenceRequest `json:"recurrence,omitempty"`
+	ReceiptAttachmentIds []string           `json:"receiptAttachmentIds,omitempty"`
+	ValidMccRanges       []MccRange         `json:"validMccRanges,omitempty"`
 }
 
 // UpdateVirtualCardRequest -> https://developer.paywithextend.com/#tocS_UpdateVirtualCardRequest.
+//
+// The request is a partial update, only the (non-nil) fields which are set are sent, so a slice
+// field is cleared by setting it to a pointer to an empty slice. Use Ptr to set a field, or
+// DiffVirtualCard to compute the update from the current to the desired VirtualCard.
 type UpdateVirtualCardRequest struct {
-	CreditCardID         string           `json:"creditCardId"`
-	ReferenceFields      []ReferenceField `json:"referenceFields"`
-	DisplayName          string           `json:"displayName"`
-	Notes                string           `json:"notes"`
-	BalanceCents         int              `json:"balanceCents"`
-	Currency             string           `json:"currency"`
-	ValidFrom            string           `json:"validFrom"`
-	ValidTo              string           `json:"validTo"`
-	Recurs               bool             `json:"recurs"`
-	Recurrence           Recurrence       `json:"recurrence"`
-	ReceiptAttachmentIds []string         `json:"receiptAttachmentIds"`
-	ExpirationMonthYear  string           `json:"expirationMonthYear"`
-	ValidMccRanges       []MccRange       `json:"validMccRanges"`
+	CreditCardID         *string            `json:"creditCardId,omitempty"`
+	ReferenceFields      *[]ReferenceField  `json:"referenceFields,omitempty"`
+	DisplayName          *string            `json:"displayName,omitempty"`
+	Notes                *string            `json:"notes,omitempty"`
+	BalanceCents         *int               `json:"balanceCents,omitempty"`
+	Currency             *string            `json:"currency,omitempty"`
+	ValidFrom            *Timestamp         `json:"validFrom,omitempty"`
+	ValidTo              *Timestamp         `json:"validTo,omitempty"`
+	Recurs               *bool              `json:"recurs,omitempty"`
+	Recurrence           *RecurrenceRequest `json:"recurrence,omitempty"`
+	ReceiptAttachmentIds *[]string          `json:"receiptAttachmentIds,omitempty"`
+	ExpirationMonthYear  *string            `json:"expirationMonthYear,omitempty"`
+	ValidMccRanges       *[]MccRange        `json:"validMccRanges,omitempty"`
+}
+
+// RecurrenceRequest is the (writable) fields of a Recurrence, sent in a CreateVirtualCardRequest,
+// or UpdateVirtualCardRequest. The unset fields are omitted, see Recurrence.Request.
+type RecurrenceRequest struct {
+	BalanceCents int                  `json:"balanceCents"`
+	Period       RecurrencePeriod     `json:"period"`
+	Interval     int                  `json:"interval,omitempty"`
+	Terminator   RecurrenceTerminator `json:"terminator,omitempty"`
+	Count        int                  `json:"count,omitempty"`
+	Until        *Timestamp           `json:"until,omitempty"`
+	// ByWeekDay is a pointer since 0 is a day of the week (Monday).
+	ByWeekDay  *int `json:"byWeekDay,omitempty"`
+	ByMonthDay int  `json:"byMonthDay,omitempty"`
+	ByYearDay  int  `json:"byYearDay,omitempty"`
 }
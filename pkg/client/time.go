@@ -0,0 +1,170 @@
+// Copyright 2022 c-fraser
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// TimestampLayout is the layout of the timestamps sent to the Extend API, e.g.
+// "2020-01-01T01:01:12.123+0000".
+const TimestampLayout = "2006-01-02T15:04:05.000-0700"
+
+// zonedLayouts are the layouts of the timestamps, with a UTC offset, received from the Extend API.
+//
+// Fractional seconds are accepted after the seconds of any layout.
+var zonedLayouts = []string{
+	"2006-01-02T15:04:05Z0700",
+	time.RFC3339,
+}
+
+// floatingLayouts are the layouts of the timestamps, without a UTC offset, received from the Extend
+// API.
+var floatingLayouts = []string{
+	"2006-01-02T15:04:05",
+	"2006-01-02",
+}
+
+// Timestamp is a time.Time received from, or sent to, the Extend API.
+//
+// A Timestamp without a UTC offset, e.g. "2020-01-01", is floating: it is a wall clock time to be
+// interpreted in a time zone, such as the VirtualCard.Timezone (see VirtualCard.Local).
+//
+// An empty (or null) JSON timestamp is unmarshalled as the zero Timestamp, and a Timestamp is
+// marshalled exactly as it was unmarshalled, unless its time was changed.
+type Timestamp struct {
+	time.Time
+	// floating is whether the Timestamp has no UTC offset.
+	floating bool
+	// raw is the JSON the Timestamp was unmarshalled from.
+	raw string
+	// parsed is the time.Time parsed from the raw JSON.
+	parsed time.Time
+}
+
+// NewTimestamp returns the Timestamp of the time.
+func NewTimestamp(t time.Time) Timestamp {
+	return Timestamp{Time: t}
+}
+
+// ParseTimestamp parses the text as an Extend API timestamp.
+func ParseTimestamp(text string) (Timestamp, error) {
+	if text == "" {
+		return Timestamp{}, nil
+	}
+	for _, layout := range zonedLayouts {
+		if t, err := time.Parse(layout, text); err == nil {
+			return Timestamp{Time: t}, nil
+		}
+	}
+	for _, layout := range floatingLayouts {
+		if t, err := time.Parse(layout, text); err == nil {
+			return Timestamp{Time: t, floating: true}, nil
+		}
+	}
+	return Timestamp{}, fmt.Errorf("invalid timestamp %q", text)
+}
+
+// IsFloating returns whether the Timestamp has no UTC offset.
+func (t Timestamp) IsFloating() bool {
+	return t.floating
+}
+
+// In returns the Timestamp in the location. The wall clock time of a floating Timestamp is
+// interpreted in the location, otherwise the time is converted to the location.
+func (t Timestamp) In(loc *time.Location) time.Time {
+	if t.IsZero() {
+		return t.Time
+	}
+	if t.floating {
+		return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), loc)
+	}
+	return t.Time.In(loc)
+}
+
+// String returns the Timestamp formatted per the TimestampLayout, or "" if the Timestamp is zero.
+func (t Timestamp) String() string {
+	if t.IsZero() {
+		return ""
+	}
+	if t.floating {
+		return t.Format("2006-01-02T15:04:05.000")
+	}
+	return t.Format(TimestampLayout)
+}
+
+// MarshalJSON implements json.Marshaler.
+func (t Timestamp) MarshalJSON() ([]byte, error) {
+	if t.raw != "" && t.Time.Equal(t.parsed) && t.Location() == t.parsed.Location() {
+		return []byte(t.raw), nil
+	}
+	if t.IsZero() {
+		return []byte(`""`), nil
+	}
+	return json.Marshal(t.String())
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (t *Timestamp) UnmarshalJSON(data []byte) error {
+	raw := string(data)
+	if raw == "null" {
+		*t = Timestamp{raw: raw}
+		return nil
+	}
+	var text string
+	if err := json.Unmarshal(data, &text); err != nil {
+		return fmt.Errorf("invalid timestamp %s: %w", data, err)
+	}
+	parsed, err := ParseTimestamp(text)
+	if err != nil {
+		return err
+	}
+	parsed.raw = raw
+	parsed.parsed = parsed.Time
+	*t = parsed
+	return nil
+}
+
+// Location returns the time.Location of the VirtualCard.Timezone, or time.UTC if the time zone is
+// absent or unknown.
+func (vc VirtualCard) Location() *time.Location {
+	return location(vc.Timezone)
+}
+
+// Local returns the Timestamp in the VirtualCard.Location.
+func (vc VirtualCard) Local(t Timestamp) time.Time {
+	return t.In(vc.Location())
+}
+
+// Location returns the time.Location of the User.Timezone, or time.UTC if the time zone is absent
+// or unknown.
+func (u User) Location() *time.Location {
+	return location(u.Timezone)
+}
+
+// location returns the time.Location of the IANA time zone name, or time.UTC if the time zone is
+// absent or unknown.
+func location(name string) *time.Location {
+	if name == "" {
+		return time.UTC
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
@@ -0,0 +1,122 @@
+// Copyright 2022 c-fraser
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseTimestamp(t *testing.T) {
+	for text, expected := range map[string]time.Time{
+		"2020-01-01T01:01:12.123+0000":  time.Date(2020, 1, 1, 1, 1, 12, 123000000, time.UTC),
+		"2020-01-01T01:01:12-0500":      time.Date(2020, 1, 1, 6, 1, 12, 0, time.UTC),
+		"2020-01-01T01:01:12Z":          time.Date(2020, 1, 1, 1, 1, 12, 0, time.UTC),
+		"2020-01-01T01:01:12.5+05:30":   time.Date(2019, 12, 31, 19, 31, 12, 500000000, time.UTC),
+		"2020-01-01T01:01:12.123456789": time.Date(2020, 1, 1, 1, 1, 12, 123456789, time.UTC),
+		"2020-01-01":                    time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC),
+	} {
+		actual, err := ParseTimestamp(text)
+		if err != nil {
+			t.Errorf("Failed to parse %q: %v", text, err)
+		}
+		if !actual.Equal(expected) {
+			t.Errorf("Unexpected time parsed from %q: %v", text, actual.Time)
+		}
+	}
+	for _, text := range []string{"string", "01/01/2020", "2020-13-01"} {
+		if ts, err := ParseTimestamp(text); err == nil {
+			t.Errorf("Unexpected timestamp parsed from %q: %v", text, ts)
+		}
+	}
+}
+
+func TestTimestampRoundTrip(t *testing.T) {
+	data := []byte(readTestdata(t, "virtual_card_response.json"))
+	var response VirtualCardResponse
+	err := json.Unmarshal(data, &response)
+	if err != nil {
+		t.Fatalf("Failed to unmarshal virtual card: %v", err)
+	}
+	expires := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	if vc := response.VirtualCard; !vc.Expires.Equal(expires) || vc.CreatedAt.IsZero() {
+		t.Errorf("Unexpected virtual card timestamps: %v", vc)
+	}
+	marshalled, err := json.Marshal(response)
+	if err != nil {
+		t.Fatalf("Failed to marshal virtual card: %v", err)
+	}
+	var expected, actual any
+	_ = json.Unmarshal(data, &expected)
+	_ = json.Unmarshal(marshalled, &actual)
+	if !reflect.DeepEqual(expected, actual) {
+		t.Errorf("Unexpected virtual card JSON: %s", marshalled)
+	}
+
+	var recurrence Recurrence
+	err = json.Unmarshal([]byte(`{"until": "", "prevRecurrenceAt": null, "nextRecurrenceAt": "2020-01-01"}`), &recurrence)
+	if err != nil {
+		t.Fatalf("Failed to unmarshal recurrence: %v", err)
+	}
+	if !recurrence.Until.IsZero() || !recurrence.PrevRecurrenceAt.IsZero() {
+		t.Errorf("Unexpected empty timestamps: %v", recurrence)
+	}
+	marshalled, err = json.Marshal(struct {
+		Until            Timestamp `json:"until"`
+		PrevRecurrenceAt Timestamp `json:"prevRecurrenceAt"`
+		NextRecurrenceAt Timestamp `json:"nextRecurrenceAt"`
+	}{recurrence.Until, recurrence.PrevRecurrenceAt, recurrence.NextRecurrenceAt})
+	if err != nil {
+		t.Fatalf("Failed to marshal recurrence: %v", err)
+	}
+	if s := string(marshalled); s != `{"until":"","prevRecurrenceAt":null,"nextRecurrenceAt":"2020-01-01"}` {
+		t.Errorf("Unexpected recurrence JSON: %s", s)
+	}
+
+	recurrence.NextRecurrenceAt.Time = recurrence.NextRecurrenceAt.AddDate(0, 0, 1)
+	marshalled, err = json.Marshal(recurrence.NextRecurrenceAt)
+	if err != nil || string(marshalled) != `"2020-01-02T00:00:00.000"` {
+		t.Errorf("Unexpected changed timestamp JSON: %s, %v", marshalled, err)
+	}
+	marshalled, err = json.Marshal(NewTimestamp(time.Date(2020, 1, 1, 1, 1, 12, 123000000, time.UTC)))
+	if err != nil || string(marshalled) != `"2020-01-01T01:01:12.123+0000"` {
+		t.Errorf("Unexpected new timestamp JSON: %s, %v", marshalled, err)
+	}
+}
+
+func TestTimestampTimezone(t *testing.T) {
+	vc := VirtualCard{Timezone: "America/New_York"}
+	floating, err := ParseTimestamp("2020-01-01T09:00:00")
+	if err != nil {
+		t.Fatalf("Failed to parse timestamp: %v", err)
+	}
+	local := vc.Local(floating)
+	if local.Hour() != 9 || !local.Equal(time.Date(2020, 1, 1, 14, 0, 0, 0, time.UTC)) {
+		t.Errorf("Unexpected floating local time: %v", local)
+	}
+	zoned, err := ParseTimestamp("2020-01-01T09:00:00.000+0000")
+	if err != nil {
+		t.Fatalf("Failed to parse timestamp: %v", err)
+	}
+	local = vc.Local(zoned)
+	if local.Hour() != 4 || !local.Equal(zoned.Time) {
+		t.Errorf("Unexpected zoned local time: %v", local)
+	}
+	if loc := (VirtualCard{Timezone: "string"}).Location(); loc != time.UTC {
+		t.Errorf("Unexpected location of unknown timezone: %v", loc)
+	}
+}
@@ -0,0 +1,122 @@
+// Copyright 2022 c-fraser
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import "slices"
+
+// Ptr returns a pointer to the value, e.g. to set an optional UpdateVirtualCardRequest field.
+func Ptr[T any](v T) *T {
+	return &v
+}
+
+// IsEmpty returns whether the UpdateVirtualCardRequest doesn't update any field.
+func (r UpdateVirtualCardRequest) IsEmpty() bool {
+	return r == UpdateVirtualCardRequest{}
+}
+
+// DiffVirtualCard returns the minimal UpdateVirtualCardRequest which updates the current
+// VirtualCard to the desired VirtualCard, which IsEmpty if the updatable fields are equal.
+//
+// The ReferenceFields and ReceiptAttachmentIds of a VirtualCard are unknown, so they are never
+// updated, nor is the expiration removed if the desired VirtualCard.Expires is zero.
+func DiffVirtualCard(current, desired VirtualCard) *UpdateVirtualCardRequest {
+	var r UpdateVirtualCardRequest
+	if current.CreditCardID != desired.CreditCardID {
+		r.CreditCardID = Ptr(desired.CreditCardID)
+	}
+	if current.DisplayName != desired.DisplayName {
+		r.DisplayName = Ptr(desired.DisplayName)
+	}
+	if current.Notes != desired.Notes {
+		r.Notes = Ptr(desired.Notes)
+	}
+	if current.BalanceCents != desired.BalanceCents || current.Currency != desired.Currency {
+		r.BalanceCents = Ptr(desired.BalanceCents)
+		r.Currency = Ptr(desired.Currency)
+	}
+	if !sameTimestamp(current.ValidFrom, desired.ValidFrom) {
+		r.ValidFrom = Ptr(desired.ValidFrom)
+	}
+	if !sameTimestamp(current.ValidTo, desired.ValidTo) {
+		r.ValidTo = Ptr(desired.ValidTo)
+	}
+	if current.Recurs != desired.Recurs {
+		r.Recurs = Ptr(desired.Recurs)
+	}
+	if desired.Recurs && !sameRecurrence(current.Recurrence, desired.Recurrence) {
+		r.Recurs = Ptr(desired.Recurs)
+		r.Recurrence = Ptr(desired.Recurrence.Request())
+	}
+	if !desired.Expires.IsZero() && expiration(current.Expires) != expiration(desired.Expires) {
+		r.ExpirationMonthYear = Ptr(expiration(desired.Expires))
+	}
+	if !slices.Equal(current.ValidMccRanges, desired.ValidMccRanges) {
+		ranges := desired.ValidMccRanges
+		if ranges == nil {
+			ranges = []MccRange{}
+		}
+		r.ValidMccRanges = &ranges
+	}
+	return &r
+}
+
+// sameTimestamp returns whether the Timestamp values are the same instant, and both floating or
+// zoned.
+func sameTimestamp(a, b Timestamp) bool {
+	return a.Equal(b.Time) && a.IsFloating() == b.IsFloating()
+}
+
+// sameRecurrence returns whether the updatable fields of the Recurrence values are equal.
+func sameRecurrence(a, b Recurrence) bool {
+	return a.BalanceCents == b.BalanceCents &&
+		a.Period == b.Period &&
+		a.Interval == b.Interval &&
+		a.Terminator == b.Terminator &&
+		a.Count == b.Count &&
+		sameTimestamp(a.Until, b.Until) &&
+		a.ByWeekDay == b.ByWeekDay &&
+		a.ByMonthDay == b.ByMonthDay &&
+		a.ByYearDay == b.ByYearDay
+}
+
+// Request returns the RecurrenceRequest of the writable fields of the Recurrence. The ByWeekDay is
+// only set for a weekly Recurrence, or if it isn't 0 (Monday), since 0 is also its unset value.
+func (r Recurrence) Request() RecurrenceRequest {
+	request := RecurrenceRequest{
+		BalanceCents: r.BalanceCents,
+		Period:       r.Period,
+		Interval:     r.Interval,
+		Terminator:   r.Terminator,
+		Count:        r.Count,
+		ByMonthDay:   r.ByMonthDay,
+		ByYearDay:    r.ByYearDay,
+	}
+	if !r.Until.IsZero() {
+		request.Until = Ptr(r.Until)
+	}
+	if r.Period == RecurrencePeriodWeekly || r.ByWeekDay != 0 {
+		request.ByWeekDay = Ptr(r.ByWeekDay)
+	}
+	return request
+}
+
+// expiration returns the UpdateVirtualCardRequest.ExpirationMonthYear of the Timestamp, e.g.
+// "11/23", or "" if the Timestamp is zero.
+func expiration(t Timestamp) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format("01/06")
+}
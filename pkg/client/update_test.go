@@ -0,0 +1,94 @@
+// Copyright 2022 c-fraser
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestUpdateVirtualCardRequestJSON(t *testing.T) {
+	b, err := json.Marshal(UpdateVirtualCardRequest{DisplayName: Ptr("Groceries")})
+	if err != nil {
+		t.Errorf("Failed to marshal request: %v", err)
+	}
+	if string(b) != `{"displayName":"Groceries"}` {
+		t.Errorf("Unexpected request JSON: %s", b)
+	}
+	b, err = json.Marshal(UpdateVirtualCardRequest{BalanceCents: Ptr(0), ValidMccRanges: &[]MccRange{}})
+	if err != nil {
+		t.Errorf("Failed to marshal request: %v", err)
+	}
+	if string(b) != `{"balanceCents":0,"validMccRanges":[]}` {
+		t.Errorf("Unexpected request JSON: %s", b)
+	}
+	b, err = json.Marshal(CreateVirtualCardRequest{CreditCardID: "cc_1234", DisplayName: "Groceries"})
+	if err != nil {
+		t.Errorf("Failed to marshal request: %v", err)
+	}
+	if string(b) != `{"creditCardId":"cc_1234","recipient":"","displayName":"Groceries","balanceCents":0}` {
+		t.Errorf("Unexpected request JSON: %s", b)
+	}
+}
+
+func TestDiffVirtualCard(t *testing.T) {
+	var response VirtualCardResponse
+	if err := json.Unmarshal([]byte(readTestdata(t, "virtual_card_response.json")), &response); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+	current := response.VirtualCard
+	if r := DiffVirtualCard(current, current); !r.IsEmpty() {
+		t.Errorf("Unexpected update of unchanged virtual card: %+v", r)
+	}
+
+	desired := current
+	desired.DisplayName = "Groceries"
+	desired.ValidTo = NewTimestamp(current.ValidTo.Add(24 * time.Hour))
+	desired.ValidMccRanges = nil
+	r := DiffVirtualCard(current, desired)
+	b, err := json.Marshal(r)
+	if err != nil {
+		t.Errorf("Failed to marshal request: %v", err)
+	}
+	if string(b) != `{"displayName":"Groceries","validTo":"2020-01-02T01:01:12.123+0000","validMccRanges":[]}` {
+		t.Errorf("Unexpected request JSON: %s", b)
+	}
+
+	desired = current
+	desired.Recurrence.Interval++
+	r = DiffVirtualCard(current, desired)
+	if r.Recurrence == nil || r.Recurrence.Interval != current.Recurrence.Interval+1 || r.Recurs == nil {
+		t.Errorf("Unexpected recurrence update: %+v", r)
+	}
+	// only the writable fields of the recurrence are sent
+	b, err = json.Marshal(r)
+	if err != nil {
+		t.Errorf("Failed to marshal request: %v", err)
+	}
+	if string(b) != `{"recurs":true,"recurrence":{"balanceCents":0,"period":"DAILY","interval":1,"terminator":"NONE","until":"2020-01-01T01:01:12.123+0000"}}` {
+		t.Errorf("Unexpected request JSON: %s", b)
+	}
+
+	desired = current
+	desired.Recurrence = Recurrence{BalanceCents: 100, Period: RecurrencePeriodWeekly, Terminator: RecurrenceTerminatorNone}
+	b, err = json.Marshal(DiffVirtualCard(current, desired))
+	if err != nil {
+		t.Errorf("Failed to marshal request: %v", err)
+	}
+	if string(b) != `{"recurs":true,"recurrence":{"balanceCents":100,"period":"WEEKLY","terminator":"NONE","byWeekDay":0}}` {
+		t.Errorf("Unexpected request JSON: %s", b)
+	}
+}
@@ -0,0 +1,216 @@
+// Copyright 2022 c-fraser
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrInvalidRequest is matched (by errors.Is) by the ValidationError of a request.
+var ErrInvalidRequest = errors.New("invalid request")
+
+// FieldError is an invalid field of a request.
+type FieldError struct {
+	// Field is the JSON path of the field, e.g. "recurrence.count".
+	Field string `json:"field"`
+	// Message describes why the field is invalid.
+	Message string `json:"message"`
+}
+
+// Error implements error.
+func (e FieldError) Error() string {
+	return e.Field + ": " + e.Message
+}
+
+// ValidationError is the invalid fields of a request, returned by the Validate method of the
+// request.
+type ValidationError struct {
+	Fields []FieldError `json:"fields"`
+}
+
+// Error implements error.
+func (e *ValidationError) Error() string {
+	fields := make([]string, len(e.Fields))
+	for i, f := range e.Fields {
+		fields[i] = f.Error()
+	}
+	return fmt.Sprintf("%v: %s", ErrInvalidRequest, strings.Join(fields, "; "))
+}
+
+// Is returns whether the target is ErrInvalidRequest.
+func (e *ValidationError) Is(target error) bool {
+	return target == ErrInvalidRequest
+}
+
+// validator accumulates the FieldError values of a request.
+type validator struct {
+	fields []FieldError
+}
+
+// check adds a FieldError for the field if the condition is false.
+func (v *validator) check(ok bool, field, format string, args ...any) {
+	if !ok {
+		v.fields = append(v.fields, FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+	}
+}
+
+// err returns the ValidationError of the fields, or nil if there are none.
+func (v *validator) err() error {
+	if len(v.fields) == 0 {
+		return nil
+	}
+	return &ValidationError{Fields: v.fields}
+}
+
+// Validate returns a ValidationError if the CreateVirtualCardRequest has (locally detectable)
+// invalid fields, which the Extend API would reject.
+func (r CreateVirtualCardRequest) Validate() error {
+	var v validator
+	v.check(r.CreditCardID != "", "creditCardId", "is required")
+	v.check(r.Recipient != "", "recipient", "is required")
+	v.check(r.DisplayName != "", "displayName", "is required")
+	v.check(r.BalanceCents > 0, "balanceCents", "must be positive, not %d", r.BalanceCents)
+	if r.Currency != "" {
+		v.currency("currency", r.Currency)
+	}
+	v.validity(r.ValidFrom, r.ValidTo)
+	v.check(!r.Recurs || r.Recurrence != nil, "recurrence", "is required if recurs")
+	if r.Recurs && r.Recurrence != nil {
+		v.recurrence("recurrence", *r.Recurrence)
+	}
+	v.mccRanges("validMccRanges", r.ValidMccRanges)
+	if r.IdempotencyKey != "" {
+		v.check(
+			idempotencyKeyPattern.MatchString(r.IdempotencyKey),
+			"idempotencyKey",
+			"must not contain whitespace or ']', not %q",
+			r.IdempotencyKey)
+	}
+	return v.err()
+}
+
+// Validate returns a ValidationError if the (set fields of the) UpdateVirtualCardRequest are
+// (locally detectable) invalid, which the Extend API would reject.
+func (r UpdateVirtualCardRequest) Validate() error {
+	var v validator
+	if r.CreditCardID != nil {
+		v.check(*r.CreditCardID != "", "creditCardId", "must not be empty")
+	}
+	if r.DisplayName != nil {
+		v.check(*r.DisplayName != "", "displayName", "must not be empty")
+	}
+	if r.BalanceCents != nil {
+		v.check(*r.BalanceCents > 0, "balanceCents", "must be positive, not %d", *r.BalanceCents)
+	}
+	if r.Currency != nil {
+		v.currency("currency", *r.Currency)
+	}
+	v.validity(r.ValidFrom, r.ValidTo)
+	if r.Recurs != nil && *r.Recurs {
+		v.check(r.Recurrence != nil, "recurrence", "is required if recurs")
+	}
+	if r.Recurrence != nil && (r.Recurs == nil || *r.Recurs) {
+		v.recurrence("recurrence", *r.Recurrence)
+	}
+	if r.ExpirationMonthYear != nil {
+		var month, year int
+		_, err := fmt.Sscanf(*r.ExpirationMonthYear, "%02d/%02d", &month, &year)
+		v.check(
+			err == nil && len(*r.ExpirationMonthYear) == 5 && month >= 1 && month <= 12,
+			"expirationMonthYear",
+			"must be formatted as MM/YY, not %q",
+			*r.ExpirationMonthYear)
+	}
+	if r.ValidMccRanges != nil {
+		v.mccRanges("validMccRanges", *r.ValidMccRanges)
+	}
+	return v.err()
+}
+
+// currency validates the field is a known ISO 4217 currency.
+func (v *validator) currency(field, currency string) {
+	_, ok := MinorUnits(currency)
+	v.check(ok, field, "unknown currency %q", currency)
+}
+
+// validity validates the validTo isn't before the validFrom.
+func (v *validator) validity(from, to *Timestamp) {
+	if from == nil || to == nil || from.IsZero() || to.IsZero() {
+		return
+	}
+	v.check(!to.Before(from.Time), "validTo", "must not be before validFrom (%s), not %s", from, to)
+}
+
+// recurrence validates the field is a Recurrence which the Extend API accepts.
+func (v *validator) recurrence(field string, r RecurrenceRequest) {
+	v.check(r.BalanceCents > 0, field+".balanceCents", "must be positive, not %d", r.BalanceCents)
+	v.check(r.Period.IsKnown(), field+".period", "unknown period %q", r.Period)
+	v.check(r.Interval >= 0, field+".interval", "must not be negative, not %d", r.Interval)
+	v.check(r.Terminator.IsKnown(), field+".terminator", "unknown terminator %q", r.Terminator)
+	switch r.Terminator {
+	case RecurrenceTerminatorCount, RecurrenceTerminatorCountOrDate:
+		v.check(r.Count > 0, field+".count", "must be positive if the terminator is %s", r.Terminator)
+	}
+	switch r.Terminator {
+	case RecurrenceTerminatorDate, RecurrenceTerminatorCountOrDate:
+		v.check(r.Until != nil && !r.Until.IsZero(), field+".until", "is required if the terminator is %s", r.Terminator)
+	}
+	// 0 is a day of the week (Monday), so the period, rather than the value, determines whether the
+	// byWeekDay may be set
+	if r.Period == RecurrencePeriodWeekly {
+		if r.ByWeekDay != nil {
+			v.check(*r.ByWeekDay >= 0 && *r.ByWeekDay <= 6, field+".byWeekDay", "must be between 0 and 6, not %d", *r.ByWeekDay)
+		}
+	} else {
+		v.check(r.ByWeekDay == nil, field+".byWeekDay", "requires a %s period", RecurrencePeriodWeekly)
+	}
+	if r.ByMonthDay != 0 {
+		v.check(r.Period == RecurrencePeriodMonthly, field+".byMonthDay", "requires a %s period", RecurrencePeriodMonthly)
+		v.check(r.ByMonthDay >= 1 && r.ByMonthDay <= 31, field+".byMonthDay", "must be between 1 and 31, not %d", r.ByMonthDay)
+	}
+	if r.ByYearDay != 0 {
+		v.check(r.Period == RecurrencePeriodYearly, field+".byYearDay", "requires a %s period", RecurrencePeriodYearly)
+		v.check(r.ByYearDay >= 1 && r.ByYearDay <= 366, field+".byYearDay", "must be between 1 and 366, not %d", r.ByYearDay)
+	}
+}
+
+// mccRanges validates the field is MccRange values of 4 digit codes, each lowest not greater than
+// the highest.
+func (v *validator) mccRanges(field string, ranges []MccRange) {
+	for i, r := range ranges {
+		prefix := fmt.Sprintf("%s[%d]", field, i)
+		lowest, highest := isMcc(r.Lowest), isMcc(r.Highest)
+		v.check(lowest, prefix+".lowest", "must be a 4 digit code, not %q", r.Lowest)
+		v.check(highest, prefix+".highest", "must be a 4 digit code, not %q", r.Highest)
+		if lowest && highest {
+			v.check(r.Lowest <= r.Highest, prefix, "lowest (%s) must not be greater than highest (%s)", r.Lowest, r.Highest)
+		}
+	}
+}
+
+// isMcc returns whether the code is a 4 digit merchant category code.
+func isMcc(code string) bool {
+	if len(code) != 4 {
+		return false
+	}
+	for _, c := range code {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,129 @@
+// Copyright 2022 c-fraser
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestValidateCreateVirtualCardRequest(t *testing.T) {
+	var request CreateVirtualCardRequest
+	if err := json.Unmarshal([]byte(readTestdata(t, "create_virtual_card_request.json")), &request); err != nil {
+		t.Fatalf("Failed to initialize request: %v", err)
+	}
+	if err := request.Validate(); err != nil {
+		t.Errorf("Unexpected invalid request: %v", err)
+	}
+
+	request.BalanceCents = 0
+	request.Currency = "XYZ"
+	request.ValidTo = Ptr(NewTimestamp(request.ValidFrom.Add(-time.Hour)))
+	request.Recurrence.Period = RecurrencePeriodMonthly
+	request.Recurrence.ByWeekDay = Ptr(2)
+	request.Recurrence.Count = 0
+	request.ValidMccRanges = []MccRange{{Lowest: "5678", Highest: "1234"}, {Lowest: "12", Highest: "5678"}}
+	request.IdempotencyKey = "vendor card"
+	err := request.Validate()
+	if !errors.Is(err, ErrInvalidRequest) {
+		t.Fatalf("Unexpected validation error: %v", err)
+	}
+	var invalid *ValidationError
+	if !errors.As(err, &invalid) {
+		t.Fatalf("Unexpected validation error: %v", err)
+	}
+	var fields []string
+	for _, f := range invalid.Fields {
+		fields = append(fields, f.Field)
+	}
+	expected := []string{
+		"balanceCents",
+		"currency",
+		"validTo",
+		"recurrence.count",
+		"recurrence.byWeekDay",
+		"validMccRanges[0]",
+		"validMccRanges[1].lowest",
+		"idempotencyKey",
+	}
+	if !reflect.DeepEqual(fields, expected) {
+		t.Errorf("Unexpected invalid fields: %v", fields)
+	}
+}
+
+func TestValidateUpdateVirtualCardRequest(t *testing.T) {
+	var request UpdateVirtualCardRequest
+	if err := json.Unmarshal([]byte(readTestdata(t, "update_virtual_card_request.json")), &request); err != nil {
+		t.Fatalf("Failed to initialize request: %v", err)
+	}
+	if err := request.Validate(); err != nil {
+		t.Errorf("Unexpected invalid request: %v", err)
+	}
+	if err := (UpdateVirtualCardRequest{DisplayName: Ptr("Groceries")}).Validate(); err != nil {
+		t.Errorf("Unexpected invalid request: %v", err)
+	}
+
+	request = UpdateVirtualCardRequest{
+		BalanceCents:        Ptr(-1),
+		ExpirationMonthYear: Ptr("2023-11"),
+		Recurs:              Ptr(true),
+		Recurrence:          &RecurrenceRequest{BalanceCents: 100, Period: "HOURLY", Terminator: RecurrenceTerminatorDate},
+	}
+	var invalid *ValidationError
+	if err := request.Validate(); !errors.As(err, &invalid) || len(invalid.Fields) != 4 {
+		t.Errorf("Unexpected validation error: %v", err)
+	}
+
+	// byWeekDay 0 (Monday) is only valid for a weekly recurrence
+	recurrence := RecurrenceRequest{BalanceCents: 100, Period: RecurrencePeriodWeekly, Terminator: RecurrenceTerminatorNone, ByWeekDay: Ptr(0)}
+	if err := (UpdateVirtualCardRequest{Recurrence: &recurrence}).Validate(); err != nil {
+		t.Errorf("Unexpected invalid request: %v", err)
+	}
+	for _, period := range []RecurrencePeriod{RecurrencePeriodMonthly, RecurrencePeriodYearly} {
+		recurrence.Period = period
+		err := (UpdateVirtualCardRequest{Recurrence: &recurrence}).Validate()
+		if !errors.As(err, &invalid) || len(invalid.Fields) != 1 || invalid.Fields[0].Field != "recurrence.byWeekDay" {
+			t.Errorf("Unexpected validation error of a %s recurrence: %v", period, err)
+		}
+	}
+}
+
+func TestClientValidation(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/signin" && r.URL.Path != "/signout" {
+			t.Errorf("Unexpected request: %s %s", r.Method, r.URL)
+		}
+		_, _ = w.Write([]byte(`{"token": "` + testToken + `"}`))
+	}))
+	defer server.Close()
+
+	client, err := NewClient(server.URL, testEmail, testPassword)
+	if err != nil {
+		t.Fatalf("Failed to initialize client: %v", err)
+	}
+	defer client.Close()
+
+	if _, err := client.CreateVirtualCard(&CreateVirtualCardRequest{}); !errors.Is(err, ErrInvalidRequest) {
+		t.Errorf("Unexpected create virtual card error: %v", err)
+	}
+	if _, err := client.UpdateVirtualCard(testVirtualCardId, &UpdateVirtualCardRequest{BalanceCents: Ptr(0)}); !errors.Is(err, ErrInvalidRequest) {
+		t.Errorf("Unexpected update virtual card error: %v", err)
+	}
+}
@@ -0,0 +1,287 @@
+// Copyright 2022 c-fraser
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package config contains the configuration file, and named profiles, of the extendz CLI.
+//
+// The configuration file is YAML, for example:
+//
+//	current: production
+//	profiles:
+//	  production:
+//	    email: ops@example.com
+//	    output: table
+//	  sandbox:
+//	    server: https://sandbox.paywithextend.com
+//	    email: ops+sandbox@example.com
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/c-fraser/extendz/pkg/client"
+	"gopkg.in/yaml.v3"
+)
+
+// The environment variables which override the configuration.
+const (
+	// EnvConfig is the path of the configuration file.
+	EnvConfig = "EXTENDZ_CONFIG"
+	// EnvProfile is the name of the profile to use.
+	EnvProfile = "EXTENDZ_PROFILE"
+	// EnvServer overrides Profile.Server.
+	EnvServer = "EXTEND_SERVER"
+	// EnvEmail overrides Profile.Email.
+	EnvEmail = "EXTEND_EMAIL"
+	// EnvPassword is the password of the Profile.Email, which overrides the Profile.Auth.
+	EnvPassword = "EXTEND_PASSWORD"
+	// EnvPassphrase is the passphrase of the AuthFile credentials file.
+	EnvPassphrase = "EXTENDZ_PASSPHRASE"
+	// EnvOutput overrides Profile.Output.
+	EnvOutput = "EXTENDZ_OUTPUT"
+)
+
+// DefaultServer is the URL of the (production) Extend API.
+const DefaultServer = "https://api.paywithextend.com"
+
+// DefaultProfile is the name of the profile used when neither a profile is given nor
+// Config.Current is set.
+const DefaultProfile = "default"
+
+// DefaultOutput is the output format used when the Profile doesn't specify one.
+const DefaultOutput = "json"
+
+// Auth is the method a Profile uses to get the password of the Profile.Email.
+type Auth string
+
+const (
+	// AuthKeyring reads the password from the OS keyring (e.g. the Secret Service on Linux).
+	AuthKeyring Auth = "keyring"
+	// AuthFile reads the password from a passphrase encrypted file.
+	AuthFile Auth = "file"
+	// AuthCommand reads the password from the output of the Profile.PasswordCommand.
+	AuthCommand Auth = "command"
+	// AuthPrompt reads the password from the terminal, without echo.
+	AuthPrompt Auth = "prompt"
+	// AuthEnv reads the password from the EnvPassword environment variable only.
+	AuthEnv Auth = "env"
+)
+
+// Auths returns the known Auth values.
+func Auths() []Auth {
+	return []Auth{AuthKeyring, AuthFile, AuthCommand, AuthPrompt, AuthEnv}
+}
+
+// Stores returns whether the Auth stores passwords, via login, rather than only reading them.
+func (a Auth) Stores() bool {
+	return a == AuthKeyring || a == AuthFile
+}
+
+// IsKnown returns whether the Auth is a known value.
+func (a Auth) IsKnown() bool {
+	for _, v := range Auths() {
+		if v == a {
+			return true
+		}
+	}
+	return false
+}
+
+// ErrUnknownProfile is returned when a profile, which isn't in the Config, is requested.
+var ErrUnknownProfile = errors.New("unknown profile")
+
+// Profile is a named set of settings for an Extend account.
+type Profile struct {
+	// Server is the URL of the Extend API, DefaultServer if empty.
+	Server string `yaml:"server,omitempty" json:"server,omitempty"`
+	// Email is the email address to sign in with.
+	Email string `yaml:"email,omitempty" json:"email,omitempty"`
+	// Auth is the method to get the password with, AuthKeyring if empty.
+	Auth Auth `yaml:"auth,omitempty" json:"auth,omitempty"`
+	// PasswordCommand is the (shell) command which prints the password, used by AuthCommand.
+	PasswordCommand string `yaml:"password_command,omitempty" json:"passwordCommand,omitempty"`
+	// Output is the default output format of the CLI, DefaultOutput if empty.
+	Output string `yaml:"output,omitempty" json:"output,omitempty"`
+}
+
+// Validate returns an error if the Profile has an unknown Auth, malformed Server, or is missing the
+// PasswordCommand of AuthCommand.
+func (p Profile) Validate() error {
+	if p.Auth != "" && !p.Auth.IsKnown() {
+		return fmt.Errorf("unknown auth %q, expected one of %s", p.Auth, strings.Join(client.Names(Auths()), ", "))
+	}
+	if p.Auth == AuthCommand && p.PasswordCommand == "" {
+		return fmt.Errorf("the %s auth requires a password_command", AuthCommand)
+	}
+	if p.Server != "" && !strings.HasPrefix(p.Server, "https://") && !strings.HasPrefix(p.Server, "http://") {
+		return fmt.Errorf("server %q must be an http(s) URL", p.Server)
+	}
+	return nil
+}
+
+// Override returns a copy of the Profile with the fields set by the environment variables, as
+// looked up by getenv (e.g. os.Getenv), and the defaults of the unset fields.
+func (p Profile) Override(getenv func(string) string) Profile {
+	if v := getenv(EnvServer); v != "" {
+		p.Server = v
+	}
+	if v := getenv(EnvEmail); v != "" {
+		p.Email = v
+	}
+	if v := getenv(EnvOutput); v != "" {
+		p.Output = v
+	}
+	if p.Server == "" {
+		p.Server = DefaultServer
+	}
+	p.Server = strings.TrimRight(p.Server, "/")
+	if p.Auth == "" {
+		p.Auth = AuthKeyring
+	}
+	if p.Output == "" {
+		p.Output = DefaultOutput
+	}
+	return p
+}
+
+// Config is the configuration file of the CLI.
+type Config struct {
+	// Current is the name of the profile used when none is given.
+	Current string `yaml:"current,omitempty"`
+	// Profiles are the named profiles.
+	Profiles map[string]Profile `yaml:"profiles,omitempty"`
+}
+
+// Path returns the path of the configuration file, the EnvConfig environment variable if set,
+// otherwise config.yaml in the extendz directory of the os.UserConfigDir.
+func Path() (string, error) {
+	if path := os.Getenv(EnvConfig); path != "" {
+		return path, nil
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "extendz", "config.yaml"), nil
+}
+
+// Load the Config from the file at the path, an empty Config if the file doesn't exist.
+func Load(path string) (*Config, error) {
+	c := &Config{}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := yaml.Unmarshal(data, c); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	for name, p := range c.Profiles {
+		if err := p.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid profile %q in %s: %w", name, path, err)
+		}
+	}
+	return c, nil
+}
+
+// Save the Config to the file at the path, creating the directory of the file if necessary.
+//
+// The file is only readable by the current user, since it may contain credentials.
+func (c *Config) Save(path string) error {
+	var b bytes.Buffer
+	e := yaml.NewEncoder(&b)
+	e.SetIndent(2)
+	if err := e.Encode(c); err != nil {
+		return err
+	}
+	if err := e.Close(); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	return os.WriteFile(path, b.Bytes(), 0o600)
+}
+
+// Names returns the sorted names of the profiles.
+func (c *Config) Names() []string {
+	names := make([]string, 0, len(c.Profiles))
+	for name := range c.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Set the profile with the name, replacing any existing profile with the name. The profile becomes
+// the Config.Current profile if there is none.
+func (c *Config) Set(name string, p Profile) error {
+	if name == "" {
+		return errors.New("the profile name must be set")
+	}
+	if err := p.Validate(); err != nil {
+		return err
+	}
+	if c.Profiles == nil {
+		c.Profiles = make(map[string]Profile)
+	}
+	c.Profiles[name] = p
+	if c.Current == "" {
+		c.Current = name
+	}
+	return nil
+}
+
+// Use the profile with the name as the Config.Current profile.
+func (c *Config) Use(name string) error {
+	if _, ok := c.Profiles[name]; !ok {
+		return fmt.Errorf("%w %q", ErrUnknownProfile, name)
+	}
+	c.Current = name
+	return nil
+}
+
+// Selected returns the name of the profile used for the name, the name itself, otherwise the
+// Config.Current profile, otherwise the DefaultProfile.
+func (c *Config) Selected(name string) string {
+	switch {
+	case name != "":
+		return name
+	case c.Current != "":
+		return c.Current
+	default:
+		return DefaultProfile
+	}
+}
+
+// Profile returns the profile with the name, or the Config.Current profile if the name is empty.
+//
+// ErrUnknownProfile is returned if the named profile doesn't exist, unless no name was given, in
+// which case an empty Profile (using the defaults) is returned.
+func (c *Config) Profile(name string) (Profile, error) {
+	explicit := name != "" || c.Current != ""
+	name = c.Selected(name)
+	p, ok := c.Profiles[name]
+	if !ok && explicit {
+		return Profile{}, fmt.Errorf("%w %q", ErrUnknownProfile, name)
+	}
+	return p, nil
+}
@@ -0,0 +1,133 @@
+// Copyright 2022 c-fraser
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestSaveLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "extendz", "config.yaml")
+	c, err := Load(path)
+	if err != nil {
+		t.Fatalf("Failed to load missing config: %v", err)
+	}
+	if len(c.Profiles) != 0 {
+		t.Errorf("Unexpected profiles: %v", c.Profiles)
+	}
+	production := Profile{Email: "ops@example.com", Output: "table"}
+	sandbox := Profile{Server: "https://sandbox.example.com", Email: "ops+sandbox@example.com", Auth: AuthEnv}
+	if err := c.Set("production", production); err != nil {
+		t.Fatalf("Failed to set profile: %v", err)
+	}
+	if err := c.Set("sandbox", sandbox); err != nil {
+		t.Fatalf("Failed to set profile: %v", err)
+	}
+	if err := c.Save(path); err != nil {
+		t.Fatalf("Failed to save config: %v", err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Failed to stat config: %v", err)
+	}
+	if mode := info.Mode().Perm(); mode != 0o600 {
+		t.Errorf("Unexpected config file mode: %v", mode)
+	}
+	loaded, err := Load(path)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	if !reflect.DeepEqual(loaded, c) {
+		t.Errorf("Unexpected config, expected: %v, actual: %v", c, loaded)
+	}
+	if loaded.Current != "production" {
+		t.Errorf("Unexpected current profile: %s", loaded.Current)
+	}
+	if names := loaded.Names(); !reflect.DeepEqual(names, []string{"production", "sandbox"}) {
+		t.Errorf("Unexpected profile names: %v", names)
+	}
+}
+
+func TestLoadInvalid(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte("profiles:\n  p:\n    auth: plaintext\n"), 0o600); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+	if _, err := Load(path); err == nil {
+		t.Errorf("Unexpected load of config with unknown auth")
+	}
+}
+
+func TestProfile(t *testing.T) {
+	c := &Config{}
+	p, err := c.Profile("")
+	if err != nil {
+		t.Errorf("Failed to get default profile: %v", err)
+	}
+	if p != (Profile{}) {
+		t.Errorf("Unexpected default profile: %v", p)
+	}
+	if _, err := c.Profile("sandbox"); !errors.Is(err, ErrUnknownProfile) {
+		t.Errorf("Unexpected error for unknown profile: %v", err)
+	}
+	if err := c.Set("sandbox", Profile{Server: "https://sandbox.example.com"}); err != nil {
+		t.Fatalf("Failed to set profile: %v", err)
+	}
+	if err := c.Set("production", Profile{}); err != nil {
+		t.Fatalf("Failed to set profile: %v", err)
+	}
+	p, err = c.Profile("")
+	if err != nil {
+		t.Errorf("Failed to get current profile: %v", err)
+	}
+	if p.Server != "https://sandbox.example.com" {
+		t.Errorf("Unexpected current profile: %v", p)
+	}
+	if err := c.Use("production"); err != nil {
+		t.Errorf("Failed to use profile: %v", err)
+	}
+	if err := c.Use("staging"); !errors.Is(err, ErrUnknownProfile) {
+		t.Errorf("Unexpected error for unknown profile: %v", err)
+	}
+	if err := c.Set("staging", Profile{Server: "api.example.com"}); err == nil {
+		t.Errorf("Unexpected set of profile with malformed server")
+	}
+	if err := c.Set("staging", Profile{Auth: AuthCommand}); err == nil {
+		t.Errorf("Unexpected set of profile without password command")
+	}
+}
+
+func TestOverride(t *testing.T) {
+	env := map[string]string{EnvEmail: "env@example.com", EnvOutput: "yaml"}
+	p := Profile{Server: "https://sandbox.example.com/", Email: "ops@example.com"}.
+		Override(func(key string) string { return env[key] })
+	expected := Profile{
+		Server: "https://sandbox.example.com",
+		Email:  "env@example.com",
+		Auth:   AuthKeyring,
+		Output: "yaml",
+	}
+	if p != expected {
+		t.Errorf("Unexpected profile, expected: %v, actual: %v", expected, p)
+	}
+	p = Profile{}.Override(func(string) string { return "" })
+	if p.Server != DefaultServer || p.Output != DefaultOutput {
+		t.Errorf("Unexpected default profile: %v", p)
+	}
+}
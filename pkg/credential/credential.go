@@ -0,0 +1,324 @@
+// Copyright 2022 c-fraser
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package credential contains the sources, and stores, of the passwords of Extend API accounts.
+package credential
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/zalando/go-keyring"
+	"golang.org/x/crypto/scrypt"
+	"golang.org/x/term"
+)
+
+// ErrNotFound is returned when there is no password for an account.
+var ErrNotFound = errors.New("credential not found")
+
+// Source gets the password of an account.
+type Source interface {
+	// Get the password of the account, ErrNotFound if there is none.
+	Get(account string) (string, error)
+}
+
+// Store is a Source which also stores the passwords of accounts.
+type Store interface {
+	Source
+	// Set the password of the account.
+	Set(account, password string) error
+	// Delete the password of the account, ErrNotFound if there is none.
+	Delete(account string) error
+}
+
+// Account returns the account name of the email on the Extend API server, e.g.
+// ops@example.com@api.paywithextend.com.
+func Account(server, email string) string {
+	host := server
+	if u, err := url.Parse(server); err == nil && u.Host != "" {
+		host = u.Host
+	}
+	return email + "@" + host
+}
+
+// Keyring returns a Store of the passwords in the OS keyring, the Secret Service on Linux, the
+// Keychain on macOS and the Credential Manager on Windows, under the service name.
+func Keyring(service string) Store {
+	return keyringStore(service)
+}
+
+type keyringStore string
+
+func (s keyringStore) Get(account string) (string, error) {
+	password, err := keyring.Get(string(s), account)
+	if errors.Is(err, keyring.ErrNotFound) {
+		return "", ErrNotFound
+	}
+	return password, err
+}
+
+func (s keyringStore) Set(account, password string) error {
+	return keyring.Set(string(s), account, password)
+}
+
+func (s keyringStore) Delete(account string) error {
+	err := keyring.Delete(string(s), account)
+	if errors.Is(err, keyring.ErrNotFound) {
+		return ErrNotFound
+	}
+	return err
+}
+
+// File returns a Store of the passwords in the file at the path, encrypted (AES-GCM) with a key
+// derived (scrypt) from the passphrase. The passphrase is requested at most once.
+//
+// The file is the fallback for systems without a keyring, e.g. headless servers.
+func File(path string, passphrase func() ([]byte, error)) Store {
+	return &fileStore{path: path, passphrase: passphrase}
+}
+
+type fileStore struct {
+	path       string
+	passphrase func() ([]byte, error)
+	secret     []byte
+}
+
+// sealed is the content of the file of a fileStore.
+type sealed struct {
+	Salt  []byte `json:"salt"`
+	Nonce []byte `json:"nonce"`
+	Data  []byte `json:"data"`
+}
+
+func (s *fileStore) Get(account string) (string, error) {
+	passwords, err := s.read()
+	if err != nil {
+		return "", err
+	}
+	password, ok := passwords[account]
+	if !ok {
+		return "", ErrNotFound
+	}
+	return password, nil
+}
+
+func (s *fileStore) Set(account, password string) error {
+	passwords, err := s.read()
+	if err != nil {
+		return err
+	}
+	passwords[account] = password
+	return s.write(passwords)
+}
+
+func (s *fileStore) Delete(account string) error {
+	passwords, err := s.read()
+	if err != nil {
+		return err
+	}
+	if _, ok := passwords[account]; !ok {
+		return ErrNotFound
+	}
+	delete(passwords, account)
+	return s.write(passwords)
+}
+
+// read and decrypt the passwords in the file, none if the file doesn't exist.
+func (s *fileStore) read() (map[string]string, error) {
+	passwords := make(map[string]string)
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return passwords, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var content sealed
+	if err := json.Unmarshal(data, &content); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", s.path, err)
+	}
+	aead, err := s.cipher(content.Salt)
+	if err != nil {
+		return nil, err
+	}
+	if len(content.Nonce) != aead.NonceSize() {
+		return nil, fmt.Errorf("failed to parse %s: invalid nonce", s.path)
+	}
+	plaintext, err := aead.Open(nil, content.Nonce, content.Data, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt %s, the passphrase may be incorrect", s.path)
+	}
+	if err := json.Unmarshal(plaintext, &passwords); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", s.path, err)
+	}
+	return passwords, nil
+}
+
+// write the passwords, encrypted with a new salt and nonce, to the file.
+func (s *fileStore) write(passwords map[string]string) error {
+	plaintext, err := json.Marshal(passwords)
+	if err != nil {
+		return err
+	}
+	content := sealed{Salt: make([]byte, 16)}
+	if _, err := rand.Read(content.Salt); err != nil {
+		return err
+	}
+	aead, err := s.cipher(content.Salt)
+	if err != nil {
+		return err
+	}
+	content.Nonce = make([]byte, aead.NonceSize())
+	if _, err := rand.Read(content.Nonce); err != nil {
+		return err
+	}
+	content.Data = aead.Seal(nil, content.Nonce, plaintext, nil)
+	data, err := json.Marshal(content)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o700); err != nil {
+		return err
+	}
+	return os.WriteFile(s.path, data, 0o600)
+}
+
+// cipher returns the AES-GCM cipher of the key derived from the passphrase and salt.
+func (s *fileStore) cipher(salt []byte) (cipher.AEAD, error) {
+	if s.secret == nil {
+		secret, err := s.passphrase()
+		if err != nil {
+			return nil, err
+		}
+		if len(secret) == 0 {
+			return nil, errors.New("the passphrase must not be empty")
+		}
+		s.secret = secret
+	}
+	key, err := scrypt.Key(s.secret, salt, 1<<15, 8, 1, 32)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// EnvAccount is the environment variable with the account name, which is set for the command of
+// the Command Source.
+const EnvAccount = "EXTENDZ_ACCOUNT"
+
+// Command returns a Source of the passwords printed by the (shell) command, e.g.
+// `pass show extend/$EXTENDZ_ACCOUNT`. The trailing newline of the output is removed.
+func Command(command string) Source {
+	return commandSource(command)
+}
+
+type commandSource string
+
+func (s commandSource) Get(account string) (string, error) {
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.Command("cmd", "/C", string(s))
+	} else {
+		cmd = exec.Command("sh", "-c", string(s))
+	}
+	cmd.Env = append(os.Environ(), EnvAccount+"="+account)
+	cmd.Stdin = os.Stdin
+	cmd.Stderr = os.Stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to run the password command: %w", err)
+	}
+	password := strings.TrimRight(string(output), "\r\n")
+	if password == "" {
+		return "", ErrNotFound
+	}
+	return password, nil
+}
+
+// Prompt returns a Source of the passwords read from in, after a prompt is written to out. The
+// password isn't echoed if in is a terminal.
+func Prompt(in *os.File, out io.Writer) Source {
+	return promptSource{in: in, out: out}
+}
+
+type promptSource struct {
+	in  *os.File
+	out io.Writer
+}
+
+func (s promptSource) Get(account string) (string, error) {
+	if _, err := fmt.Fprintf(s.out, "Password for %s: ", account); err != nil {
+		return "", err
+	}
+	password, err := ReadSecret(s.in, s.out)
+	if err != nil {
+		return "", err
+	}
+	if password == "" {
+		return "", ErrNotFound
+	}
+	return password, nil
+}
+
+// ReadSecret reads a line from in, without echo if in is a terminal (in which case the newline is
+// written to out).
+func ReadSecret(in *os.File, out io.Writer) (string, error) {
+	if fd := int(in.Fd()); term.IsTerminal(fd) {
+		secret, err := term.ReadPassword(fd)
+		_, _ = fmt.Fprintln(out)
+		return string(secret), err
+	}
+	return ReadLine(in)
+}
+
+// ReadLine reads a line, without the line terminator, from the reader.
+//
+// The reader is read byte by byte, so nothing after the line is consumed.
+func ReadLine(r io.Reader) (string, error) {
+	var line bytes.Buffer
+	b := make([]byte, 1)
+	for {
+		n, err := r.Read(b)
+		if n == 1 {
+			if b[0] == '\n' {
+				break
+			}
+			line.WriteByte(b[0])
+			continue
+		}
+		if errors.Is(err, io.EOF) && line.Len() > 0 {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+	return strings.TrimRight(line.String(), "\r"), nil
+}
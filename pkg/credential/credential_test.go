@@ -0,0 +1,131 @@
+// Copyright 2022 c-fraser
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package credential
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/zalando/go-keyring"
+)
+
+const testAccount = "_@gmail.com@api.paywithextend.com"
+
+func TestAccount(t *testing.T) {
+	if account := Account("https://api.paywithextend.com", "_@gmail.com"); account != testAccount {
+		t.Errorf("Unexpected account: %s", account)
+	}
+}
+
+func TestKeyring(t *testing.T) {
+	keyring.MockInit()
+	testStore(t, Keyring("extendz"))
+}
+
+func TestFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "credentials")
+	prompts := 0
+	passphrase := func(secret string) func() ([]byte, error) {
+		return func() ([]byte, error) {
+			prompts++
+			return []byte(secret), nil
+		}
+	}
+	testStore(t, File(path, passphrase("s3cr3t")))
+	if prompts != 1 {
+		t.Errorf("Unexpected passphrase prompts: %d", prompts)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read credentials file: %v", err)
+	}
+	if strings.Contains(string(data), testAccount) {
+		t.Errorf("Unexpected plaintext in credentials file: %s", data)
+	}
+	if _, err := File(path, passphrase("wrong")).Get(testAccount); err == nil {
+		t.Errorf("Unexpected decryption with wrong passphrase")
+	}
+}
+
+func TestCommand(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the command is a POSIX shell command")
+	}
+	password, err := Command(`echo "secret-$` + EnvAccount + `"`).Get(testAccount)
+	if err != nil {
+		t.Errorf("Failed to run password command: %v", err)
+	}
+	if password != "secret-"+testAccount {
+		t.Errorf("Unexpected password: %s", password)
+	}
+	if _, err := Command("exit 1").Get(testAccount); err == nil {
+		t.Errorf("Unexpected password from failed command")
+	}
+}
+
+func TestPrompt(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("Failed to create pipe: %v", err)
+	}
+	defer r.Close()
+	_, _ = io.WriteString(w, "_@gmail.com\nP4$sW0rD\r\n")
+	_ = w.Close()
+	email, err := ReadLine(r)
+	if err != nil || email != "_@gmail.com" {
+		t.Errorf("Unexpected email: %s, %v", email, err)
+	}
+	var out strings.Builder
+	password, err := Prompt(r, &out).Get(testAccount)
+	if err != nil {
+		t.Errorf("Failed to read password: %v", err)
+	}
+	if password != "P4$sW0rD" {
+		t.Errorf("Unexpected password: %s", password)
+	}
+	if out.String() != "Password for "+testAccount+": " {
+		t.Errorf("Unexpected prompt: %s", out.String())
+	}
+}
+
+func testStore(t *testing.T, store Store) {
+	if _, err := store.Get(testAccount); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Unexpected error for missing password: %v", err)
+	}
+	if err := store.Set(testAccount, "P4$sW0rD"); err != nil {
+		t.Fatalf("Failed to set password: %v", err)
+	}
+	password, err := store.Get(testAccount)
+	if err != nil {
+		t.Errorf("Failed to get password: %v", err)
+	}
+	if password != "P4$sW0rD" {
+		t.Errorf("Unexpected password: %s", password)
+	}
+	if err := store.Delete(testAccount); err != nil {
+		t.Errorf("Failed to delete password: %v", err)
+	}
+	if err := store.Delete(testAccount); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Unexpected error for deleted password: %v", err)
+	}
+	if err := store.Set(testAccount, "P4$sW0rD"); err != nil {
+		t.Errorf("Failed to set password: %v", err)
+	}
+}
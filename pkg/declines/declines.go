@@ -0,0 +1,371 @@
+// Copyright 2022 c-fraser
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package declines analyzes declined transactions, to explain why they were declined, and how to
+// fix the virtual cards so similar transactions are approved.
+//
+// The Cause of a decline is determined by its decline reason codes (and descriptions), or else
+// inferred from the virtual card, e.g. a merchant category which isn't in the valid MCC ranges of
+// the virtual card.
+package declines
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/c-fraser/extendz/pkg/client"
+	"github.com/c-fraser/extendz/pkg/mcc"
+)
+
+// Cause is the cause of a declined transaction.
+type Cause string
+
+const (
+	// Limit is a transaction which exceeds the balance of the virtual card.
+	Limit Cause = "limit"
+	// Mcc is a transaction of a merchant category which isn't allowed by the virtual card.
+	Mcc Cause = "mcc"
+	// NotYetValid is a transaction before the ValidFrom of the virtual card.
+	NotYetValid Cause = "not-yet-valid"
+	// Expired is a transaction after the ValidTo, or expiration, of the virtual card.
+	Expired Cause = "expired"
+	// Inactive is a transaction of a virtual card which isn't active, e.g. cancelled.
+	Inactive Cause = "inactive"
+	// Address is a transaction whose billing address didn't match the virtual card.
+	Address Cause = "address"
+	// SecurityCode is a transaction whose security code (CVV) was incorrect.
+	SecurityCode Cause = "security-code"
+	// Unknown is a transaction whose cause isn't known.
+	Unknown Cause = "unknown"
+)
+
+// Causes returns the Cause values.
+func Causes() []Cause {
+	return []Cause{Limit, Mcc, NotYetValid, Expired, Inactive, Address, SecurityCode, Unknown}
+}
+
+// codes are the Cause of the known decline reason codes.
+var codes = map[string]Cause{
+	"INSUFFICIENT_FUNDS":     Limit,
+	"INSUFFICIENT_BALANCE":   Limit,
+	"EXCEEDS_LIMIT":          Limit,
+	"OVER_LIMIT":             Limit,
+	"LIMIT_EXCEEDED":         Limit,
+	"MCC_NOT_ALLOWED":        Mcc,
+	"MCC_BLOCKED":            Mcc,
+	"INVALID_MCC":            Mcc,
+	"MERCHANT_NOT_ALLOWED":   Mcc,
+	"CARD_NOT_YET_VALID":     NotYetValid,
+	"NOT_YET_VALID":          NotYetValid,
+	"BEFORE_VALID_FROM":      NotYetValid,
+	"CARD_EXPIRED":           Expired,
+	"EXPIRED_CARD":           Expired,
+	"AFTER_VALID_TO":         Expired,
+	"CARD_CANCELLED":         Inactive,
+	"CARD_CLOSED":            Inactive,
+	"CARD_INACTIVE":          Inactive,
+	"CARD_NOT_ACTIVE":        Inactive,
+	"AVS_FAIL":               Address,
+	"ADDRESS_MISMATCH":       Address,
+	"CVV_FAIL":               SecurityCode,
+	"INVALID_CVV":            SecurityCode,
+	"INCORRECT_CVV":          SecurityCode,
+	"SECURITY_CODE_MISMATCH": SecurityCode,
+}
+
+// keywords are the Cause of the keywords of the decline reason descriptions, in order of precedence.
+var keywords = []struct {
+	keyword string
+	cause   Cause
+}{
+	{"insufficient", Limit},
+	{"limit", Limit},
+	{"balance", Limit},
+	{"mcc", Mcc},
+	{"merchant category", Mcc},
+	{"not yet valid", NotYetValid},
+	{"expired", Expired},
+	{"cancelled", Inactive},
+	{"inactive", Inactive},
+	{"address", Address},
+	{"avs", Address},
+	{"cvv", SecurityCode},
+	{"security code", SecurityCode},
+}
+
+// Decline is a declined transaction, and its Cause.
+type Decline struct {
+	Transaction client.Transaction `json:"transaction"`
+	Cause       Cause              `json:"cause"`
+}
+
+// Classify returns the Decline of the declined transaction of the virtual card.
+func Classify(vc client.VirtualCard, tx client.Transaction) Decline {
+	for _, r := range tx.DeclineReasons {
+		if cause, ok := codes[strings.ToUpper(r.Code)]; ok {
+			return Decline{Transaction: tx, Cause: cause}
+		}
+	}
+	for _, r := range tx.DeclineReasons {
+		description := strings.ToLower(r.Description)
+		for _, k := range keywords {
+			if strings.Contains(description, k.keyword) {
+				return Decline{Transaction: tx, Cause: k.cause}
+			}
+		}
+	}
+	return Decline{Transaction: tx, Cause: infer(vc, tx)}
+}
+
+// infer returns the Cause of the declined transaction per the virtual card.
+func infer(vc client.VirtualCard, tx client.Transaction) Cause {
+	at := tx.AuthedAt
+	switch {
+	case tx.Status == client.TransactionStatusAvsFail:
+		return Address
+	case tx.Mcc != "" && !mcc.Allowed(vc, tx.Mcc):
+		return Mcc
+	case !at.IsZero() && !vc.ValidFrom.IsZero() && at.Before(vc.ValidFrom.Time):
+		return NotYetValid
+	case !at.IsZero() && !vc.ValidTo.IsZero() && at.After(vc.ValidTo.Time):
+		return Expired
+	case vc.Status != "" && vc.Status != client.VirtualCardStatusActive &&
+		(vc.InactiveSince.IsZero() || at.IsZero() || !at.Before(vc.InactiveSince.Time)):
+		return Inactive
+	case tx.AuthBillingAmountCents > vc.BalanceCents:
+		return Limit
+	default:
+		return Unknown
+	}
+}
+
+// Report is the analysis of the declined transactions.
+type Report struct {
+	// Declines is the number of declined transactions.
+	Declines int `json:"declines"`
+	// ByCause groups the declines by Cause.
+	ByCause []Group `json:"byCause"`
+	// ByReason groups the declines by decline reason code.
+	ByReason []Group `json:"byReason"`
+	// ByMerchant groups the declines by merchant name.
+	ByMerchant []Group `json:"byMerchant"`
+	// ByMcc groups the declines by merchant category code.
+	ByMcc []Group `json:"byMcc"`
+	// Fixes are the fixes of the virtual cards, by virtual card and Cause.
+	Fixes []Fix `json:"fixes"`
+}
+
+// Group is the declined transactions with the same key, e.g. merchant.
+type Group struct {
+	Key         string `json:"key"`
+	Description string `json:"description,omitempty"`
+	// Declines is the number of declined transactions.
+	Declines int `json:"declines"`
+	// Cards are the IDs of the virtual cards of the declined transactions.
+	Cards []string `json:"cards"`
+}
+
+// Fix is the action which prevents declines of a Cause for a virtual card.
+type Fix struct {
+	CardID   string `json:"cardId"`
+	CardName string `json:"cardName"`
+	Cause    Cause  `json:"cause"`
+	// Action describes the fix.
+	Action string `json:"action"`
+	// Transactions are the IDs of the declined transactions fixed.
+	Transactions []string `json:"transactions"`
+	// Update is the update of the virtual card which fixes the declines, nil if the fix isn't an
+	// update of the virtual card.
+	Update *client.UpdateVirtualCardRequest `json:"update,omitempty"`
+}
+
+// Analyze returns the Report of the declined transactions of the virtual cards. The transactions
+// which weren't declined, or whose virtual card isn't one of the cards, are ignored.
+func Analyze(cards []client.VirtualCard, transactions []client.Transaction) *Report {
+	byID := make(map[string]client.VirtualCard, len(cards))
+	for _, vc := range cards {
+		byID[vc.ID] = vc
+	}
+	var (
+		report   Report
+		cause    = newGrouping()
+		reason   = newGrouping()
+		merchant = newGrouping()
+		category = newGrouping()
+		declines = make(map[string][]Decline)
+		order    []string
+	)
+	for _, tx := range transactions {
+		vc, ok := byID[tx.VirtualCardID]
+		if !ok || !declined(tx) {
+			continue
+		}
+		d := Classify(vc, tx)
+		report.Declines++
+		cause.add(string(d.Cause), "", vc.ID)
+		if len(tx.DeclineReasons) == 0 {
+			reason.add("", "", vc.ID)
+		}
+		for _, r := range tx.DeclineReasons {
+			reason.add(r.Code, r.Description, vc.ID)
+		}
+		merchant.add(tx.MerchantName, tx.MerchantCity, vc.ID)
+		category.add(tx.Mcc, tx.MccDescription, vc.ID)
+		key := vc.ID + "/" + string(d.Cause)
+		if _, ok := declines[key]; !ok {
+			order = append(order, key)
+		}
+		declines[key] = append(declines[key], d)
+	}
+	report.ByCause = cause.groups()
+	report.ByReason = reason.groups()
+	report.ByMerchant = merchant.groups()
+	report.ByMcc = category.groups()
+	for _, key := range order {
+		ds := declines[key]
+		vc := byID[ds[0].Transaction.VirtualCardID]
+		report.Fixes = append(report.Fixes, fix(vc, ds[0].Cause, ds))
+	}
+	return &report
+}
+
+// declined returns whether the transaction was declined.
+func declined(tx client.Transaction) bool {
+	return tx.Status == client.TransactionStatusDeclined ||
+		tx.Status == client.TransactionStatusAvsFail ||
+		len(tx.DeclineReasons) > 0
+}
+
+// fix returns the Fix of the declines of the Cause of the virtual card.
+func fix(vc client.VirtualCard, cause Cause, declines []Decline) Fix {
+	f := Fix{CardID: vc.ID, CardName: vc.DisplayName, Cause: cause}
+	for _, d := range declines {
+		f.Transactions = append(f.Transactions, d.Transaction.ID)
+	}
+	switch cause {
+	case Limit:
+		shortfall := 0
+		for _, d := range declines {
+			shortfall = max(shortfall, d.Transaction.AuthBillingAmountCents-vc.BalanceCents)
+		}
+		if shortfall <= 0 {
+			f.Action = fmt.Sprintf("the balance %s now covers the declined amounts", vc.Balance())
+			break
+		}
+		limit := client.NewMoney(int64(vc.LimitCents+shortfall), vc.Currency)
+		f.Action = fmt.Sprintf("raise the limit from %s to %s", vc.Limit(), limit)
+		f.Update = &client.UpdateVirtualCardRequest{
+			BalanceCents: client.Ptr(vc.LimitCents + shortfall),
+			Currency:     client.Ptr(vc.Currency),
+		}
+	case Mcc:
+		ranges := append([]client.MccRange(nil), vc.ValidMccRanges...)
+		var added []string
+		for _, d := range declines {
+			code := d.Transaction.Mcc
+			if code == "" || mcc.Allowed(client.VirtualCard{ValidMccRanges: ranges}, code) {
+				continue
+			}
+			r := client.MccRange{Lowest: code, Highest: code}
+			if c, ok := mcc.Lookup(code); ok {
+				r = c.Range()
+			}
+			ranges = append(ranges, r)
+			added = append(added, describe(r))
+		}
+		normalized, err := mcc.Normalize(ranges)
+		if len(added) == 0 || err != nil {
+			f.Action = "allow the merchant category of the merchant"
+			break
+		}
+		f.Action = "MCC not allowed, add the range " + strings.Join(added, ", ")
+		f.Update = &client.UpdateVirtualCardRequest{ValidMccRanges: &normalized}
+	case NotYetValid:
+		earliest := declines[0].Transaction.AuthedAt.Time
+		for _, d := range declines[1:] {
+			if at := d.Transaction.AuthedAt.Time; at.Before(earliest) {
+				earliest = at
+			}
+		}
+		if earliest.IsZero() {
+			f.Action = "card not yet valid, move the validFrom earlier"
+			break
+		}
+		from := client.NewTimestamp(earliest.UTC().Truncate(24 * time.Hour))
+		f.Action = fmt.Sprintf("card not yet valid, move the validFrom from %s to %s", vc.ValidFrom, from)
+		f.Update = &client.UpdateVirtualCardRequest{ValidFrom: &from}
+	case Expired:
+		f.Action = fmt.Sprintf("card expired, extend the validTo (%s) if the card is still used", vc.ValidTo)
+	case Inactive:
+		f.Action = fmt.Sprintf("card is %s, issue a new card if the merchant is expected", vc.Status)
+	case Address:
+		f.Action = "verify the billing address given to the merchant"
+	case SecurityCode:
+		f.Action = "verify the security code given to the merchant"
+	default:
+		f.Action = "contact Extend support with the transaction IDs"
+	}
+	return f
+}
+
+// describe returns the MCC range as text, e.g. "5811-5814", or "5812".
+func describe(r client.MccRange) string {
+	if r.Lowest == r.Highest {
+		return r.Lowest
+	}
+	return r.Lowest + "-" + r.Highest
+}
+
+// grouping accumulates the groups of the declines.
+type grouping struct {
+	byKey map[string]*Group
+	cards map[string]map[string]bool
+}
+
+// newGrouping returns an empty grouping.
+func newGrouping() *grouping {
+	return &grouping{byKey: make(map[string]*Group), cards: make(map[string]map[string]bool)}
+}
+
+// add a decline of the virtual card to the group of the key.
+func (g *grouping) add(key, description, card string) {
+	group, ok := g.byKey[key]
+	if !ok {
+		group = &Group{Key: key, Description: description}
+		g.byKey[key] = group
+		g.cards[key] = make(map[string]bool)
+	}
+	group.Declines++
+	if !g.cards[key][card] {
+		g.cards[key][card] = true
+		group.Cards = append(group.Cards, card)
+	}
+}
+
+// groups returns the groups, by descending number of declines, then key.
+func (g *grouping) groups() []Group {
+	groups := make([]Group, 0, len(g.byKey))
+	for _, group := range g.byKey {
+		groups = append(groups, *group)
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		if groups[i].Declines != groups[j].Declines {
+			return groups[i].Declines > groups[j].Declines
+		}
+		return groups[i].Key < groups[j].Key
+	})
+	return groups
+}
@@ -0,0 +1,104 @@
+// Copyright 2022 c-fraser
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package declines
+
+import (
+	"testing"
+	"time"
+
+	"github.com/c-fraser/extendz/pkg/client"
+)
+
+func TestClassify(t *testing.T) {
+	now := time.Date(2024, time.January, 10, 12, 0, 0, 0, time.UTC)
+	vc := client.VirtualCard{
+		ID:             "vc_1",
+		Status:         client.VirtualCardStatusActive,
+		BalanceCents:   1000,
+		ValidFrom:      client.NewTimestamp(now.Add(-24 * time.Hour)),
+		ValidTo:        client.NewTimestamp(now.Add(24 * time.Hour)),
+		ValidMccRanges: []client.MccRange{{Lowest: "5811", Highest: "5814"}},
+	}
+	for _, test := range []struct {
+		tx    client.Transaction
+		cause Cause
+	}{
+		{client.Transaction{DeclineReasons: []client.DeclineReason{{Code: "insufficient_funds"}}}, Limit},
+		{client.Transaction{DeclineReasons: []client.DeclineReason{{Code: "X1", Description: "Incorrect CVV"}}}, SecurityCode},
+		{client.Transaction{Mcc: "5411", AuthedAt: client.NewTimestamp(now)}, Mcc},
+		{client.Transaction{Mcc: "5812", AuthedAt: client.NewTimestamp(now.Add(-48 * time.Hour))}, NotYetValid},
+		{client.Transaction{Mcc: "5812", AuthedAt: client.NewTimestamp(now.Add(48 * time.Hour))}, Expired},
+		{client.Transaction{Mcc: "5812", AuthedAt: client.NewTimestamp(now), AuthBillingAmountCents: 2000}, Limit},
+		{client.Transaction{Status: client.TransactionStatusAvsFail}, Address},
+		{client.Transaction{Mcc: "5812", AuthedAt: client.NewTimestamp(now), AuthBillingAmountCents: 500}, Unknown},
+	} {
+		if d := Classify(vc, test.tx); d.Cause != test.cause {
+			t.Errorf("Unexpected cause of %+v: %s", test.tx, d.Cause)
+		}
+	}
+}
+
+func TestAnalyze(t *testing.T) {
+	now := time.Date(2024, time.January, 10, 12, 0, 0, 0, time.UTC)
+	cards := []client.VirtualCard{
+		{
+			ID:             "vc_1",
+			DisplayName:    "Meals",
+			Status:         client.VirtualCardStatusActive,
+			Currency:       "USD",
+			LimitCents:     5000,
+			BalanceCents:   1000,
+			ValidMccRanges: []client.MccRange{{Lowest: "5811", Highest: "5814"}},
+		},
+		{
+			ID:          "vc_2",
+			DisplayName: "Event",
+			Status:      client.VirtualCardStatusActive,
+			Currency:    "USD",
+			LimitCents:  5000,
+			ValidFrom:   client.NewTimestamp(now.Add(72 * time.Hour)),
+		},
+	}
+	transactions := []client.Transaction{
+		{ID: "tx_1", VirtualCardID: "vc_1", Status: client.TransactionStatusDeclined, Mcc: "5812", MerchantName: "Diner", AuthBillingAmountCents: 1500, DeclineReasons: []client.DeclineReason{{Code: "OVER_LIMIT"}}},
+		{ID: "tx_2", VirtualCardID: "vc_1", Status: client.TransactionStatusDeclined, Mcc: "5812", MerchantName: "Diner", AuthBillingAmountCents: 2500, DeclineReasons: []client.DeclineReason{{Code: "OVER_LIMIT"}}},
+		{ID: "tx_3", VirtualCardID: "vc_1", Status: client.TransactionStatusDeclined, Mcc: "3501", MerchantName: "Hotel", AuthBillingAmountCents: 500},
+		{ID: "tx_4", VirtualCardID: "vc_2", Status: client.TransactionStatusDeclined, Mcc: "5812", MerchantName: "Diner", AuthedAt: client.NewTimestamp(now)},
+		{ID: "tx_5", VirtualCardID: "vc_1", Status: client.TransactionStatusCleared, Mcc: "5812", MerchantName: "Diner"},
+	}
+	report := Analyze(cards, transactions)
+	if report.Declines != 4 {
+		t.Errorf("Unexpected declines: %d", report.Declines)
+	}
+	if g := report.ByMerchant[0]; g.Key != "Diner" || g.Declines != 3 || len(g.Cards) != 2 {
+		t.Errorf("Unexpected merchant group: %+v", g)
+	}
+	if g := report.ByCause[0]; g.Key != string(Limit) || g.Declines != 2 {
+		t.Errorf("Unexpected cause group: %+v", g)
+	}
+	if len(report.Fixes) != 3 {
+		t.Fatalf("Unexpected fixes: %+v", report.Fixes)
+	}
+	limit, category, valid := report.Fixes[0], report.Fixes[1], report.Fixes[2]
+	if limit.Cause != Limit || limit.Update == nil || *limit.Update.BalanceCents != 6500 || len(limit.Transactions) != 2 {
+		t.Errorf("Unexpected limit fix: %+v", limit)
+	}
+	if category.Cause != Mcc || category.Update == nil || len(*category.Update.ValidMccRanges) != 2 {
+		t.Errorf("Unexpected MCC fix: %+v", category)
+	}
+	if valid.Cause != NotYetValid || valid.Update == nil || !valid.Update.ValidFrom.Equal(now.Truncate(24*time.Hour)) {
+		t.Errorf("Unexpected validity fix: %+v", valid)
+	}
+}
@@ -0,0 +1,132 @@
+// Copyright 2022 c-fraser
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package export
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/c-fraser/extendz/pkg/client"
+)
+
+// Column is a column of a CSV export.
+type Column struct {
+	// Name is the name of the column, in the header of the CSV.
+	Name string
+	// Value returns the value of the column for the transaction, with the dates in the location.
+	Value func(tx client.Transaction, loc *time.Location) string
+}
+
+// columns are the predefined Column values.
+var columns = []Column{
+	{"id", func(tx client.Transaction, _ *time.Location) string { return tx.ID }},
+	{"date", func(tx client.Transaction, loc *time.Location) string { return date(Date(tx), loc) }},
+	{"authed_at", func(tx client.Transaction, loc *time.Location) string { return date(tx.AuthedAt, loc) }},
+	{"cleared_at", func(tx client.Transaction, loc *time.Location) string { return date(tx.ClearedAt, loc) }},
+	{"status", func(tx client.Transaction, _ *time.Location) string { return string(tx.Status) }},
+	{"type", func(tx client.Transaction, _ *time.Location) string { return string(tx.Type) }},
+	{"amount", func(tx client.Transaction, _ *time.Location) string { return Amount(tx).Decimal() }},
+	{"currency", func(tx client.Transaction, _ *time.Location) string { return Amount(tx).Currency }},
+	{"merchant", func(tx client.Transaction, _ *time.Location) string { return tx.MerchantName }},
+	{"mcc", func(tx client.Transaction, _ *time.Location) string { return tx.Mcc }},
+	{"mcc_group", func(tx client.Transaction, _ *time.Location) string { return tx.MccGroup }},
+	{"mcc_description", func(tx client.Transaction, _ *time.Location) string { return tx.MccDescription }},
+	{"card_id", func(tx client.Transaction, _ *time.Location) string { return tx.VirtualCardID }},
+	{"card", func(tx client.Transaction, _ *time.Location) string { return tx.VcnDisplayName }},
+	{"last4", func(tx client.Transaction, _ *time.Location) string { return tx.VcnLast4 }},
+	{"cardholder", func(tx client.Transaction, _ *time.Location) string { return tx.CardholderName }},
+	{"approval_code", func(tx client.Transaction, _ *time.Location) string { return tx.ApprovalCode }},
+	{"reference_fields", func(tx client.Transaction, _ *time.Location) string { return Memo(tx) }},
+}
+
+// Columns returns the predefined Column values.
+func Columns() []Column {
+	return append([]Column(nil), columns...)
+}
+
+// DefaultColumns returns the Column values of a CSV export, unless configured WithColumns.
+func DefaultColumns() []Column {
+	c, _ := ParseColumns("id,date,status,type,amount,currency,merchant,mcc,mcc_description,card_id,card,reference_fields")
+	return c
+}
+
+// ParseColumns returns the predefined Column values of the comma-delimited names.
+func ParseColumns(names string) ([]Column, error) {
+	var parsed []Column
+	for _, name := range strings.Split(names, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		found := false
+		for _, c := range columns {
+			if c.Name == name {
+				parsed = append(parsed, c)
+				found = true
+				break
+			}
+		}
+		if !found {
+			known := make([]string, len(columns))
+			for i, c := range columns {
+				known[i] = c.Name
+			}
+			return nil, fmt.Errorf("unknown column %q, expected one of %s", name, strings.Join(known, ", "))
+		}
+	}
+	return parsed, nil
+}
+
+// csvWriter is the CSV Writer.
+type csvWriter struct {
+	w      *csv.Writer
+	config config
+}
+
+// newCSVWriter returns a CSV Writer, which writes the header.
+func newCSVWriter(w io.Writer, c config) (*csvWriter, error) {
+	header := make([]string, len(c.columns))
+	for i, column := range c.columns {
+		header[i] = column.Name
+	}
+	cw := &csvWriter{w: csv.NewWriter(w), config: c}
+	return cw, cw.w.Write(header)
+}
+
+// Write implements Writer.
+func (w *csvWriter) Write(tx client.Transaction) error {
+	record := make([]string, len(w.config.columns))
+	for i, column := range w.config.columns {
+		record[i] = column.Value(tx, w.config.location)
+	}
+	return w.w.Write(record)
+}
+
+// Close implements Writer.
+func (w *csvWriter) Close() error {
+	w.w.Flush()
+	return w.w.Error()
+}
+
+// date returns the Timestamp formatted per RFC 3339 in the location, or "" if it's zero.
+func date(t client.Timestamp, loc *time.Location) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.In(loc).Format(time.RFC3339)
+}
@@ -0,0 +1,148 @@
+// Copyright 2022 c-fraser
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package export writes transactions in the formats of accounting tools: CSV, OFX 2.x and QIF.
+//
+// The amount of a transaction is its clearing billing amount, or authorization billing amount if
+// it hasn't cleared, signed from the perspective of the cardholder: debits are negative and credits
+// are positive. Declined transactions are only written to CSV, since they don't move money.
+package export
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/c-fraser/extendz/pkg/client"
+)
+
+// Format is an export format.
+type Format string
+
+const (
+	CSV Format = "csv"
+	OFX Format = "ofx"
+	QIF Format = "qif"
+)
+
+// Formats returns the export formats.
+func Formats() []Format {
+	return []Format{CSV, OFX, QIF}
+}
+
+// Writer writes transactions in an export format.
+type Writer interface {
+	// Write writes the transaction.
+	Write(tx client.Transaction) error
+	// Close writes the end of the export, it doesn't close the underlying io.Writer.
+	Close() error
+}
+
+// config is the configuration of a Writer.
+type config struct {
+	columns  []Column
+	account  string
+	currency string
+	location *time.Location
+	now      func() time.Time
+}
+
+// Option configures a Writer.
+type Option func(c *config)
+
+// WithColumns configures the columns of a CSV Writer, which are the DefaultColumns otherwise.
+func WithColumns(columns ...Column) Option {
+	return func(c *config) {
+		c.columns = columns
+	}
+}
+
+// WithAccount configures the account ID, and currency, of the statement of an OFX Writer, which
+// are the credit card ID, and currency, of the first transaction otherwise.
+func WithAccount(id, currency string) Option {
+	return func(c *config) {
+		c.account = id
+		c.currency = currency
+	}
+}
+
+// WithLocation configures the time zone of the dates written, which is UTC otherwise.
+func WithLocation(loc *time.Location) Option {
+	return func(c *config) {
+		c.location = loc
+	}
+}
+
+// NewWriter returns a Writer of the format, which writes to the io.Writer.
+func NewWriter(w io.Writer, format Format, options ...Option) (Writer, error) {
+	c := config{columns: DefaultColumns(), location: time.UTC, now: time.Now}
+	for _, option := range options {
+		option(&c)
+	}
+	switch Format(strings.ToLower(string(format))) {
+	case CSV:
+		return newCSVWriter(w, c)
+	case OFX:
+		return &ofxWriter{w: w, config: c}, nil
+	case QIF:
+		return &qifWriter{w: w, config: c}, nil
+	default:
+		return nil, fmt.Errorf("unknown export format %q, expected one of csv, ofx, qif", format)
+	}
+}
+
+// Amount returns the (signed) amount of the transaction, which is the clearing billing amount, or
+// the authorization billing amount if the transaction hasn't cleared.
+func Amount(tx client.Transaction) client.Money {
+	m := tx.AuthBillingAmount()
+	if tx.Status == client.TransactionStatusCleared || !tx.ClearedAt.IsZero() || tx.ClearingBillingAmountCents != 0 {
+		m = tx.ClearingBillingAmount()
+	}
+	if m.IsNegative() || tx.Type == client.TransactionTypeCredit {
+		return m
+	}
+	return m.Neg()
+}
+
+// Date returns the date of the transaction, which is when it cleared, or was authorized if it
+// hasn't cleared.
+func Date(tx client.Transaction) client.Timestamp {
+	if !tx.ClearedAt.IsZero() {
+		return tx.ClearedAt
+	}
+	return tx.AuthedAt
+}
+
+// Memo returns the memo of the transaction, which is its reference fields, e.g.
+// "Department: Sales; Project: Apollo".
+func Memo(tx client.Transaction) string {
+	fields := make([]string, 0, len(tx.ReferenceFields))
+	for _, f := range tx.ReferenceFields {
+		label, option := f.FieldLabel, f.OptionLabel
+		if label == "" {
+			label = f.FieldCode
+		}
+		if option == "" {
+			option = f.OptionCode
+		}
+		fields = append(fields, label+": "+option)
+	}
+	return strings.Join(fields, "; ")
+}
+
+// posted returns whether the transaction moved money, i.e. wasn't declined.
+func posted(tx client.Transaction) bool {
+	return tx.Status != client.TransactionStatusDeclined
+}
@@ -0,0 +1,144 @@
+// Copyright 2022 c-fraser
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package export
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/c-fraser/extendz/pkg/client"
+)
+
+var transactions = []client.Transaction{
+	{
+		ID:                         "tx_1",
+		VirtualCardID:              "vc_1234",
+		CreditCardID:               "cc_1234",
+		Type:                       client.TransactionTypeDebit,
+		Status:                     client.TransactionStatusCleared,
+		AuthBillingAmountCents:     1200,
+		AuthBillingCurrency:        "USD",
+		ClearingBillingAmountCents: 1234,
+		ClearingBillingCurrency:    "USD",
+		MerchantName:               "Coffee & Co.",
+		Mcc:                        "5814",
+		MccDescription:             "Fast Food Restaurants",
+		AuthedAt:                   client.NewTimestamp(time.Date(2024, time.January, 2, 15, 4, 5, 0, time.UTC)),
+		ClearedAt:                  client.NewTimestamp(time.Date(2024, time.January, 3, 15, 4, 5, 0, time.UTC)),
+		ReferenceFields:            []client.ReferenceField{{FieldLabel: "Department", OptionCode: "SALES"}},
+	},
+	{
+		ID:                     "tx_2",
+		Type:                   client.TransactionTypeCredit,
+		Status:                 client.TransactionStatusPending,
+		AuthBillingAmountCents: 500,
+		AuthBillingCurrency:    "USD",
+		MerchantName:           "Refund",
+		AuthedAt:               client.NewTimestamp(time.Date(2024, time.January, 4, 0, 0, 0, 0, time.UTC)),
+	},
+	{
+		ID:                     "tx_3",
+		Type:                   client.TransactionTypeDebit,
+		Status:                 client.TransactionStatusDeclined,
+		AuthBillingAmountCents: 100000,
+		AuthBillingCurrency:    "USD",
+		AuthedAt:               client.NewTimestamp(time.Date(2024, time.January, 5, 0, 0, 0, 0, time.UTC)),
+	},
+}
+
+func export(t *testing.T, format Format, options ...Option) string {
+	var b bytes.Buffer
+	w, err := NewWriter(&b, format, options...)
+	if err != nil {
+		t.Fatalf("Failed to initialize %s writer: %v", format, err)
+	}
+	if ow, ok := w.(*ofxWriter); ok {
+		ow.config.now = func() time.Time { return time.Date(2024, time.February, 1, 0, 0, 0, 0, time.UTC) }
+	}
+	for _, tx := range transactions {
+		if err := w.Write(tx); err != nil {
+			t.Errorf("Failed to write %s transaction: %v", format, err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Errorf("Failed to close %s writer: %v", format, err)
+	}
+	return b.String()
+}
+
+func TestCSV(t *testing.T) {
+	columns, err := ParseColumns("id, date,amount,merchant,reference_fields")
+	if err != nil {
+		t.Fatalf("Failed to parse columns: %v", err)
+	}
+	expected := `id,date,amount,merchant,reference_fields
+tx_1,2024-01-03T15:04:05Z,-12.34,Coffee & Co.,Department: SALES
+tx_2,2024-01-04T00:00:00Z,5.00,Refund,
+tx_3,2024-01-05T00:00:00Z,-1000.00,,
+`
+	if actual := export(t, CSV, WithColumns(columns...)); actual != expected {
+		t.Errorf("Unexpected CSV:\n%s", actual)
+	}
+	if _, err := ParseColumns("id,balance"); err == nil {
+		t.Errorf("Unexpected unknown column")
+	}
+}
+
+func TestQIF(t *testing.T) {
+	expected := `!Type:CCard
+D01/03/2024
+T-12.34
+C*
+Ntx_1
+PCoffee & Co.
+MDepartment: SALES
+LFast Food Restaurants
+^
+D01/04/2024
+T5.00
+Ntx_2
+PRefund
+^
+`
+	if actual := export(t, QIF); actual != expected {
+		t.Errorf("Unexpected QIF:\n%s", actual)
+	}
+}
+
+func TestOFX(t *testing.T) {
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatalf("Failed to load location: %v", err)
+	}
+	actual := export(t, OFX, WithLocation(loc))
+	for _, expected := range []string{
+		`<?OFX OFXHEADER="200" VERSION="220"`,
+		"<CURDEF>USD</CURDEF><CCACCTFROM><ACCTID>cc_1234</ACCTID></CCACCTFROM>",
+		"<DTSTART>20240103100405.000[-5:EST]</DTSTART><DTEND>20240103190000.000[-5:EST]</DTEND>",
+		"<TRNTYPE>DEBIT</TRNTYPE><DTPOSTED>20240103100405.000[-5:EST]</DTPOSTED><DTUSER>20240102100405.000[-5:EST]</DTUSER><TRNAMT>-12.34</TRNAMT><FITID>tx_1</FITID><SIC>5814</SIC><NAME>Coffee &amp; Co.</NAME><MEMO>Department: SALES</MEMO>",
+		"<TRNTYPE>CREDIT</TRNTYPE>",
+		"<MEMO>PENDING</MEMO>",
+		"<LEDGERBAL><BALAMT>-7.34</BALAMT>",
+	} {
+		if !strings.Contains(actual, expected) {
+			t.Errorf("Expected OFX to contain %s:\n%s", expected, actual)
+		}
+	}
+	if strings.Contains(actual, "tx_3") {
+		t.Errorf("Unexpected declined transaction in OFX:\n%s", actual)
+	}
+}
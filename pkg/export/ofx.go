@@ -0,0 +1,151 @@
+// Copyright 2022 c-fraser
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package export
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/c-fraser/extendz/pkg/client"
+)
+
+// ofxTimeLayout is the layout of an OFX datetime, without the time zone suffix.
+const ofxTimeLayout = "20060102150405.000"
+
+// ofxWriter is the OFX 2.x Writer, which writes a credit card statement.
+//
+// The statement header includes the date range of the transactions, so the transactions are
+// buffered until the Writer is closed.
+type ofxWriter struct {
+	w      io.Writer
+	config config
+	// transactions are the (posted) transactions of the statement.
+	transactions []client.Transaction
+}
+
+// Write implements Writer.
+func (w *ofxWriter) Write(tx client.Transaction) error {
+	if posted(tx) {
+		w.transactions = append(w.transactions, tx)
+	}
+	return nil
+}
+
+// Close implements Writer.
+func (w *ofxWriter) Close() error {
+	account, currency := w.config.account, w.config.currency
+	var start, end time.Time
+	balance := client.NewMoney(0, currency)
+	for _, tx := range w.transactions {
+		if account == "" {
+			account = tx.CreditCardID
+		}
+		amount := Amount(tx)
+		if currency == "" {
+			currency = amount.Currency
+			balance = client.NewMoney(0, currency)
+		}
+		var err error
+		if balance, err = balance.Add(amount); err != nil {
+			return fmt.Errorf("failed to export transaction %s: %w", tx.ID, err)
+		}
+		date := Date(tx).In(w.config.location)
+		if start.IsZero() || date.Before(start) {
+			start = date
+		}
+		if end.IsZero() || date.After(end) {
+			end = date
+		}
+	}
+	now := w.config.now().In(w.config.location)
+	if start.IsZero() {
+		start, end = now, now
+	}
+	if currency == "" {
+		currency = "USD"
+	}
+
+	var b bytes.Buffer
+	b.WriteString(`<?xml version="1.0" encoding="UTF-8" standalone="no"?>` + "\n")
+	b.WriteString(`<?OFX OFXHEADER="200" VERSION="220" SECURITY="NONE" OLDFILEUID="NONE" NEWFILEUID="NONE"?>` + "\n")
+	b.WriteString("<OFX>\n")
+	b.WriteString("<SIGNONMSGSRSV1><SONRS>")
+	b.WriteString("<STATUS><CODE>0</CODE><SEVERITY>INFO</SEVERITY></STATUS>")
+	fmt.Fprintf(&b, "<DTSERVER>%s</DTSERVER><LANGUAGE>ENG</LANGUAGE>", ofxTime(now))
+	b.WriteString("</SONRS></SIGNONMSGSRSV1>\n")
+	b.WriteString("<CREDITCARDMSGSRSV1><CCSTMTTRNRS><TRNUID>0</TRNUID>")
+	b.WriteString("<STATUS><CODE>0</CODE><SEVERITY>INFO</SEVERITY></STATUS>\n")
+	fmt.Fprintf(&b, "<CCSTMTRS><CURDEF>%s</CURDEF>", ofxText(currency))
+	fmt.Fprintf(&b, "<CCACCTFROM><ACCTID>%s</ACCTID></CCACCTFROM>\n", ofxText(account))
+	fmt.Fprintf(&b, "<BANKTRANLIST><DTSTART>%s</DTSTART><DTEND>%s</DTEND>\n", ofxTime(start), ofxTime(end))
+	for _, tx := range w.transactions {
+		amount := Amount(tx)
+		kind := "DEBIT"
+		if !amount.IsNegative() {
+			kind = "CREDIT"
+		}
+		b.WriteString("<STMTTRN>")
+		fmt.Fprintf(&b, "<TRNTYPE>%s</TRNTYPE>", kind)
+		fmt.Fprintf(&b, "<DTPOSTED>%s</DTPOSTED>", ofxTime(Date(tx).In(w.config.location)))
+		if !tx.AuthedAt.IsZero() {
+			fmt.Fprintf(&b, "<DTUSER>%s</DTUSER>", ofxTime(tx.AuthedAt.In(w.config.location)))
+		}
+		fmt.Fprintf(&b, "<TRNAMT>%s</TRNAMT>", amount.Decimal())
+		fmt.Fprintf(&b, "<FITID>%s</FITID>", ofxText(tx.ID))
+		if tx.Mcc != "" {
+			fmt.Fprintf(&b, "<SIC>%s</SIC>", ofxText(tx.Mcc))
+		}
+		fmt.Fprintf(&b, "<NAME>%s</NAME>", ofxText(truncate(tx.MerchantName, 32)))
+		memo := Memo(tx)
+		if tx.Status != client.TransactionStatusCleared {
+			memo = strings.TrimSpace(string(tx.Status) + " " + memo)
+		}
+		if memo != "" {
+			fmt.Fprintf(&b, "<MEMO>%s</MEMO>", ofxText(truncate(memo, 255)))
+		}
+		b.WriteString("</STMTTRN>\n")
+	}
+	b.WriteString("</BANKTRANLIST>\n")
+	fmt.Fprintf(&b, "<LEDGERBAL><BALAMT>%s</BALAMT><DTASOF>%s</DTASOF></LEDGERBAL>\n", balance.Decimal(), ofxTime(end))
+	b.WriteString("</CCSTMTRS></CCSTMTTRNRS></CREDITCARDMSGSRSV1>\n")
+	b.WriteString("</OFX>\n")
+	_, err := w.w.Write(b.Bytes())
+	return err
+}
+
+// ofxTime returns the OFX datetime of the time, e.g. "20200101010112.123[-5:EST]".
+func ofxTime(t time.Time) string {
+	name, offset := t.Zone()
+	return fmt.Sprintf("%s[%g:%s]", t.Format(ofxTimeLayout), float64(offset)/3600, name)
+}
+
+// ofxText returns the text escaped as XML character data.
+func ofxText(text string) string {
+	var b bytes.Buffer
+	_ = xml.EscapeText(&b, []byte(text))
+	return b.String()
+}
+
+// truncate returns the text truncated to the maximum number of characters.
+func truncate(text string, maximum int) string {
+	if r := []rune(text); len(r) > maximum {
+		return string(r[:maximum])
+	}
+	return text
+}
@@ -0,0 +1,73 @@
+// Copyright 2022 c-fraser
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package export
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/c-fraser/extendz/pkg/client"
+)
+
+// qifWriter is the QIF Writer, which writes a credit card (CCard) account.
+type qifWriter struct {
+	w      io.Writer
+	config config
+	// header is whether the header was written.
+	header bool
+}
+
+// Write implements Writer.
+func (w *qifWriter) Write(tx client.Transaction) error {
+	if !posted(tx) {
+		return nil
+	}
+	var b strings.Builder
+	if !w.header {
+		b.WriteString("!Type:CCard\n")
+		w.header = true
+	}
+	fmt.Fprintf(&b, "D%s\n", Date(tx).In(w.config.location).Format("01/02/2006"))
+	fmt.Fprintf(&b, "T%s\n", Amount(tx).Decimal())
+	if tx.Status == client.TransactionStatusCleared {
+		b.WriteString("C*\n")
+	}
+	fmt.Fprintf(&b, "N%s\n", qif(tx.ID))
+	fmt.Fprintf(&b, "P%s\n", qif(tx.MerchantName))
+	if memo := Memo(tx); memo != "" {
+		fmt.Fprintf(&b, "M%s\n", qif(memo))
+	}
+	if category := tx.MccDescription; category != "" {
+		fmt.Fprintf(&b, "L%s\n", qif(category))
+	}
+	b.WriteString("^\n")
+	_, err := io.WriteString(w.w, b.String())
+	return err
+}
+
+// Close implements Writer.
+func (w *qifWriter) Close() error {
+	if w.header {
+		return nil
+	}
+	_, err := io.WriteString(w.w, "!Type:CCard\n")
+	return err
+}
+
+// qif returns the text without line breaks, which end a QIF field.
+func qif(text string) string {
+	return strings.NewReplacer("\r", " ", "\n", " ").Replace(text)
+}
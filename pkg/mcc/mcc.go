@@ -0,0 +1,198 @@
+// Copyright 2022 c-fraser
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package mcc provides an embedded dataset of the ISO 18245 merchant category codes (MCC), and
+// helpers to build, normalize and check the client.MccRange values of a virtual card.
+//
+// The codes of the dataset are grouped into named categories, e.g. "airlines" or "lodging". The
+// individual codes of the airline (3000-3350), car rental (3351-3500) and lodging (3501-3999)
+// merchants are described by a single range.
+package mcc
+
+import (
+	_ "embed"
+	"encoding/csv"
+	"fmt"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/c-fraser/extendz/pkg/client"
+)
+
+// dataset is the CSV of the Category values, sorted by code.
+//
+//go:embed mcc.csv
+var dataset string
+
+// Category is a merchant category, a code (or range of codes) of the dataset.
+type Category struct {
+	// Lowest is the lowest code of the Category.
+	Lowest string `json:"lowest"`
+	// Highest is the highest code of the Category, which equals the Lowest if the Category is a
+	// single code.
+	Highest string `json:"highest"`
+	// Group is the name of the group of the Category, e.g. "airlines".
+	Group string `json:"group"`
+	// Description describes the merchants of the Category.
+	Description string `json:"description"`
+}
+
+// Range returns the client.MccRange of the Category.
+func (c Category) Range() client.MccRange {
+	return client.MccRange{Lowest: c.Lowest, Highest: c.Highest}
+}
+
+// Contains returns whether the code is in the Category.
+func (c Category) Contains(code string) bool {
+	return c.Lowest <= code && code <= c.Highest
+}
+
+// categories is the Category values of the dataset.
+var categories = load()
+
+// load returns the Category values of the dataset.
+func load() []Category {
+	records, err := csv.NewReader(strings.NewReader(dataset)).ReadAll()
+	if err != nil {
+		panic(fmt.Sprintf("invalid MCC dataset: %v", err))
+	}
+	c := make([]Category, 0, len(records)-1)
+	for _, r := range records[1:] {
+		c = append(c, Category{Lowest: r[0], Highest: r[1], Group: r[2], Description: r[3]})
+	}
+	return c
+}
+
+// Lookup returns the Category of the code, and whether the code is known.
+func Lookup(code string) (Category, bool) {
+	i := sort.Search(len(categories), func(i int) bool { return categories[i].Highest >= code })
+	if i < len(categories) && isCode(code) && categories[i].Contains(code) {
+		return categories[i], true
+	}
+	return Category{}, false
+}
+
+// Groups returns the names of the groups of the dataset, sorted.
+func Groups() []string {
+	var groups []string
+	for _, c := range categories {
+		if !slices.Contains(groups, c.Group) {
+			groups = append(groups, c.Group)
+		}
+	}
+	slices.Sort(groups)
+	return groups
+}
+
+// Group returns the Category values of the (case-insensitive) group name.
+func Group(name string) []Category {
+	var group []Category
+	for _, c := range categories {
+		if strings.EqualFold(c.Group, name) {
+			group = append(group, c)
+		}
+	}
+	return group
+}
+
+// Search returns the Category values with a description or group containing the
+// (case-insensitive) keyword.
+func Search(keyword string) []Category {
+	keyword = strings.ToLower(keyword)
+	var found []Category
+	for _, c := range categories {
+		if strings.Contains(strings.ToLower(c.Description), keyword) || strings.Contains(c.Group, keyword) {
+			found = append(found, c)
+		}
+	}
+	return found
+}
+
+// Ranges returns the normalized client.MccRange values of the groups, e.g. to set the
+// ValidMccRanges of a virtual card to Ranges("airlines", "lodging"). An error is returned if a
+// group is unknown.
+func Ranges(groups ...string) ([]client.MccRange, error) {
+	var ranges []client.MccRange
+	for _, name := range groups {
+		group := Group(name)
+		if len(group) == 0 {
+			return nil, fmt.Errorf("unknown MCC group %q, expected one of %s", name, strings.Join(Groups(), ", "))
+		}
+		for _, c := range group {
+			ranges = append(ranges, c.Range())
+		}
+	}
+	return Normalize(ranges)
+}
+
+// Normalize returns the client.MccRange values sorted, with the overlapping and adjacent ranges
+// merged. An error is returned if a range isn't of 4 digit codes, or its lowest code is greater
+// than its highest.
+func Normalize(ranges []client.MccRange) ([]client.MccRange, error) {
+	type bounds struct{ lowest, highest int }
+	b := make([]bounds, len(ranges))
+	for i, r := range ranges {
+		if !isCode(r.Lowest) || !isCode(r.Highest) || r.Lowest > r.Highest {
+			return nil, fmt.Errorf("invalid MCC range %s-%s", r.Lowest, r.Highest)
+		}
+		lowest, _ := strconv.Atoi(r.Lowest)
+		highest, _ := strconv.Atoi(r.Highest)
+		b[i] = bounds{lowest, highest}
+	}
+	sort.Slice(b, func(i, j int) bool { return b[i].lowest < b[j].lowest })
+	var merged []bounds
+	for _, r := range b {
+		if n := len(merged); n > 0 && r.lowest <= merged[n-1].highest+1 {
+			merged[n-1].highest = max(merged[n-1].highest, r.highest)
+			continue
+		}
+		merged = append(merged, r)
+	}
+	normalized := make([]client.MccRange, len(merged))
+	for i, r := range merged {
+		normalized[i] = client.MccRange{Lowest: fmt.Sprintf("%04d", r.lowest), Highest: fmt.Sprintf("%04d", r.highest)}
+	}
+	return normalized, nil
+}
+
+// Contains returns whether the code is in any of the client.MccRange values.
+func Contains(ranges []client.MccRange, code string) bool {
+	for _, r := range ranges {
+		if r.Lowest <= code && code <= r.Highest {
+			return true
+		}
+	}
+	return false
+}
+
+// Allowed returns whether a merchant of the code is allowed to transact with the virtual card,
+// which is any merchant if the virtual card has no ValidMccRanges.
+func Allowed(vc client.VirtualCard, code string) bool {
+	return len(vc.ValidMccRanges) == 0 || (isCode(code) && Contains(vc.ValidMccRanges, code))
+}
+
+// isCode returns whether the code is a 4 digit merchant category code.
+func isCode(code string) bool {
+	if len(code) != 4 {
+		return false
+	}
+	for _, c := range code {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
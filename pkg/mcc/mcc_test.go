@@ -0,0 +1,107 @@
+// Copyright 2022 c-fraser
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mcc
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/c-fraser/extendz/pkg/client"
+)
+
+func TestDataset(t *testing.T) {
+	for i, c := range categories {
+		if !isCode(c.Lowest) || !isCode(c.Highest) || c.Lowest > c.Highest || c.Group == "" || c.Description == "" {
+			t.Errorf("Invalid category: %+v", c)
+		}
+		if i > 0 && categories[i-1].Highest >= c.Lowest {
+			t.Errorf("Unsorted or overlapping categories: %+v %+v", categories[i-1], c)
+		}
+	}
+}
+
+func TestLookup(t *testing.T) {
+	for code, group := range map[string]string{
+		"3012": "airlines",
+		"4511": "airlines",
+		"7011": "lodging",
+		"5812": "restaurants",
+		"0742": "agricultural",
+	} {
+		c, ok := Lookup(code)
+		if !ok || c.Group != group {
+			t.Errorf("Unexpected category of %s: %+v", code, c)
+		}
+	}
+	for _, code := range []string{"0000", "9999", "12", "abcd"} {
+		if c, ok := Lookup(code); ok {
+			t.Errorf("Unexpected category of %s: %+v", code, c)
+		}
+	}
+	if found := Search("fast food"); len(found) != 1 || found[0].Lowest != "5814" {
+		t.Errorf("Unexpected search results: %+v", found)
+	}
+}
+
+func TestRanges(t *testing.T) {
+	ranges, err := Ranges("airlines", "Lodging")
+	if err != nil {
+		t.Fatalf("Failed to get ranges: %v", err)
+	}
+	expected := []client.MccRange{
+		{Lowest: "3000", Highest: "3350"},
+		{Lowest: "3501", Highest: "3999"},
+		{Lowest: "4511", Highest: "4511"},
+		{Lowest: "4582", Highest: "4582"},
+		{Lowest: "7011", Highest: "7012"},
+		{Lowest: "7032", Highest: "7033"},
+	}
+	if !reflect.DeepEqual(ranges, expected) {
+		t.Errorf("Unexpected ranges: %v", ranges)
+	}
+	if _, err := Ranges("spaceships"); err == nil {
+		t.Errorf("Unexpected ranges of unknown group")
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	ranges, err := Normalize([]client.MccRange{
+		{Lowest: "5000", Highest: "5100"},
+		{Lowest: "0742", Highest: "0742"},
+		{Lowest: "5050", Highest: "5200"},
+		{Lowest: "5201", Highest: "5201"},
+	})
+	if err != nil {
+		t.Fatalf("Failed to normalize ranges: %v", err)
+	}
+	expected := []client.MccRange{{Lowest: "0742", Highest: "0742"}, {Lowest: "5000", Highest: "5201"}}
+	if !reflect.DeepEqual(ranges, expected) {
+		t.Errorf("Unexpected ranges: %v", ranges)
+	}
+	if _, err := Normalize([]client.MccRange{{Lowest: "5200", Highest: "5000"}}); err == nil {
+		t.Errorf("Unexpected normalization of invalid range")
+	}
+}
+
+func TestAllowed(t *testing.T) {
+	vc := client.VirtualCard{}
+	if !Allowed(vc, "5812") {
+		t.Errorf("Unexpected disallowed MCC without ranges")
+	}
+	vc.ValidMccRanges = []client.MccRange{{Lowest: "3000", Highest: "3350"}, {Lowest: "4511", Highest: "4511"}}
+	if !Allowed(vc, "4511") || Allowed(vc, "5812") {
+		t.Errorf("Unexpected allowed MCCs of ranges: %v", vc.ValidMccRanges)
+	}
+}
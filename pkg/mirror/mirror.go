@@ -0,0 +1,410 @@
+// Copyright 2022 c-fraser
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package mirror mirrors the Extend API virtual cards, and their transactions, into a (normalized)
+// SQLite database, to query them with SQL.
+//
+// Each Sync gets every virtual card, to record the virtual cards which were removed, but only
+// writes the virtual cards which changed (per their UpdatedAt). The transactions of the changed, and
+// active, virtual cards are got incrementally, after the high-water mark of their AuthedAt. A changed
+// virtual card is written with its transactions, so it's only synced once its transactions are.
+package mirror
+
+import (
+	"context"
+	"database/sql"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/c-fraser/extendz/pkg/client"
+	_ "modernc.org/sqlite"
+)
+
+// schema is the SQL which creates the tables of the mirror.
+//
+//go:embed schema.sql
+var schema string
+
+// timeLayout is the layout of the timestamps stored in the mirror.
+const timeLayout = "2006-01-02T15:04:05.000Z07:00"
+
+// API is the Extend API operations used to Sync, e.g. the client.Client.
+type API interface {
+	client.VirtualCardLister
+	client.TransactionLister
+}
+
+// Stats is the number of records written by a Sync.
+type Stats struct {
+	// Cards is the number of new, or changed, virtual cards.
+	Cards int `json:"cards"`
+	// Transactions is the number of new, or changed, transactions.
+	Transactions int `json:"transactions"`
+	// Removed is the number of virtual cards which were removed.
+	Removed int `json:"removed"`
+}
+
+// Mirror is a SQLite database mirroring the Extend API.
+type Mirror struct {
+	// db is the SQLite database.
+	db *sql.DB
+	// lookback is how long before the high-water mark transactions are got again, to update the
+	// transactions which changed since the last Sync (e.g. were cleared).
+	lookback time.Duration
+	// now returns the current time.
+	now func() time.Time
+}
+
+// Option configures a Mirror.
+type Option func(m *Mirror)
+
+// WithLookback configures how long before the high-water mark of the synced transactions the
+// transactions are got again, to update the transactions which changed (e.g. were cleared) since
+// the last Sync. The default is 7 days.
+func WithLookback(lookback time.Duration) Option {
+	return func(m *Mirror) {
+		m.lookback = lookback
+	}
+}
+
+// Open opens (or creates) the SQLite database at the path as a Mirror.
+func Open(path string, options ...Option) (*Mirror, error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(1)
+	if _, err := db.Exec("PRAGMA foreign_keys = ON;" + schema); err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("failed to create mirror schema: %w", err)
+	}
+	m := &Mirror{db: db, lookback: 7 * 24 * time.Hour, now: time.Now}
+	for _, option := range options {
+		option(m)
+	}
+	return m, nil
+}
+
+// DB returns the SQLite database of the Mirror.
+func (m *Mirror) DB() *sql.DB {
+	return m.db
+}
+
+// Close closes the SQLite database of the Mirror.
+func (m *Mirror) Close() error {
+	return m.db.Close()
+}
+
+// mirrored is the sync state of a mirrored virtual card.
+type mirrored struct {
+	updatedAt      sql.NullString
+	removed        bool
+	transactionsAt sql.NullString
+}
+
+// Sync mirrors the virtual cards, and transactions, which changed since the last Sync.
+func (m *Mirror) Sync(ctx context.Context, api API) (Stats, error) {
+	var stats Stats
+	started := m.now()
+	cards, err := client.AllVirtualCards(api, client.VirtualCardPageableRequest{})
+	if err != nil {
+		return stats, fmt.Errorf("failed to get virtual cards: %w", err)
+	}
+	existing, err := m.mirrored(ctx)
+	if err != nil {
+		return stats, err
+	}
+
+	fetched := make(map[string]bool, len(cards))
+	for _, vc := range cards {
+		fetched[vc.ID] = true
+		state, ok := existing[vc.ID]
+		// A virtual card without an UpdatedAt can't be compared, so it's always considered changed.
+		changed := !ok || state.removed || vc.UpdatedAt.IsZero() ||
+			state.updatedAt.String != timestamp(vc.UpdatedAt, vc.Location())
+		if !changed && vc.Status != client.VirtualCardStatusActive {
+			continue
+		}
+		n, err := m.syncVirtualCard(ctx, api, vc, changed, state.transactionsAt)
+		if err != nil {
+			return stats, err
+		}
+		if changed {
+			stats.Cards++
+		}
+		stats.Transactions += n
+	}
+
+	err = m.inTx(ctx, func(tx *sql.Tx) error {
+		for id, state := range existing {
+			if fetched[id] || state.removed {
+				continue
+			}
+			_, err := tx.ExecContext(ctx, `UPDATE virtual_cards SET removed_at = ? WHERE id = ?`, started.UTC().Format(timeLayout), id)
+			if err != nil {
+				return err
+			}
+			stats.Removed++
+		}
+		return nil
+	})
+	if err != nil {
+		return stats, err
+	}
+
+	_, err = m.db.ExecContext(
+		ctx,
+		`INSERT INTO syncs (started_at, finished_at, cards, transactions, removed) VALUES (?, ?, ?, ?, ?)`,
+		started.UTC().Format(timeLayout),
+		m.now().UTC().Format(timeLayout),
+		stats.Cards,
+		stats.Transactions,
+		stats.Removed)
+	return stats, err
+}
+
+// mirrored returns the sync state of the mirrored virtual cards, by ID.
+func (m *Mirror) mirrored(ctx context.Context) (map[string]mirrored, error) {
+	rows, err := m.db.QueryContext(ctx, `SELECT id, updated_at, removed_at IS NOT NULL, transactions_authed_at FROM virtual_cards`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	existing := make(map[string]mirrored)
+	for rows.Next() {
+		var id string
+		var state mirrored
+		if err := rows.Scan(&id, &state.updatedAt, &state.removed, &state.transactionsAt); err != nil {
+			return nil, err
+		}
+		existing[id] = state
+	}
+	return existing, rows.Err()
+}
+
+// syncVirtualCard mirrors the virtual card, if it changed, and its transactions after the high-water
+// mark (less the lookback), in a database transaction, and returns the number of transactions
+// written.
+func (m *Mirror) syncVirtualCard(ctx context.Context, api API, vc client.VirtualCard, changed bool, mark sql.NullString) (int, error) {
+	var request client.VirtualCardTransactionsRequest
+	var highWater time.Time
+	if mark.Valid {
+		t, err := time.Parse(timeLayout, mark.String)
+		if err != nil {
+			return 0, fmt.Errorf("invalid transactions high-water mark of virtual card %s: %w", vc.ID, err)
+		}
+		highWater = t
+		request.After = t.Add(-m.lookback)
+	}
+	transactions, err := client.AllVirtualCardTransactions(api, vc.ID, request)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get transactions of virtual card %s: %w", vc.ID, err)
+	}
+	n := 0
+	err = m.inTx(ctx, func(tx *sql.Tx) error {
+		if changed {
+			if err := upsertVirtualCard(ctx, tx, vc); err != nil {
+				return err
+			}
+		}
+		for _, t := range transactions {
+			written, err := upsertTransaction(ctx, tx, vc, t)
+			if err != nil {
+				return err
+			}
+			if written {
+				n++
+			}
+			if authed := t.AuthedAt.In(vc.Location()); authed.After(highWater) {
+				highWater = authed
+			}
+		}
+		if highWater.IsZero() {
+			return nil
+		}
+		_, err := tx.ExecContext(
+			ctx,
+			`UPDATE virtual_cards SET transactions_authed_at = ? WHERE id = ?`,
+			highWater.UTC().Format(timeLayout),
+			vc.ID)
+		return err
+	})
+	return n, err
+}
+
+// inTx runs the function in a database transaction, which is committed if the function succeeds.
+func (m *Mirror) inTx(ctx context.Context, f func(tx *sql.Tx) error) error {
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if err := f(tx); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// upsertVirtualCard writes the virtual card, its users, recurrence and MCC ranges.
+func upsertVirtualCard(ctx context.Context, tx *sql.Tx, vc client.VirtualCard) error {
+	for _, u := range []client.User{vc.Recipient, vc.Cardholder} {
+		if u.ID == "" {
+			continue
+		}
+		_, err := tx.ExecContext(
+			ctx,
+			`INSERT INTO users (id, first_name, last_name, email, timezone) VALUES (?, ?, ?, ?, ?)
+			ON CONFLICT (id) DO UPDATE SET
+				first_name = excluded.first_name,
+				last_name = excluded.last_name,
+				email = excluded.email,
+				timezone = excluded.timezone`,
+			u.ID, u.FirstName, u.LastName, u.Email, u.Timezone)
+		if err != nil {
+			return fmt.Errorf("failed to write user %s: %w", u.ID, err)
+		}
+	}
+	data, err := json.Marshal(vc)
+	if err != nil {
+		return err
+	}
+	loc := vc.Location()
+	_, err = tx.ExecContext(
+		ctx,
+		`INSERT INTO virtual_cards (
+			id, status, display_name, recipient_id, cardholder_id, credit_card_id, currency,
+			limit_cents, balance_cents, spent_cents, lifetime_spent_cents, last4, timezone, recurs,
+			notes, expires, valid_from, valid_to, created_at, updated_at, removed_at, data)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, NULL, ?)
+		ON CONFLICT (id) DO UPDATE SET
+			status = excluded.status,
+			display_name = excluded.display_name,
+			recipient_id = excluded.recipient_id,
+			cardholder_id = excluded.cardholder_id,
+			credit_card_id = excluded.credit_card_id,
+			currency = excluded.currency,
+			limit_cents = excluded.limit_cents,
+			balance_cents = excluded.balance_cents,
+			spent_cents = excluded.spent_cents,
+			lifetime_spent_cents = excluded.lifetime_spent_cents,
+			last4 = excluded.last4,
+			timezone = excluded.timezone,
+			recurs = excluded.recurs,
+			notes = excluded.notes,
+			expires = excluded.expires,
+			valid_from = excluded.valid_from,
+			valid_to = excluded.valid_to,
+			created_at = excluded.created_at,
+			updated_at = excluded.updated_at,
+			removed_at = NULL,
+			data = excluded.data`,
+		vc.ID, string(vc.Status), vc.DisplayName, nullable(vc.Recipient.ID), nullable(vc.Cardholder.ID),
+		vc.CreditCardID, vc.Currency, vc.LimitCents, vc.BalanceCents, vc.SpentCents,
+		vc.LifetimeSpentCents, vc.Last4, vc.Timezone, vc.Recurs, vc.Notes,
+		nullable(timestamp(vc.Expires, loc)), nullable(timestamp(vc.ValidFrom, loc)),
+		nullable(timestamp(vc.ValidTo, loc)), nullable(timestamp(vc.CreatedAt, loc)),
+		nullable(timestamp(vc.UpdatedAt, loc)), string(data))
+	if err != nil {
+		return fmt.Errorf("failed to write virtual card %s: %w", vc.ID, err)
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM recurrences WHERE virtual_card_id = ?`, vc.ID); err != nil {
+		return err
+	}
+	if vc.Recurs {
+		r := vc.Recurrence
+		_, err := tx.ExecContext(
+			ctx,
+			`INSERT INTO recurrences (
+				virtual_card_id, balance_cents, period, interval, terminator, count, until, next_recurrence_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+			vc.ID, r.BalanceCents, string(r.Period), r.Interval, string(r.Terminator), r.Count,
+			nullable(timestamp(r.Until, loc)), nullable(timestamp(r.NextRecurrenceAt, loc)))
+		if err != nil {
+			return fmt.Errorf("failed to write recurrence of virtual card %s: %w", vc.ID, err)
+		}
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM mcc_ranges WHERE virtual_card_id = ?`, vc.ID); err != nil {
+		return err
+	}
+	for _, r := range vc.ValidMccRanges {
+		_, err := tx.ExecContext(
+			ctx,
+			`INSERT INTO mcc_ranges (virtual_card_id, lowest, highest) VALUES (?, ?, ?)`,
+			vc.ID, r.Lowest, r.Highest)
+		if err != nil {
+			return fmt.Errorf("failed to write MCC ranges of virtual card %s: %w", vc.ID, err)
+		}
+	}
+	return nil
+}
+
+// upsertTransaction writes the transaction of the virtual card, and returns whether it was new or
+// changed.
+func upsertTransaction(ctx context.Context, tx *sql.Tx, vc client.VirtualCard, t client.Transaction) (bool, error) {
+	data, err := json.Marshal(t)
+	if err != nil {
+		return false, err
+	}
+	loc := vc.Location()
+	result, err := tx.ExecContext(
+		ctx,
+		`INSERT INTO transactions (
+			id, virtual_card_id, type, status, merchant_name, mcc, mcc_group,
+			auth_billing_amount_cents, auth_billing_currency, clearing_billing_amount_cents,
+			clearing_billing_currency, authed_at, cleared_at, updated_at, data)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (id) DO UPDATE SET
+			type = excluded.type,
+			status = excluded.status,
+			merchant_name = excluded.merchant_name,
+			mcc = excluded.mcc,
+			mcc_group = excluded.mcc_group,
+			auth_billing_amount_cents = excluded.auth_billing_amount_cents,
+			auth_billing_currency = excluded.auth_billing_currency,
+			clearing_billing_amount_cents = excluded.clearing_billing_amount_cents,
+			clearing_billing_currency = excluded.clearing_billing_currency,
+			authed_at = excluded.authed_at,
+			cleared_at = excluded.cleared_at,
+			updated_at = excluded.updated_at,
+			data = excluded.data
+		WHERE data != excluded.data`,
+		t.ID, vc.ID, string(t.Type), string(t.Status), t.MerchantName, t.Mcc, t.MccGroup,
+		t.AuthBillingAmountCents, t.AuthBillingCurrency, t.ClearingBillingAmountCents,
+		t.ClearingBillingCurrency, nullable(timestamp(t.AuthedAt, loc)),
+		nullable(timestamp(t.ClearedAt, loc)), nullable(timestamp(t.UpdatedAt, loc)), string(data))
+	if err != nil {
+		return false, fmt.Errorf("failed to write transaction %s: %w", t.ID, err)
+	}
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
+
+// timestamp returns the Timestamp (in the location, if floating) formatted per the timeLayout in
+// UTC, or "" if the Timestamp is zero.
+func timestamp(t client.Timestamp, loc *time.Location) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.In(loc).UTC().Format(timeLayout)
+}
+
+// nullable returns the string, or nil (NULL) if the string is empty.
+func nullable(s string) any {
+	if s == "" {
+		return nil
+	}
+	return s
+}
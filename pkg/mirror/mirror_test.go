@@ -0,0 +1,167 @@
+// Copyright 2022 c-fraser
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mirror
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/c-fraser/extendz/pkg/client"
+)
+
+type api struct {
+	cards        []client.VirtualCard
+	transactions map[string][]client.Transaction
+	requests     []client.VirtualCardTransactionsRequest
+	// fail is the ID of the virtual card whose transactions fail to be got, once.
+	fail string
+}
+
+func (a *api) GetUserVirtualCards(*client.VirtualCardPageableRequest) (*client.VirtualCardsResponse, error) {
+	return &client.VirtualCardsResponse{
+		Pagination:   client.Pagination{NumberOfPages: 1},
+		VirtualCards: a.cards,
+	}, nil
+}
+
+func (a *api) GetVirtualCardTransactions(id string, request *client.VirtualCardTransactionsRequest) (*client.TransactionsResponse, error) {
+	a.requests = append(a.requests, *request)
+	if id == a.fail {
+		a.fail = ""
+		return nil, errors.New("unavailable")
+	}
+	var response client.TransactionsResponse
+	for _, tx := range a.transactions[id] {
+		if request.After.IsZero() || tx.AuthedAt.After(request.After) {
+			response.Transactions = append(response.Transactions, tx)
+		}
+	}
+	return &response, nil
+}
+
+func TestSync(t *testing.T) {
+	m, err := Open(filepath.Join(t.TempDir(), "extend.sqlite"), WithLookback(time.Hour))
+	if err != nil {
+		t.Fatalf("Failed to open mirror: %v", err)
+	}
+	defer m.Close()
+
+	now := time.Date(2024, time.January, 10, 0, 0, 0, 0, time.UTC)
+	a := &api{
+		cards: []client.VirtualCard{
+			{
+				ID:             "vc_1",
+				Status:         client.VirtualCardStatusActive,
+				Recipient:      client.User{ID: "u_1", Email: "jane@example.com"},
+				Currency:       "USD",
+				BalanceCents:   1000,
+				Recurs:         true,
+				Recurrence:     client.Recurrence{Period: client.RecurrencePeriodMonthly, Terminator: client.RecurrenceTerminatorNone},
+				ValidMccRanges: []client.MccRange{{Lowest: "3000", Highest: "3350"}},
+				UpdatedAt:      client.NewTimestamp(now.Add(-time.Hour)),
+			},
+			{
+				ID:     "vc_3",
+				Status: client.VirtualCardStatusCancelled,
+			},
+			{
+				ID:        "vc_2",
+				Status:    client.VirtualCardStatusCancelled,
+				UpdatedAt: client.NewTimestamp(now.Add(-time.Hour)),
+			},
+		},
+		transactions: map[string][]client.Transaction{
+			"vc_1": {
+				{ID: "tx_1", Status: client.TransactionStatusPending, AuthBillingAmountCents: 500, AuthedAt: client.NewTimestamp(now.Add(-2 * time.Hour))},
+				{ID: "tx_2", Status: client.TransactionStatusCleared, AuthBillingAmountCents: 200, AuthedAt: client.NewTimestamp(now.Add(-24 * time.Hour))},
+			},
+		},
+	}
+	stats, err := m.Sync(context.Background(), a)
+	if err != nil {
+		t.Fatalf("Failed to sync: %v", err)
+	}
+	if stats != (Stats{Cards: 3, Transactions: 2}) {
+		t.Errorf("Unexpected stats of first sync: %+v", stats)
+	}
+
+	// The cancelled virtual card is removed, the pending transaction cleared, and a transaction added.
+	// The virtual card without an UpdatedAt is always rewritten.
+	a.cards = a.cards[:2]
+	a.transactions["vc_1"][0].Status = client.TransactionStatusCleared
+	a.transactions["vc_1"] = append(a.transactions["vc_1"], client.Transaction{ID: "tx_3", AuthedAt: client.NewTimestamp(now)})
+	a.requests = nil
+	stats, err = m.Sync(context.Background(), a)
+	if err != nil {
+		t.Fatalf("Failed to sync: %v", err)
+	}
+	if stats != (Stats{Cards: 1, Transactions: 2, Removed: 1}) {
+		t.Errorf("Unexpected stats of second sync: %+v", stats)
+	}
+	if len(a.requests) != 2 || !a.requests[0].After.Equal(now.Add(-3*time.Hour)) {
+		t.Errorf("Unexpected transactions requests: %+v", a.requests)
+	}
+
+	var removed, transactions, pending, ranges int
+	row := m.DB().QueryRow(`SELECT
+		(SELECT COUNT(*) FROM virtual_cards WHERE removed_at IS NOT NULL),
+		(SELECT COUNT(*) FROM transactions WHERE virtual_card_id = 'vc_1'),
+		(SELECT COUNT(*) FROM transactions WHERE status = 'PENDING'),
+		(SELECT COUNT(*) FROM mcc_ranges JOIN recurrences USING (virtual_card_id))`)
+	if err := row.Scan(&removed, &transactions, &pending, &ranges); err != nil {
+		t.Fatalf("Failed to query mirror: %v", err)
+	}
+	if removed != 1 || transactions != 3 || pending != 0 || ranges != 1 {
+		t.Errorf("Unexpected mirror: %d removed, %d transactions, %d pending, %d ranges", removed, transactions, pending, ranges)
+	}
+}
+
+func TestSyncFailedTransactions(t *testing.T) {
+	m, err := Open(filepath.Join(t.TempDir(), "extend.sqlite"))
+	if err != nil {
+		t.Fatalf("Failed to open mirror: %v", err)
+	}
+	defer m.Close()
+
+	now := time.Date(2024, time.January, 10, 0, 0, 0, 0, time.UTC)
+	a := &api{
+		cards: []client.VirtualCard{
+			{
+				ID:        "vc_1",
+				Status:    client.VirtualCardStatusCancelled,
+				UpdatedAt: client.NewTimestamp(now),
+			},
+		},
+		transactions: map[string][]client.Transaction{
+			"vc_1": {{ID: "tx_1", AuthedAt: client.NewTimestamp(now.Add(-time.Hour))}},
+		},
+		fail: "vc_1",
+	}
+	if _, err := m.Sync(context.Background(), a); err == nil {
+		t.Fatal("Expected sync to fail")
+	}
+
+	// The changed, cancelled, virtual card wasn't synced, so it's synced (with its transactions) again.
+	stats, err := m.Sync(context.Background(), a)
+	if err != nil {
+		t.Fatalf("Failed to sync: %v", err)
+	}
+	if stats != (Stats{Cards: 1, Transactions: 1}) {
+		t.Errorf("Unexpected stats of second sync: %+v", stats)
+	}
+}
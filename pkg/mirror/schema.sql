@@ -0,0 +1,96 @@
+-- The schema of the mirror of the Extend API virtual cards and transactions.
+--
+-- Timestamps are stored as RFC 3339 text in UTC (with millisecond precision), and amounts in the
+-- minor units of their currency.
+
+CREATE TABLE IF NOT EXISTS users
+(
+    id         TEXT PRIMARY KEY,
+    first_name TEXT,
+    last_name  TEXT,
+    email      TEXT,
+    timezone   TEXT
+);
+
+CREATE TABLE IF NOT EXISTS virtual_cards
+(
+    id                   TEXT PRIMARY KEY,
+    status               TEXT    NOT NULL,
+    display_name         TEXT,
+    recipient_id         TEXT REFERENCES users (id),
+    cardholder_id        TEXT REFERENCES users (id),
+    credit_card_id       TEXT,
+    currency             TEXT,
+    limit_cents          INTEGER NOT NULL,
+    balance_cents        INTEGER NOT NULL,
+    spent_cents          INTEGER NOT NULL,
+    lifetime_spent_cents INTEGER NOT NULL,
+    last4                TEXT,
+    timezone             TEXT,
+    recurs               INTEGER NOT NULL,
+    notes                TEXT,
+    expires              TEXT,
+    valid_from           TEXT,
+    valid_to             TEXT,
+    created_at           TEXT,
+    updated_at           TEXT,
+    -- removed_at is when the virtual card was no longer returned by the Extend API.
+    removed_at           TEXT,
+    -- transactions_authed_at is the high-water mark of the synced transactions.
+    transactions_authed_at TEXT,
+    -- data is the virtual card JSON.
+    data                 TEXT    NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS recurrences
+(
+    virtual_card_id    TEXT PRIMARY KEY REFERENCES virtual_cards (id) ON DELETE CASCADE,
+    balance_cents      INTEGER NOT NULL,
+    period             TEXT,
+    interval           INTEGER NOT NULL,
+    terminator         TEXT,
+    count              INTEGER NOT NULL,
+    until              TEXT,
+    next_recurrence_at TEXT
+);
+
+CREATE TABLE IF NOT EXISTS mcc_ranges
+(
+    virtual_card_id TEXT NOT NULL REFERENCES virtual_cards (id) ON DELETE CASCADE,
+    lowest          TEXT NOT NULL,
+    highest         TEXT NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS mcc_ranges_virtual_card_id ON mcc_ranges (virtual_card_id);
+
+CREATE TABLE IF NOT EXISTS transactions
+(
+    id                             TEXT PRIMARY KEY,
+    virtual_card_id                TEXT    NOT NULL REFERENCES virtual_cards (id),
+    type                           TEXT,
+    status                         TEXT,
+    merchant_name                  TEXT,
+    mcc                            TEXT,
+    mcc_group                      TEXT,
+    auth_billing_amount_cents      INTEGER NOT NULL,
+    auth_billing_currency          TEXT,
+    clearing_billing_amount_cents  INTEGER NOT NULL,
+    clearing_billing_currency      TEXT,
+    authed_at                      TEXT,
+    cleared_at                     TEXT,
+    updated_at                     TEXT,
+    -- data is the transaction JSON.
+    data                           TEXT    NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS transactions_virtual_card_id ON transactions (virtual_card_id, authed_at);
+
+CREATE TABLE IF NOT EXISTS syncs
+(
+    id           INTEGER PRIMARY KEY AUTOINCREMENT,
+    started_at   TEXT    NOT NULL,
+    finished_at  TEXT    NOT NULL,
+    cards        INTEGER NOT NULL,
+    transactions INTEGER NOT NULL,
+    removed      INTEGER NOT NULL
+);
@@ -0,0 +1,227 @@
+// Copyright 2022 c-fraser
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package plan manages virtual cards declaratively, by planning, and applying, the changes which
+// reconcile the live virtual cards with a manifest of the desired virtual cards.
+//
+// The manifest is YAML, for example:
+//
+//	creditCardId: cc_1234
+//	cards:
+//	  - name: aws
+//	    displayName: AWS
+//	    recipient: ops@example.com
+//	    balanceCents: 50000
+//	    validTo: 2030-01-01
+//	    recurrence:
+//	      balanceCents: 50000
+//	      period: MONTHLY
+//	      interval: 1
+//	      terminator: NONE
+//	      byMonthDay: 1
+//	    mccGroups: [digital-goods]
+//
+// The virtual cards are owned by a State, which maps the name of each card in the manifest to the
+// ID of its virtual card. Only owned virtual cards are updated, or cancelled (when removed from the
+// manifest), so virtual cards managed otherwise are never changed. An existing virtual card is
+// adopted by setting the id of the card in the manifest.
+package plan
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/c-fraser/extendz/pkg/client"
+	"github.com/c-fraser/extendz/pkg/mcc"
+	"gopkg.in/yaml.v3"
+)
+
+// Manifest is the desired virtual cards.
+type Manifest struct {
+	// CreditCardID is the default credit card of the cards.
+	CreditCardID string `json:"creditCardId"`
+	// Currency is the default currency of the cards.
+	Currency string `json:"currency"`
+	// Cards are the desired virtual cards.
+	Cards []Card `json:"cards"`
+}
+
+// Card is a desired virtual card.
+//
+// The optional fields which are unset aren't managed, so they are never updated, except the
+// recurrence, which is removed if unset.
+type Card struct {
+	// Name identifies the card in the manifest, and State, so it must be unique and unchanged.
+	Name string `json:"name"`
+	// ID is the ID of an existing virtual card to adopt, if the card isn't owned yet.
+	ID                 string             `json:"id"`
+	CreditCardID       string             `json:"creditCardId"`
+	Recipient          string             `json:"recipient"`
+	RecipientFirstName string             `json:"recipientFirstName"`
+	RecipientLastName  string             `json:"recipientLastName"`
+	Cardholder         string             `json:"cardholder"`
+	DisplayName        string             `json:"displayName"`
+	Notes              *string            `json:"notes"`
+	BalanceCents       int                `json:"balanceCents"`
+	Currency           string             `json:"currency"`
+	ValidFrom          *client.Timestamp  `json:"validFrom"`
+	ValidTo            *client.Timestamp  `json:"validTo"`
+	Recurrence         *client.Recurrence `json:"recurrence"`
+	ValidMccRanges     *[]client.MccRange `json:"validMccRanges"`
+	// MccGroups are the MCC groups (see the mcc package) whose ranges are added to the
+	// ValidMccRanges.
+	MccGroups []string `json:"mccGroups"`
+}
+
+// ReadManifest reads, and validates, the YAML Manifest.
+func ReadManifest(r io.Reader) (*Manifest, error) {
+	var node yaml.Node
+	if err := yaml.NewDecoder(r).Decode(&node); err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	value, err := plain(&node)
+	if err != nil {
+		return nil, err
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	var m Manifest
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&m); err != nil {
+		return nil, fmt.Errorf("invalid manifest: %w", err)
+	}
+	names := make(map[string]bool)
+	for i, card := range m.Cards {
+		switch {
+		case card.Name == "":
+			return nil, fmt.Errorf("invalid manifest: card %d has no name", i+1)
+		case names[card.Name]:
+			return nil, fmt.Errorf("invalid manifest: duplicate card %q", card.Name)
+		}
+		names[card.Name] = true
+		if _, err := m.request(card); err != nil {
+			return nil, fmt.Errorf("invalid card %q: %w", card.Name, err)
+		}
+	}
+	return &m, nil
+}
+
+// plain returns the value of the YAML node, with the timestamps as (unparsed) strings, so they are
+// parsed as client.Timestamp values.
+func plain(node *yaml.Node) (any, error) {
+	switch node.Kind {
+	case 0:
+		return nil, nil
+	case yaml.DocumentNode:
+		return plain(node.Content[0])
+	case yaml.AliasNode:
+		return plain(node.Alias)
+	case yaml.MappingNode:
+		m := make(map[string]any, len(node.Content)/2)
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			v, err := plain(node.Content[i+1])
+			if err != nil {
+				return nil, err
+			}
+			m[node.Content[i].Value] = v
+		}
+		return m, nil
+	case yaml.SequenceNode:
+		s := make([]any, len(node.Content))
+		for i, n := range node.Content {
+			v, err := plain(n)
+			if err != nil {
+				return nil, err
+			}
+			s[i] = v
+		}
+		return s, nil
+	default:
+		if node.ShortTag() == "!!timestamp" {
+			return node.Value, nil
+		}
+		var v any
+		err := node.Decode(&v)
+		return v, err
+	}
+}
+
+// request returns the (validated) CreateVirtualCardRequest of the card.
+func (m *Manifest) request(card Card) (*client.CreateVirtualCardRequest, error) {
+	r := &client.CreateVirtualCardRequest{
+		CreditCardID:       card.CreditCardID,
+		Recipient:          card.Recipient,
+		RecipientFirstName: card.RecipientFirstName,
+		RecipientLastName:  card.RecipientLastName,
+		Cardholder:         card.Cardholder,
+		DisplayName:        card.DisplayName,
+		BalanceCents:       card.BalanceCents,
+		Currency:           card.Currency,
+		ValidFrom:          card.ValidFrom,
+		ValidTo:            card.ValidTo,
+		Recurs:             card.Recurrence != nil,
+	}
+	if card.Recurrence != nil {
+		r.Recurrence = client.Ptr(card.Recurrence.Request())
+	}
+	if r.CreditCardID == "" {
+		r.CreditCardID = m.CreditCardID
+	}
+	if r.Currency == "" {
+		r.Currency = m.Currency
+	}
+	if card.Notes != nil {
+		r.Notes = *card.Notes
+	}
+	ranges, err := card.ranges()
+	if err != nil {
+		return nil, err
+	}
+	if ranges != nil {
+		r.ValidMccRanges = *ranges
+	}
+	if err := r.Validate(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// ranges returns the normalized ValidMccRanges, and ranges of the MccGroups, of the card, nil if
+// neither is set.
+func (c Card) ranges() (*[]client.MccRange, error) {
+	if c.ValidMccRanges == nil && len(c.MccGroups) == 0 {
+		return nil, nil
+	}
+	ranges, err := mcc.Ranges(c.MccGroups...)
+	if err != nil {
+		return nil, err
+	}
+	if c.ValidMccRanges != nil {
+		ranges = append(ranges, *c.ValidMccRanges...)
+	}
+	ranges, err = mcc.Normalize(ranges)
+	if err != nil {
+		return nil, err
+	}
+	if ranges == nil {
+		ranges = []client.MccRange{}
+	}
+	return &ranges, nil
+}
@@ -0,0 +1,319 @@
+// Copyright 2022 c-fraser
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package plan
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/c-fraser/extendz/pkg/client"
+	"github.com/c-fraser/extendz/pkg/mcc"
+)
+
+// Action is the action of a Change.
+type Action string
+
+const (
+	// Create creates the virtual card of a Card which isn't owned, or whose virtual card is no
+	// longer active.
+	Create Action = "create"
+	// Update updates the virtual card of a Card which differs from the Card.
+	Update Action = "update"
+	// Adopt owns the existing virtual card of a Card, which doesn't differ from the Card.
+	Adopt Action = "adopt"
+	// Cancel cancels the (active) virtual card of a Card removed from the Manifest.
+	Cancel Action = "cancel"
+	// Forget disowns the inactive virtual card of a Card removed from the Manifest.
+	Forget Action = "forget"
+)
+
+// API is the subset of the client.Client operations used by Apply.
+type API interface {
+	CreateVirtualCard(request *client.CreateVirtualCardRequest) (*client.VirtualCardResponse, error)
+	UpdateVirtualCard(id string, request *client.UpdateVirtualCardRequest) (*client.VirtualCardResponse, error)
+	CancelVirtualCard(id string) (*client.VirtualCardResponse, error)
+}
+
+// Plan is the changes which reconcile the live virtual cards with a Manifest.
+type Plan struct {
+	Changes []Change `json:"changes"`
+}
+
+// IsEmpty returns whether the Plan has no changes.
+func (p *Plan) IsEmpty() bool {
+	return len(p.Changes) == 0
+}
+
+// Change is a change of the virtual card of a Card.
+type Change struct {
+	Action Action `json:"action"`
+	// Name is the name of the Card.
+	Name string `json:"name"`
+	// CardID is the ID of the virtual card, empty if it's (yet to be) created.
+	CardID string `json:"cardId,omitempty"`
+	// Fields are the fields created, or updated, by the Change.
+	Fields []FieldChange `json:"fields,omitempty"`
+	// Warnings describe the differences which can't be reconciled, or the virtual card replaced.
+	Warnings []string `json:"warnings,omitempty"`
+	create   *client.CreateVirtualCardRequest
+	update   *client.UpdateVirtualCardRequest
+}
+
+// FieldChange is the change of a field of a virtual card, with the values as (compact) JSON, except
+// strings.
+type FieldChange struct {
+	Field string `json:"field"`
+	From  string `json:"from,omitempty"`
+	To    string `json:"to"`
+}
+
+// New returns the Plan which reconciles the live virtual cards with the Manifest, given the owned
+// virtual cards in the State, which should be resolved (see State.Resolve).
+func New(m *Manifest, state *State, live []client.VirtualCard) (*Plan, error) {
+	cards := make(map[string]client.VirtualCard, len(live))
+	for _, vc := range live {
+		cards[vc.ID] = vc
+	}
+	p := &Plan{}
+	desired := make(map[string]bool, len(m.Cards))
+	for _, card := range m.Cards {
+		desired[card.Name] = true
+		request, err := m.request(card)
+		if err != nil {
+			return nil, fmt.Errorf("invalid card %q: %w", card.Name, err)
+		}
+		id := state.Cards[card.Name].ID
+		adopt := id == "" && card.ID != ""
+		if adopt {
+			id = card.ID
+		}
+		vc, found := cards[id]
+		if id == "" || !found || !active(vc) {
+			change := Change{Action: Create, Name: card.Name, create: request, Fields: fields(nil, request)}
+			switch {
+			case id != "" && !found:
+				change.Warnings = append(change.Warnings, fmt.Sprintf("replaces %s, which wasn't found", id))
+			case id != "":
+				change.Warnings = append(change.Warnings, fmt.Sprintf("replaces %s, which is %s", id, vc.Status))
+			}
+			p.Changes = append(p.Changes, change)
+			continue
+		}
+		current, want, err := compare(vc, card, request)
+		if err != nil {
+			return nil, fmt.Errorf("invalid card %q: %w", card.Name, err)
+		}
+		update := client.DiffVirtualCard(current, want)
+		change := Change{Action: Update, Name: card.Name, CardID: id, update: update, Fields: fields(current, update)}
+		if card.Recipient != "" && vc.Recipient.Email != "" && !strings.EqualFold(card.Recipient, vc.Recipient.Email) {
+			change.Warnings = append(change.Warnings, fmt.Sprintf(
+				"the recipient is %s, rather than %s, which can't be updated", vc.Recipient.Email, card.Recipient))
+		}
+		switch {
+		case !update.IsEmpty():
+			p.Changes = append(p.Changes, change)
+		case adopt:
+			change.Action = Adopt
+			p.Changes = append(p.Changes, change)
+		case len(change.Warnings) > 0:
+			p.Changes = append(p.Changes, change)
+		}
+	}
+	names := make([]string, 0, len(state.Cards))
+	for name := range state.Cards {
+		if !desired[name] {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		id := state.Cards[name].ID
+		if vc, found := cards[id]; found && active(vc) {
+			p.Changes = append(p.Changes, Change{Action: Cancel, Name: name, CardID: id})
+		} else {
+			p.Changes = append(p.Changes, Change{Action: Forget, Name: name, CardID: id})
+		}
+	}
+	return p, nil
+}
+
+// active returns whether the virtual card is active, or pending activation.
+func active(vc client.VirtualCard) bool {
+	switch vc.Status {
+	case client.VirtualCardStatusActive, client.VirtualCardStatusPending:
+		return true
+	default:
+		return false
+	}
+}
+
+// compare returns the current, and desired, virtual card of the card to diff, with the unmanaged
+// fields of the desired virtual card equal to the current virtual card.
+//
+// The limit of the current virtual card is its balance to compare, since the balance of a virtual
+// card decreases as it's spent, the MCC ranges of the virtual cards are normalized, and the floating
+// timestamps (e.g. "2030-01-01" of the Manifest) are resolved in the time zone of the virtual card,
+// so only the instants of the timestamps are compared.
+func compare(vc client.VirtualCard, card Card, request *client.CreateVirtualCardRequest) (client.VirtualCard, client.VirtualCard, error) {
+	loc := vc.Location()
+	current := vc
+	if current.LimitCents != 0 {
+		current.BalanceCents = current.LimitCents
+	}
+	current.ValidFrom = zoned(current.ValidFrom, loc)
+	current.ValidTo = zoned(current.ValidTo, loc)
+	current.Recurrence.Until = zoned(current.Recurrence.Until, loc)
+	if ranges, err := mcc.Normalize(current.ValidMccRanges); err == nil {
+		current.ValidMccRanges = ranges
+	}
+	desired := current
+	desired.CreditCardID = request.CreditCardID
+	desired.DisplayName = request.DisplayName
+	desired.BalanceCents = request.BalanceCents
+	if request.Currency != "" {
+		desired.Currency = request.Currency
+	}
+	if card.Notes != nil {
+		desired.Notes = *card.Notes
+		if key := client.IdempotencyKeyOf(current.Notes); key != "" {
+			desired.Notes = client.NotesWithIdempotencyKey(desired.Notes, key)
+		}
+	}
+	if card.ValidFrom != nil {
+		desired.ValidFrom = zoned(*card.ValidFrom, loc)
+	}
+	if card.ValidTo != nil {
+		desired.ValidTo = zoned(*card.ValidTo, loc)
+	}
+	desired.Recurs = card.Recurrence != nil
+	if card.Recurrence != nil {
+		desired.Recurrence = *card.Recurrence
+		desired.Recurrence.Until = zoned(desired.Recurrence.Until, loc)
+	}
+	ranges, err := card.ranges()
+	if err != nil {
+		return current, desired, err
+	}
+	if ranges != nil {
+		desired.ValidMccRanges = *ranges
+	}
+	return current, desired, nil
+}
+
+// zoned returns the Timestamp with a UTC offset, the wall clock time of a floating Timestamp
+// interpreted in the location.
+func zoned(t client.Timestamp, loc *time.Location) client.Timestamp {
+	if !t.IsFloating() {
+		return t
+	}
+	return client.NewTimestamp(t.In(loc))
+}
+
+// fields returns the FieldChange values of the (JSON) fields set by the request, from the values of
+// the fields of the current virtual card (if any).
+func fields(current any, request any) []FieldChange {
+	to := jsonObject(request)
+	from := jsonObject(current)
+	names := make([]string, 0, len(to))
+	for name := range to {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var changes []FieldChange
+	for _, name := range names {
+		c := FieldChange{Field: name, To: jsonText(to[name])}
+		if v, ok := from[name]; ok {
+			c.From = jsonText(v)
+		}
+		if c.From != c.To {
+			changes = append(changes, c)
+		}
+	}
+	return changes
+}
+
+// jsonObject returns the JSON object of the value, nil if it isn't an object.
+func jsonObject(v any) map[string]json.RawMessage {
+	var o map[string]json.RawMessage
+	if data, err := json.Marshal(v); err == nil {
+		_ = json.Unmarshal(data, &o)
+	}
+	return o
+}
+
+// jsonText returns the JSON value as text, strings unquoted.
+func jsonText(data json.RawMessage) string {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		return s
+	}
+	return string(data)
+}
+
+// Apply the Plan to the virtual cards, and the State, in order, stopping at the first error. The
+// checkpoint (e.g. State.Save) is called with the State after each change, and before each
+// creation, so the State records the idempotency key of the creation in case it fails.
+//
+// The CardID of each created virtual card is set on its Change.
+func Apply(api API, p *Plan, state *State, checkpoint func(state *State) error) error {
+	for i := range p.Changes {
+		change := &p.Changes[i]
+		resource := state.Cards[change.Name]
+		switch change.Action {
+		case Create:
+			if resource.ID != "" || resource.IdempotencyKey == "" {
+				resource = Resource{IdempotencyKey: client.NewIdempotencyKey()}
+				state.Cards[change.Name] = resource
+				if err := checkpoint(state); err != nil {
+					return err
+				}
+			}
+			request := *change.create
+			request.IdempotencyKey = resource.IdempotencyKey
+			response, err := api.CreateVirtualCard(&request)
+			if err != nil {
+				return fmt.Errorf("failed to create %q: %w", change.Name, err)
+			}
+			if response.VirtualCard.ID == "" {
+				return fmt.Errorf("failed to create %q: no virtual card was returned", change.Name)
+			}
+			change.CardID = response.VirtualCard.ID
+		case Update:
+			if !change.update.IsEmpty() {
+				if _, err := api.UpdateVirtualCard(change.CardID, change.update); err != nil {
+					return fmt.Errorf("failed to update %q: %w", change.Name, err)
+				}
+			}
+		case Cancel:
+			if _, err := api.CancelVirtualCard(change.CardID); err != nil {
+				return fmt.Errorf("failed to cancel %q: %w", change.Name, err)
+			}
+		}
+		switch change.Action {
+		case Cancel, Forget:
+			delete(state.Cards, change.Name)
+		default:
+			resource.ID = change.CardID
+			state.Cards[change.Name] = resource
+		}
+		if err := checkpoint(state); err != nil {
+			return err
+		}
+	}
+	return nil
+}
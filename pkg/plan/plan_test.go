@@ -0,0 +1,277 @@
+// Copyright 2022 c-fraser
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package plan
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/c-fraser/extendz/pkg/client"
+)
+
+const testManifest = `
+creditCardId: cc_1
+cards:
+  - name: aws
+    displayName: AWS
+    recipient: ops@example.com
+    balanceCents: 50000
+    validTo: 2030-01-01
+    recurrence:
+      balanceCents: 50000
+      period: MONTHLY
+      interval: 1
+      terminator: NONE
+      byMonthDay: 1
+    mccGroups: [digital-goods]
+  - name: travel
+    displayName: Travel
+    recipient: travel@example.com
+    balanceCents: 10000
+    notes: Flights
+  - name: legacy
+    id: vc_legacy
+    displayName: Legacy
+    recipient: ops@example.com
+    balanceCents: 2000
+`
+
+// testAPI is an API which creates cards with the ID of the display name, and fails to create the
+// cards named in fail, and lists the cards.
+type testAPI struct {
+	cards     []client.VirtualCard
+	created   []client.CreateVirtualCardRequest
+	updated   map[string]client.UpdateVirtualCardRequest
+	cancelled []string
+	fail      map[string]bool
+}
+
+func (a *testAPI) CreateVirtualCard(request *client.CreateVirtualCardRequest) (*client.VirtualCardResponse, error) {
+	if a.fail[request.DisplayName] {
+		return nil, errors.New("timeout")
+	}
+	a.created = append(a.created, *request)
+	return &client.VirtualCardResponse{VirtualCard: client.VirtualCard{ID: "vc_" + strings.ToLower(request.DisplayName)}}, nil
+}
+
+func (a *testAPI) GetUserVirtualCards(*client.VirtualCardPageableRequest) (*client.VirtualCardsResponse, error) {
+	return &client.VirtualCardsResponse{VirtualCards: a.cards}, nil
+}
+
+func (a *testAPI) UpdateVirtualCard(id string, request *client.UpdateVirtualCardRequest) (*client.VirtualCardResponse, error) {
+	if a.updated == nil {
+		a.updated = make(map[string]client.UpdateVirtualCardRequest)
+	}
+	a.updated[id] = *request
+	return &client.VirtualCardResponse{VirtualCard: client.VirtualCard{ID: id}}, nil
+}
+
+func (a *testAPI) CancelVirtualCard(id string) (*client.VirtualCardResponse, error) {
+	a.cancelled = append(a.cancelled, id)
+	return &client.VirtualCardResponse{VirtualCard: client.VirtualCard{ID: id}}, nil
+}
+
+func TestReadManifest(t *testing.T) {
+	m, err := ReadManifest(strings.NewReader(testManifest))
+	if err != nil {
+		t.Fatalf("Failed to read manifest: %v", err)
+	}
+	if len(m.Cards) != 3 {
+		t.Fatalf("Unexpected cards: %v", m.Cards)
+	}
+	aws := m.Cards[0]
+	if aws.ValidTo == nil || aws.ValidTo.Year() != 2030 || aws.Recurrence == nil || aws.Recurrence.ByMonthDay != 1 {
+		t.Errorf("Unexpected card: %+v", aws)
+	}
+	request, err := m.request(aws)
+	if err != nil {
+		t.Fatalf("Failed to create request: %v", err)
+	}
+	if request.CreditCardID != "cc_1" || !request.Recurs || len(request.ValidMccRanges) == 0 {
+		t.Errorf("Unexpected request: %+v", request)
+	}
+	for _, manifest := range []string{
+		"cards: [{displayName: A}]",
+		"cards: [{name: a, displayName: A}, {name: a, displayName: B}]",
+		"cards: [{name: a, displayName: A, unknown: true}]",
+		"cards: [{name: a, displayName: A, mccGroups: [unknown]}]",
+	} {
+		if _, err := ReadManifest(strings.NewReader(manifest)); err == nil {
+			t.Errorf("Expected invalid manifest: %s", manifest)
+		}
+	}
+}
+
+func TestPlanAndApply(t *testing.T) {
+	m, err := ReadManifest(strings.NewReader(testManifest))
+	if err != nil {
+		t.Fatalf("Failed to read manifest: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "state.json")
+	state, err := LoadState(path)
+	if err != nil {
+		t.Fatalf("Failed to load state: %v", err)
+	}
+	state.Cards["old"] = Resource{ID: "vc_old"}
+	state.Cards["gone"] = Resource{ID: "vc_gone"}
+	live := []client.VirtualCard{
+		{ID: "vc_old", Status: client.VirtualCardStatusActive, DisplayName: "Old"},
+		{ID: "vc_gone", Status: client.VirtualCardStatusCancelled, DisplayName: "Gone"},
+		{
+			ID:           "vc_legacy",
+			Status:       client.VirtualCardStatusActive,
+			CreditCardID: "cc_1",
+			DisplayName:  "Legacy",
+			Recipient:    client.User{Email: "ops@example.com"},
+			LimitCents:   2000,
+			BalanceCents: 500,
+		},
+	}
+	p, err := New(m, state, live)
+	if err != nil {
+		t.Fatalf("Failed to plan: %v", err)
+	}
+	var actions []string
+	for _, c := range p.Changes {
+		actions = append(actions, string(c.Action)+" "+c.Name)
+	}
+	if s := strings.Join(actions, ", "); s != "create aws, create travel, adopt legacy, forget gone, cancel old" {
+		t.Fatalf("Unexpected plan: %s", s)
+	}
+
+	api := &testAPI{fail: map[string]bool{"Travel": true}}
+	checkpoint := func(s *State) error { return s.Save(path) }
+	if err := Apply(api, p, state, checkpoint); err == nil {
+		t.Fatalf("Expected the creation of travel to fail")
+	}
+	state, err = LoadState(path)
+	if err != nil {
+		t.Fatalf("Failed to load state: %v", err)
+	}
+	key := state.Cards["travel"].IdempotencyKey
+	if state.Cards["aws"].ID != "vc_aws" || state.Cards["travel"].ID != "" || key == "" {
+		t.Fatalf("Unexpected state: %v", state.Cards)
+	}
+
+	// The live virtual card of aws has the notes of an idempotent creation, is spent, and has the
+	// zoned validTo of the manifest, in its time zone.
+	awsRequest := api.created[0]
+	validTo, err := client.ParseTimestamp("2030-01-01T05:00:00.000+0000")
+	if err != nil {
+		t.Fatalf("Failed to parse timestamp: %v", err)
+	}
+	live = append(live, client.VirtualCard{
+		ID:             "vc_aws",
+		Status:         client.VirtualCardStatusActive,
+		CreditCardID:   awsRequest.CreditCardID,
+		DisplayName:    awsRequest.DisplayName,
+		Notes:          client.NotesWithIdempotencyKey("", awsRequest.IdempotencyKey),
+		Recipient:      client.User{Email: "ops@example.com"},
+		LimitCents:     awsRequest.BalanceCents,
+		BalanceCents:   100,
+		ValidTo:        validTo,
+		Timezone:       "America/New_York",
+		Recurs:         true,
+		Recurrence:     *m.Cards[0].Recurrence,
+		ValidMccRanges: awsRequest.ValidMccRanges,
+	})
+	api.fail = nil
+	p, err = New(m, state, live)
+	if err != nil {
+		t.Fatalf("Failed to plan: %v", err)
+	}
+	if len(p.Changes) != 4 || p.Changes[0].Action != Create || p.Changes[0].Name != "travel" {
+		t.Fatalf("Unexpected plan: %+v", p.Changes)
+	}
+	aws := &Manifest{CreditCardID: m.CreditCardID, Cards: m.Cards[:1]}
+	if p, err := New(aws, &State{Cards: map[string]Resource{"aws": state.Cards["aws"]}}, live); err != nil || !p.IsEmpty() {
+		t.Fatalf("Unexpected plan of aws: %+v, %v", p, err)
+	}
+	if err := Apply(api, p, state, checkpoint); err != nil {
+		t.Fatalf("Failed to apply: %v", err)
+	}
+	if created := api.created[len(api.created)-1]; created.IdempotencyKey != key {
+		t.Errorf("Unexpected idempotency key of retried creation: %s", created.IdempotencyKey)
+	}
+	if len(api.cancelled) != 1 || api.cancelled[0] != "vc_old" {
+		t.Errorf("Unexpected cancelled cards: %v", api.cancelled)
+	}
+	state, _ = LoadState(path)
+	if len(state.Cards) != 3 || state.Cards["legacy"].ID != "vc_legacy" || state.Cards["travel"].ID != "vc_travel" {
+		t.Errorf("Unexpected state: %v", state.Cards)
+	}
+
+	// The display name of legacy is changed.
+	m.Cards[2].DisplayName = "Legacy 2"
+	p, err = New(m, state, live[2:])
+	if err != nil {
+		t.Fatalf("Failed to plan: %v", err)
+	}
+	var legacy *Change
+	for i := range p.Changes {
+		if p.Changes[i].Name == "legacy" {
+			legacy = &p.Changes[i]
+		}
+	}
+	if legacy == nil || legacy.Action != Update || len(legacy.Fields) != 1 ||
+		legacy.Fields[0] != (FieldChange{Field: "displayName", From: "Legacy", To: "Legacy 2"}) {
+		t.Fatalf("Unexpected change: %+v", legacy)
+	}
+	if err := Apply(api, &Plan{Changes: []Change{*legacy}}, state, checkpoint); err != nil {
+		t.Fatalf("Failed to apply: %v", err)
+	}
+	if u := api.updated["vc_legacy"]; u.DisplayName == nil || *u.DisplayName != "Legacy 2" {
+		t.Errorf("Unexpected update: %+v", u)
+	}
+}
+
+func TestResolve(t *testing.T) {
+	m, err := ReadManifest(strings.NewReader(testManifest))
+	if err != nil {
+		t.Fatalf("Failed to read manifest: %v", err)
+	}
+	m.Cards = nil
+	// The creation of orphan timed out, but the virtual card was created, and the creation of lost
+	// failed.
+	orphan := client.VirtualCard{
+		ID:          "vc_orphan",
+		Status:      client.VirtualCardStatusActive,
+		DisplayName: "Orphan",
+		Notes:       client.NotesWithIdempotencyKey("", "key_orphan"),
+	}
+	state := &State{Cards: map[string]Resource{
+		"orphan": {IdempotencyKey: "key_orphan"},
+		"lost":   {IdempotencyKey: "key_lost"},
+	}}
+	if err := state.Resolve(&testAPI{cards: []client.VirtualCard{orphan}}); err != nil {
+		t.Fatalf("Failed to resolve state: %v", err)
+	}
+	if state.Cards["orphan"].ID != "vc_orphan" || state.Cards["lost"].ID != "" {
+		t.Fatalf("Unexpected state: %v", state.Cards)
+	}
+	p, err := New(m, state, []client.VirtualCard{orphan})
+	if err != nil {
+		t.Fatalf("Failed to plan: %v", err)
+	}
+	var actions []string
+	for _, c := range p.Changes {
+		actions = append(actions, string(c.Action)+" "+c.Name+" "+c.CardID)
+	}
+	if s := strings.Join(actions, ", "); s != "forget lost , cancel orphan vc_orphan" {
+		t.Errorf("Unexpected plan: %s", s)
+	}
+}
@@ -0,0 +1,105 @@
+// Copyright 2022 c-fraser
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package plan
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/c-fraser/extendz/pkg/client"
+)
+
+// State is the virtual cards owned by a Manifest.
+type State struct {
+	// Cards are the owned virtual cards, by the name of their Card.
+	Cards map[string]Resource `json:"cards"`
+}
+
+// Resource is an owned virtual card.
+type Resource struct {
+	// ID is the ID of the virtual card, empty if its creation hasn't succeeded (yet).
+	ID string `json:"id,omitempty"`
+	// IdempotencyKey is the idempotency key of the creation of the virtual card, so a creation
+	// which failed, e.g. timed out, doesn't create a duplicate when it's applied again.
+	IdempotencyKey string `json:"idempotencyKey,omitempty"`
+}
+
+// LoadState loads the State from the JSON file at the path, an empty State if the file doesn't
+// exist.
+func LoadState(path string) (*State, error) {
+	s := &State{Cards: make(map[string]Resource)}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, s); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	if s.Cards == nil {
+		s.Cards = make(map[string]Resource)
+	}
+	return s, nil
+}
+
+// Resolve sets the ID of each owned virtual card which has an IdempotencyKey, but no ID, to the
+// virtual card found by the key, since the creation may have succeeded even though it failed, e.g.
+// timed out. Otherwise, the virtual card of a Card removed from the Manifest would be forgotten,
+// rather than cancelled.
+//
+// The most recently created virtual cards are searched, see client.FindVirtualCardByIdempotencyKey.
+func (s *State) Resolve(lister client.VirtualCardLister) error {
+	for name, resource := range s.Cards {
+		if resource.ID != "" || resource.IdempotencyKey == "" {
+			continue
+		}
+		vc, err := client.FindVirtualCardByIdempotencyKey(
+			lister, &client.CreateVirtualCardRequest{IdempotencyKey: resource.IdempotencyKey})
+		if err != nil {
+			return fmt.Errorf("failed to find the virtual card of %q: %w", name, err)
+		}
+		if vc != nil {
+			resource.ID = vc.ID
+			s.Cards[name] = resource
+		}
+	}
+	return nil
+}
+
+// Save the State to the JSON file at the path, atomically.
+func (s *State) Save(path string) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,498 @@
+// Copyright 2022 c-fraser
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package policy enforces internal spend policy, on top of the controls of Extend, by evaluating
+// rules against the virtual cards and transactions, and optionally remediating the violations.
+//
+// The policy is YAML, for example:
+//
+//	timezone: America/New_York
+//	rules:
+//	  - name: card-limit
+//	    kind: max-limit
+//	    cents: 500000
+//	    remediation: update
+//	  - name: no-finance
+//	    kind: banned-mcc-groups
+//	    groups: [financial]
+//	    remediation: update
+//	  - name: gl-code
+//	    kind: required-reference-fields
+//	    fields: [GL Code]
+//	  - name: weekdays
+//	    kind: no-weekend-spend
+package policy
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/c-fraser/extendz/pkg/client"
+	"github.com/c-fraser/extendz/pkg/mcc"
+	"gopkg.in/yaml.v3"
+)
+
+// Kind is the kind of a Rule.
+type Kind string
+
+const (
+	// MaxLimit limits the limit of each virtual card to the Cents of the Rule.
+	MaxLimit Kind = "max-limit"
+	// MaxRecipientLimit limits the total limit of the active virtual cards of each recipient to the
+	// Cents of the Rule.
+	MaxRecipientLimit Kind = "max-recipient-limit"
+	// BannedMccGroups bans the merchant categories of the Groups of the Rule, so neither virtual
+	// cards which allow them, nor transactions of them, are permitted.
+	BannedMccGroups Kind = "banned-mcc-groups"
+	// RequiredReferenceFields requires each transaction to have the reference Fields of the Rule.
+	RequiredReferenceFields Kind = "required-reference-fields"
+	// MaxLifetimeSpend limits the lifetime spend of each virtual card to the Cents of the Rule.
+	MaxLifetimeSpend Kind = "max-lifetime-spend"
+	// MaxValidity limits the validity, from ValidFrom (or creation) to ValidTo, of each virtual card
+	// to the Days of the Rule.
+	MaxValidity Kind = "max-validity"
+	// NoWeekendSpend prohibits transactions on Saturday and Sunday, in the time zone of the Policy.
+	NoWeekendSpend Kind = "no-weekend-spend"
+)
+
+// Kinds returns the Kind values.
+func Kinds() []Kind {
+	return []Kind{
+		MaxLimit,
+		MaxRecipientLimit,
+		BannedMccGroups,
+		RequiredReferenceFields,
+		MaxLifetimeSpend,
+		MaxValidity,
+		NoWeekendSpend,
+	}
+}
+
+// Remediation is the remediation of the violations of a Rule.
+type Remediation string
+
+const (
+	// None doesn't remediate the violations, they are only reported.
+	None Remediation = "none"
+	// Update updates the virtual card to comply with the Rule.
+	Update Remediation = "update"
+	// Cancel cancels the virtual card.
+	Cancel Remediation = "cancel"
+)
+
+// updatable are the kinds of rules which can be remediated by an Update.
+var updatable = map[Kind]bool{MaxLimit: true, BannedMccGroups: true, MaxValidity: true}
+
+// Policy is the rules of the spend policy.
+type Policy struct {
+	// Timezone is the IANA time zone of the days of the transactions, UTC by default.
+	Timezone string `yaml:"timezone"`
+	Rules    []Rule `yaml:"rules"`
+	// loc is the location of the Timezone.
+	loc *time.Location
+}
+
+// Rule is a rule of the Policy, with the parameters of its Kind.
+type Rule struct {
+	// Name identifies the Rule in the violations.
+	Name string `yaml:"name"`
+	Kind Kind   `yaml:"kind"`
+	// Cents is the amount of the MaxLimit, MaxRecipientLimit and MaxLifetimeSpend rules.
+	Cents int `yaml:"cents"`
+	// Currency restricts the Rule to the virtual cards, and transactions, of the currency.
+	Currency string `yaml:"currency"`
+	// Groups are the MCC groups (see the mcc package) of a BannedMccGroups rule.
+	Groups []string `yaml:"groups"`
+	// Fields are the reference field codes, or labels, of a RequiredReferenceFields rule.
+	Fields []string `yaml:"fields"`
+	// Days is the number of days of a MaxValidity rule.
+	Days int `yaml:"days"`
+	// Remediation is the remediation of the violations of the Rule, None by default.
+	Remediation Remediation `yaml:"remediation"`
+	// banned are the MCC ranges of the Groups.
+	banned []client.MccRange
+}
+
+// ReadPolicy reads, and validates, the YAML Policy.
+func ReadPolicy(r io.Reader) (*Policy, error) {
+	var p Policy
+	decoder := yaml.NewDecoder(r)
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&p); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("invalid policy: %w", err)
+	}
+	if err := p.init(); err != nil {
+		return nil, fmt.Errorf("invalid policy: %w", err)
+	}
+	return &p, nil
+}
+
+// init validates the Policy, and initializes its derived fields.
+func (p *Policy) init() error {
+	loc, err := time.LoadLocation(p.Timezone)
+	if err != nil {
+		return err
+	}
+	p.loc = loc
+	names := make(map[string]bool)
+	for i := range p.Rules {
+		rule := &p.Rules[i]
+		if rule.Name == "" {
+			rule.Name = string(rule.Kind)
+		}
+		if names[rule.Name] {
+			return fmt.Errorf("duplicate rule %q", rule.Name)
+		}
+		names[rule.Name] = true
+		if rule.Remediation == "" {
+			rule.Remediation = None
+		}
+		if err := rule.validate(); err != nil {
+			return fmt.Errorf("rule %q: %w", rule.Name, err)
+		}
+		if rule.Kind == BannedMccGroups {
+			if rule.banned, err = mcc.Ranges(rule.Groups...); err != nil {
+				return fmt.Errorf("rule %q: %w", rule.Name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// validate returns an error if the parameters, or remediation, aren't valid for the Kind.
+func (r *Rule) validate() error {
+	switch r.Kind {
+	case MaxLimit, MaxRecipientLimit, MaxLifetimeSpend:
+		if r.Cents <= 0 {
+			return errors.New("cents must be positive")
+		}
+	case BannedMccGroups:
+		if len(r.Groups) == 0 {
+			return errors.New("groups are required")
+		}
+	case RequiredReferenceFields:
+		if len(r.Fields) == 0 {
+			return errors.New("fields are required")
+		}
+	case MaxValidity:
+		if r.Days <= 0 {
+			return errors.New("days must be positive")
+		}
+	case NoWeekendSpend:
+	default:
+		return fmt.Errorf("unknown kind %q", r.Kind)
+	}
+	switch r.Remediation {
+	case None:
+	case Update:
+		if !updatable[r.Kind] {
+			return fmt.Errorf("%s can't be remediated by an update", r.Kind)
+		}
+	case Cancel:
+		if r.Kind == MaxRecipientLimit {
+			return fmt.Errorf("%s can't be remediated by a cancellation", r.Kind)
+		}
+	default:
+		return fmt.Errorf("unknown remediation %q", r.Remediation)
+	}
+	return nil
+}
+
+// applies returns whether the Rule applies to the currency.
+func (r *Rule) applies(currency string) bool {
+	return r.Currency == "" || strings.EqualFold(r.Currency, currency)
+}
+
+// Violation is a violation of a Rule by a virtual card, or transaction.
+type Violation struct {
+	Rule     string `json:"rule"`
+	Kind     Kind   `json:"kind"`
+	CardID   string `json:"cardId"`
+	CardName string `json:"cardName"`
+	// TransactionID is the ID of the transaction which violates the Rule, empty if the virtual card
+	// violates the Rule.
+	TransactionID string      `json:"transactionId,omitempty"`
+	Message       string      `json:"message"`
+	Remediation   Remediation `json:"remediation"`
+	// Update is the update of the virtual card of an Update remediation.
+	Update *client.UpdateVirtualCardRequest `json:"update,omitempty"`
+	// Remediated is whether the Remediation was applied, by Remediate.
+	Remediated bool `json:"remediated"`
+}
+
+// Check returns the violations of the Policy by the (active) virtual cards, and the (approved)
+// transactions. The violations are ordered by the rules, then the virtual cards, then the
+// transactions.
+func (p *Policy) Check(cards []client.VirtualCard, transactions []client.Transaction) []Violation {
+	var active []client.VirtualCard
+	byID := make(map[string]client.VirtualCard, len(cards))
+	for _, vc := range cards {
+		byID[vc.ID] = vc
+		if vc.Status == client.VirtualCardStatusActive {
+			active = append(active, vc)
+		}
+	}
+	var approved []client.Transaction
+	for _, tx := range transactions {
+		switch tx.Status {
+		case client.TransactionStatusDeclined, client.TransactionStatusAvsFail, client.TransactionStatusAuthReversal:
+			continue
+		}
+		if tx.Type != client.TransactionTypeCredit {
+			approved = append(approved, tx)
+		}
+	}
+	violations := []Violation{}
+	for i := range p.Rules {
+		rule := &p.Rules[i]
+		violate := func(vc client.VirtualCard, tx client.Transaction, format string, args ...any) {
+			v := Violation{
+				Rule:          rule.Name,
+				Kind:          rule.Kind,
+				CardID:        vc.ID,
+				CardName:      vc.DisplayName,
+				TransactionID: tx.ID,
+				Message:       fmt.Sprintf(format, args...),
+				Remediation:   rule.Remediation,
+			}
+			if v.CardID == "" {
+				v.CardID, v.CardName = tx.VirtualCardID, tx.VcnDisplayName
+			}
+			if v.Remediation == Update {
+				// The virtual card can't comply by an update, e.g. every MCC it allows is banned.
+				if v.Update = rule.update(vc); v.Update == nil {
+					v.Remediation = None
+				}
+			}
+			violations = append(violations, v)
+		}
+		if rule.Kind == MaxRecipientLimit {
+			p.checkRecipients(rule, active, violate)
+			continue
+		}
+		for _, vc := range active {
+			if rule.applies(vc.Currency) {
+				p.checkCard(rule, vc, violate)
+			}
+		}
+		for _, tx := range approved {
+			vc := byID[tx.VirtualCardID]
+			if rule.applies(tx.AuthBillingCurrency) && (vc.ID == "" || vc.Status == client.VirtualCardStatusActive) {
+				p.checkTransaction(rule, vc, tx, violate)
+			}
+		}
+	}
+	return violations
+}
+
+// violation reports a violation of a virtual card, or a transaction of a virtual card.
+type violation func(vc client.VirtualCard, tx client.Transaction, format string, args ...any)
+
+// checkCard checks the virtual card per the Rule.
+func (p *Policy) checkCard(rule *Rule, vc client.VirtualCard, violate violation) {
+	none := client.Transaction{}
+	switch rule.Kind {
+	case MaxLimit:
+		if vc.LimitCents > rule.Cents {
+			violate(vc, none, "limit %s exceeds %s", vc.Limit(), client.NewMoney(int64(rule.Cents), vc.Currency))
+		}
+	case BannedMccGroups:
+		if allowed := allowedBanned(vc, rule.Groups); len(allowed) > 0 {
+			violate(vc, none, "allows the banned MCC groups %s", strings.Join(allowed, ", "))
+		}
+	case MaxLifetimeSpend:
+		if vc.LifetimeSpentCents > rule.Cents {
+			violate(vc, none, "lifetime spend %s exceeds %s", vc.LifetimeSpent(), client.NewMoney(int64(rule.Cents), vc.Currency))
+		}
+	case MaxValidity:
+		from := start(vc)
+		if vc.ValidTo.IsZero() && !vc.Recurs {
+			violate(vc, none, "is valid indefinitely, rather than at most %d days", rule.Days)
+		} else if days := vc.ValidTo.Sub(from).Hours() / 24; !vc.ValidTo.IsZero() && days > float64(rule.Days) {
+			violate(vc, none, "is valid for %.0f days, rather than at most %d days", days, rule.Days)
+		}
+	}
+}
+
+// checkTransaction checks the transaction of the virtual card per the Rule.
+func (p *Policy) checkTransaction(rule *Rule, vc client.VirtualCard, tx client.Transaction, violate violation) {
+	switch rule.Kind {
+	case BannedMccGroups:
+		if tx.Mcc != "" && mcc.Contains(rule.banned, tx.Mcc) {
+			violate(vc, tx, "transaction at %s is of the banned MCC %s", tx.MerchantName, tx.Mcc)
+		}
+	case RequiredReferenceFields:
+		var missing []string
+		for _, field := range rule.Fields {
+			if !hasReferenceField(tx, field) {
+				missing = append(missing, field)
+			}
+		}
+		if len(missing) > 0 {
+			violate(vc, tx, "transaction at %s is missing the reference fields %s", tx.MerchantName, strings.Join(missing, ", "))
+		}
+	case NoWeekendSpend:
+		if tx.AuthedAt.IsZero() {
+			return
+		}
+		at := tx.AuthedAt.In(p.loc)
+		if day := at.Weekday(); day == time.Saturday || day == time.Sunday {
+			violate(vc, tx, "transaction at %s was on %s", tx.MerchantName, at.Format("Monday 2006-01-02"))
+		}
+	}
+}
+
+// checkRecipients checks the total limit of the virtual cards of each recipient per the Rule.
+func (p *Policy) checkRecipients(rule *Rule, cards []client.VirtualCard, violate violation) {
+	totals := make(map[string]int)
+	first := make(map[string]client.VirtualCard)
+	var recipients []string
+	for _, vc := range cards {
+		if !rule.applies(vc.Currency) {
+			continue
+		}
+		recipient := vc.Recipient.Email
+		if recipient == "" {
+			recipient = vc.RecipientID
+		}
+		if _, ok := first[recipient]; !ok {
+			first[recipient] = vc
+			recipients = append(recipients, recipient)
+		}
+		totals[recipient] += vc.LimitCents
+	}
+	sort.Strings(recipients)
+	for _, recipient := range recipients {
+		if total := totals[recipient]; total > rule.Cents {
+			vc := first[recipient]
+			violate(vc, client.Transaction{}, "total limit %s of the cards of %s exceeds %s",
+				client.NewMoney(int64(total), vc.Currency), recipient, client.NewMoney(int64(rule.Cents), vc.Currency))
+		}
+	}
+}
+
+// update returns the update of the virtual card which complies with the Rule, nil if there isn't
+// one (or the virtual card is unknown).
+func (r *Rule) update(vc client.VirtualCard) *client.UpdateVirtualCardRequest {
+	if vc.ID == "" {
+		return nil
+	}
+	switch r.Kind {
+	case MaxLimit:
+		return &client.UpdateVirtualCardRequest{BalanceCents: client.Ptr(r.Cents), Currency: client.Ptr(vc.Currency)}
+	case BannedMccGroups:
+		ranges := exclude(vc.ValidMccRanges, r.banned)
+		if len(ranges) == 0 {
+			return nil
+		}
+		return &client.UpdateVirtualCardRequest{ValidMccRanges: &ranges}
+	case MaxValidity:
+		to := client.NewTimestamp(start(vc).AddDate(0, 0, r.Days))
+		return &client.UpdateVirtualCardRequest{ValidTo: &to}
+	default:
+		return nil
+	}
+}
+
+// start returns the start of the validity of the virtual card, its ValidFrom, else its CreatedAt.
+func start(vc client.VirtualCard) time.Time {
+	if !vc.ValidFrom.IsZero() {
+		return vc.ValidFrom.Time
+	}
+	return vc.CreatedAt.Time
+}
+
+// hasReferenceField returns whether the transaction has a (selected) reference field with the code,
+// or label.
+func hasReferenceField(tx client.Transaction, field string) bool {
+	for _, f := range tx.ReferenceFields {
+		if (strings.EqualFold(f.FieldCode, field) || strings.EqualFold(f.FieldLabel, field)) &&
+			(f.OptionCode != "" || f.OptionLabel != "") {
+			return true
+		}
+	}
+	return false
+}
+
+// allowedBanned returns the banned groups whose merchant categories the virtual card allows.
+func allowedBanned(vc client.VirtualCard, groups []string) []string {
+	var allowed []string
+	for _, group := range groups {
+		ranges, _ := mcc.Ranges(group)
+		for _, r := range ranges {
+			if len(vc.ValidMccRanges) == 0 || overlaps(vc.ValidMccRanges, r) {
+				allowed = append(allowed, group)
+				break
+			}
+		}
+	}
+	return allowed
+}
+
+// overlaps returns whether any of the ranges overlaps the range.
+func overlaps(ranges []client.MccRange, r client.MccRange) bool {
+	for _, o := range ranges {
+		if o.Lowest <= r.Highest && r.Lowest <= o.Highest {
+			return true
+		}
+	}
+	return false
+}
+
+// exclude returns the ranges (every code if none) without the excluded ranges.
+func exclude(ranges, excluded []client.MccRange) []client.MccRange {
+	type bounds struct{ lowest, highest int }
+	parse := func(r client.MccRange) bounds {
+		var b bounds
+		_, _ = fmt.Sscan(r.Lowest, &b.lowest)
+		_, _ = fmt.Sscan(r.Highest, &b.highest)
+		return b
+	}
+	remaining := []bounds{{0, 9999}}
+	if len(ranges) > 0 {
+		remaining = nil
+		for _, r := range ranges {
+			remaining = append(remaining, parse(r))
+		}
+	}
+	for _, e := range excluded {
+		x := parse(e)
+		var next []bounds
+		for _, r := range remaining {
+			if x.highest < r.lowest || r.highest < x.lowest {
+				next = append(next, r)
+				continue
+			}
+			if r.lowest < x.lowest {
+				next = append(next, bounds{r.lowest, x.lowest - 1})
+			}
+			if x.highest < r.highest {
+				next = append(next, bounds{x.highest + 1, r.highest})
+			}
+		}
+		remaining = next
+	}
+	result := make([]client.MccRange, len(remaining))
+	for i, r := range remaining {
+		result[i] = client.MccRange{Lowest: fmt.Sprintf("%04d", r.lowest), Highest: fmt.Sprintf("%04d", r.highest)}
+	}
+	if normalized, err := mcc.Normalize(result); err == nil {
+		return normalized
+	}
+	return result
+}
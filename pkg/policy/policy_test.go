@@ -0,0 +1,181 @@
+// Copyright 2022 c-fraser
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package policy
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/c-fraser/extendz/pkg/client"
+)
+
+const testPolicy = `
+timezone: America/New_York
+rules:
+  - name: card-limit
+    kind: max-limit
+    cents: 50000
+    remediation: update
+  - name: recipient-limit
+    kind: max-recipient-limit
+    cents: 80000
+  - name: no-finance
+    kind: banned-mcc-groups
+    groups: [financial]
+    remediation: update
+  - name: gl-code
+    kind: required-reference-fields
+    fields: [GL Code]
+  - name: lifetime
+    kind: max-lifetime-spend
+    cents: 100000
+    remediation: cancel
+  - name: validity
+    kind: max-validity
+    days: 90
+    remediation: update
+  - name: weekdays
+    kind: no-weekend-spend
+`
+
+type testAPI struct {
+	updated   map[string]client.UpdateVirtualCardRequest
+	cancelled []string
+}
+
+func (a *testAPI) UpdateVirtualCard(id string, request *client.UpdateVirtualCardRequest) (*client.VirtualCardResponse, error) {
+	if a.updated == nil {
+		a.updated = make(map[string]client.UpdateVirtualCardRequest)
+	}
+	a.updated[id] = *request
+	return &client.VirtualCardResponse{VirtualCard: client.VirtualCard{ID: id}}, nil
+}
+
+func (a *testAPI) CancelVirtualCard(id string) (*client.VirtualCardResponse, error) {
+	a.cancelled = append(a.cancelled, id)
+	return &client.VirtualCardResponse{VirtualCard: client.VirtualCard{ID: id}}, nil
+}
+
+func TestReadPolicy(t *testing.T) {
+	if _, err := ReadPolicy(strings.NewReader(testPolicy)); err != nil {
+		t.Fatalf("Failed to read policy: %v", err)
+	}
+	for _, policy := range []string{
+		"rules: [{kind: unknown}]",
+		"rules: [{kind: max-limit}]",
+		"rules: [{kind: banned-mcc-groups, groups: [unknown]}]",
+		"rules: [{kind: no-weekend-spend, remediation: update}]",
+		"rules: [{kind: max-recipient-limit, cents: 1, remediation: cancel}]",
+		"rules: [{kind: no-weekend-spend}, {kind: no-weekend-spend}]",
+		"rules: [{kind: no-weekend-spend, unknown: true}]",
+		"timezone: Unknown/Zone",
+	} {
+		if _, err := ReadPolicy(strings.NewReader(policy)); err == nil {
+			t.Errorf("Expected invalid policy: %s", policy)
+		}
+	}
+}
+
+func TestCheckAndRemediate(t *testing.T) {
+	p, err := ReadPolicy(strings.NewReader(testPolicy))
+	if err != nil {
+		t.Fatalf("Failed to read policy: %v", err)
+	}
+	created := time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+	cards := []client.VirtualCard{
+		{
+			ID:             "vc_1",
+			DisplayName:    "Big",
+			Status:         client.VirtualCardStatusActive,
+			Recipient:      client.User{Email: "a@example.com"},
+			Currency:       "USD",
+			LimitCents:     60000,
+			ValidFrom:      client.NewTimestamp(created),
+			ValidTo:        client.NewTimestamp(created.AddDate(0, 0, 30)),
+			ValidMccRanges: []client.MccRange{{Lowest: "5811", Highest: "5814"}},
+		},
+		{
+			ID:                 "vc_2",
+			DisplayName:        "Open",
+			Status:             client.VirtualCardStatusActive,
+			Recipient:          client.User{Email: "a@example.com"},
+			Currency:           "USD",
+			LimitCents:         30000,
+			LifetimeSpentCents: 200000,
+			CreatedAt:          client.NewTimestamp(created),
+			ValidTo:            client.NewTimestamp(created.AddDate(1, 0, 0)),
+		},
+		{
+			ID:         "vc_3",
+			Status:     client.VirtualCardStatusCancelled,
+			LimitCents: 1000000,
+		},
+	}
+	gl := []client.ReferenceField{{FieldLabel: "GL Code", OptionCode: "6000"}}
+	transactions := []client.Transaction{
+		// Friday 23:00 in New York, Saturday in UTC.
+		{ID: "tx_1", VirtualCardID: "vc_1", Status: client.TransactionStatusCleared, AuthBillingCurrency: "USD", ReferenceFields: gl, AuthedAt: client.NewTimestamp(time.Date(2024, time.January, 6, 4, 0, 0, 0, time.UTC))},
+		// Saturday in New York.
+		{ID: "tx_2", VirtualCardID: "vc_1", Status: client.TransactionStatusPending, AuthBillingCurrency: "USD", ReferenceFields: gl, AuthedAt: client.NewTimestamp(time.Date(2024, time.January, 6, 18, 0, 0, 0, time.UTC))},
+		{ID: "tx_3", VirtualCardID: "vc_2", Status: client.TransactionStatusCleared, AuthBillingCurrency: "USD", Mcc: "6011", MerchantName: "ATM", AuthedAt: client.NewTimestamp(time.Date(2024, time.January, 8, 18, 0, 0, 0, time.UTC))},
+		{ID: "tx_4", VirtualCardID: "vc_2", Status: client.TransactionStatusDeclined, AuthBillingCurrency: "USD", Mcc: "6011", AuthedAt: client.NewTimestamp(time.Date(2024, time.January, 6, 18, 0, 0, 0, time.UTC))},
+	}
+	violations := p.Check(cards, transactions)
+	var actual []string
+	for _, v := range violations {
+		actual = append(actual, v.Rule+" "+v.CardID+" "+v.TransactionID)
+	}
+	expected := []string{
+		"card-limit vc_1 ",
+		"recipient-limit vc_1 ",
+		"no-finance vc_2 ",
+		"no-finance vc_2 tx_3",
+		"gl-code vc_2 tx_3",
+		"lifetime vc_2 ",
+		"validity vc_2 ",
+		"weekdays vc_1 tx_2",
+	}
+	if strings.Join(actual, ", ") != strings.Join(expected, ", ") {
+		t.Fatalf("Unexpected violations: %v", actual)
+	}
+
+	api := &testAPI{}
+	if err := Remediate(api, violations); err != nil {
+		t.Fatalf("Failed to remediate: %v", err)
+	}
+	if u := api.updated["vc_1"]; u.BalanceCents == nil || *u.BalanceCents != 50000 {
+		t.Errorf("Unexpected update: %+v", u)
+	}
+	if len(api.updated) != 1 || len(api.cancelled) != 1 || api.cancelled[0] != "vc_2" {
+		t.Errorf("Unexpected remediation: %v, %v", api.updated, api.cancelled)
+	}
+	for _, v := range violations {
+		if v.Remediated != (v.Remediation != None) {
+			t.Errorf("Unexpected remediated violation: %+v", v)
+		}
+	}
+}
+
+func TestExclude(t *testing.T) {
+	ranges := exclude(nil, []client.MccRange{{Lowest: "6010", Highest: "6012"}})
+	if len(ranges) != 2 || ranges[0] != (client.MccRange{Lowest: "0000", Highest: "6009"}) ||
+		ranges[1] != (client.MccRange{Lowest: "6013", Highest: "9999"}) {
+		t.Errorf("Unexpected ranges: %v", ranges)
+	}
+	if ranges := exclude([]client.MccRange{{Lowest: "6010", Highest: "6010"}}, []client.MccRange{{Lowest: "6000", Highest: "6020"}}); len(ranges) != 0 {
+		t.Errorf("Unexpected ranges: %v", ranges)
+	}
+}
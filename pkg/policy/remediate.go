@@ -0,0 +1,83 @@
+// Copyright 2022 c-fraser
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package policy
+
+import (
+	"fmt"
+
+	"github.com/c-fraser/extendz/pkg/client"
+)
+
+// API is the subset of the client.Client operations used by Remediate.
+type API interface {
+	UpdateVirtualCard(id string, request *client.UpdateVirtualCardRequest) (*client.VirtualCardResponse, error)
+	CancelVirtualCard(id string) (*client.VirtualCardResponse, error)
+}
+
+// Remediate applies the remediation of the violations, and sets their Remediated, stopping at the
+// first error. The remediations of each virtual card are applied once, as a cancellation if any
+// violation is remediated by Cancel, otherwise as the merged updates of the violations (the later
+// violations taking precedence).
+func Remediate(api API, violations []Violation) error {
+	var order []string
+	cancel := make(map[string]bool)
+	updates := make(map[string]*client.UpdateVirtualCardRequest)
+	for _, v := range violations {
+		if v.Remediation == None || v.CardID == "" {
+			continue
+		}
+		if _, ok := updates[v.CardID]; !ok {
+			order = append(order, v.CardID)
+			updates[v.CardID] = &client.UpdateVirtualCardRequest{}
+		}
+		switch v.Remediation {
+		case Cancel:
+			cancel[v.CardID] = true
+		case Update:
+			merge(updates[v.CardID], v.Update)
+		}
+	}
+	for _, id := range order {
+		if cancel[id] {
+			if _, err := api.CancelVirtualCard(id); err != nil {
+				return fmt.Errorf("failed to cancel %s: %w", id, err)
+			}
+		} else if _, err := api.UpdateVirtualCard(id, updates[id]); err != nil {
+			return fmt.Errorf("failed to update %s: %w", id, err)
+		}
+		for i := range violations {
+			if violations[i].CardID == id && violations[i].Remediation != None {
+				violations[i].Remediated = true
+			}
+		}
+	}
+	return nil
+}
+
+// merge sets the (non-nil) fields of the update on the request.
+func merge(request, update *client.UpdateVirtualCardRequest) {
+	if update == nil {
+		return
+	}
+	if update.BalanceCents != nil {
+		request.BalanceCents, request.Currency = update.BalanceCents, update.Currency
+	}
+	if update.ValidMccRanges != nil {
+		request.ValidMccRanges = update.ValidMccRanges
+	}
+	if update.ValidTo != nil {
+		request.ValidTo = update.ValidTo
+	}
+}
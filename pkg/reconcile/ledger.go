@@ -0,0 +1,235 @@
+// Copyright 2022 c-fraser
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reconcile
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/c-fraser/extendz/pkg/client"
+)
+
+// Entry is an entry of the ledger, e.g. a row of a bank statement, or ERP, export.
+type Entry struct {
+	// Line is the line number of the entry in the ledger CSV.
+	Line   int          `json:"line"`
+	Date   time.Time    `json:"date"`
+	Amount client.Money `json:"amount"`
+	// Description describes the entry, typically the merchant.
+	Description string `json:"description"`
+	// Reference is the reference of the entry, matched with the ReferenceID (or ID) of the
+	// transactions.
+	Reference string `json:"reference"`
+}
+
+// Columns are the names of the columns of a ledger CSV, matched case-insensitively. A column which
+// is empty is matched by its common names, e.g. "posted date" for the Date.
+type Columns struct {
+	Date        string
+	Amount      string
+	Currency    string
+	Description string
+	Reference   string
+}
+
+// aliases are the common names of the columns, with the underscores and hyphens as spaces.
+var aliases = map[string][]string{
+	"date":        {"date", "posted", "posted date", "posting date", "transaction date", "booking date", "value date"},
+	"amount":      {"amount", "value", "total", "net amount"},
+	"debit":       {"debit", "debit amount", "withdrawal"},
+	"credit":      {"credit", "credit amount", "deposit"},
+	"currency":    {"currency", "ccy", "currency code"},
+	"description": {"description", "merchant", "payee", "vendor", "memo", "name", "narrative"},
+	"reference":   {"reference", "reference id", "ref", "transaction id", "external id", "id"},
+}
+
+// dateLayouts are the layouts of the ledger dates, besides the client.Timestamp layouts.
+var dateLayouts = []string{"01/02/2006", "1/2/2006", "2006/01/02", "02.01.2006", "Jan 2, 2006", "02 Jan 2006"}
+
+// LedgerOption configures ReadLedger.
+type LedgerOption func(l *ledger)
+
+// ledger is the configuration of ReadLedger.
+type ledger struct {
+	// decimalComma is whether the decimal separator of the amounts is a comma, e.g. "1.234,56".
+	decimalComma bool
+}
+
+// WithDecimalComma configures the decimal separator of the ledger amounts as a comma, and the
+// grouping separator as a point, e.g. "1.234,56". By default, the decimal separator is a point, and
+// an amount with a decimal comma, e.g. "12,34", is invalid.
+func WithDecimalComma() LedgerOption {
+	return func(l *ledger) {
+		l.decimalComma = true
+	}
+}
+
+// ReadLedger reads the entries of the ledger CSV, whose first row is the header. The currency is
+// the currency of the entries without one, e.g. if the ledger has no currency column.
+//
+// The amount of an entry is either its amount column, or its debit column less its credit column.
+func ReadLedger(r io.Reader, columns Columns, currency string, options ...LedgerOption) ([]Entry, error) {
+	var l ledger
+	for _, option := range options {
+		option(&l)
+	}
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	header, err := reader.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	index := indices(header, columns)
+	if index["date"] < 0 {
+		return nil, errors.New("the ledger has no date column")
+	}
+	if index["amount"] < 0 && index["debit"] < 0 && index["credit"] < 0 {
+		return nil, errors.New("the ledger has no amount, or debit and credit, column")
+	}
+	var entries []Entry
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return entries, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		value := func(column string) string {
+			if i := index[column]; i >= 0 && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+		if strings.TrimSpace(strings.Join(record, "")) == "" {
+			continue
+		}
+		entry := Entry{Line: line, Description: value("description"), Reference: value("reference")}
+		if entry.Date, err = parseDate(value("date")); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		c := value("currency")
+		if c == "" {
+			c = currency
+		}
+		if entry.Amount, err = l.amount(value("amount"), value("debit"), value("credit"), c); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		entries = append(entries, entry)
+	}
+}
+
+// indices returns the index of each column in the header, -1 if it's absent.
+func indices(header []string, columns Columns) map[string]int {
+	normalize := func(name string) string {
+		return strings.Join(strings.Fields(strings.ToLower(strings.NewReplacer("_", " ", "-", " ").Replace(name))), " ")
+	}
+	configured := map[string]string{
+		"date":        columns.Date,
+		"amount":      columns.Amount,
+		"currency":    columns.Currency,
+		"description": columns.Description,
+		"reference":   columns.Reference,
+	}
+	index := make(map[string]int, len(aliases))
+	for column, names := range aliases {
+		index[column] = -1
+		if name := configured[column]; name != "" {
+			names = []string{name}
+		}
+		for _, name := range names {
+			for i, h := range header {
+				if normalize(h) == normalize(name) {
+					index[column] = i
+					break
+				}
+			}
+			if index[column] >= 0 {
+				break
+			}
+		}
+	}
+	return index
+}
+
+// parseDate returns the time of the ledger date.
+func parseDate(text string) (time.Time, error) {
+	if t, err := client.ParseTimestamp(text); err == nil && !t.IsZero() {
+		return t.Time, nil
+	}
+	for _, layout := range dateLayouts {
+		if t, err := time.Parse(layout, text); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid date %q", text)
+}
+
+// amount returns the Money of the amount, else the debit less the credit, of the currency, ignoring
+// any currency symbols.
+func (l ledger) amount(amount, debit, credit, currency string) (client.Money, error) {
+	parse := func(s string) (client.Money, error) {
+		m, err := client.ParseAmount(l.decimal(s), currency)
+		if err != nil && l.decimalComma {
+			// the error describes the amount with a decimal point
+			return m, fmt.Errorf("invalid amount %q with a decimal comma: %w", s, err)
+		}
+		return m, err
+	}
+	clean := strings.NewReplacer("$", "", "€", "", "£", "", "¥", "", " ", "").Replace
+	if s := clean(amount); s != "" {
+		// Accounting notation, e.g. (12.34), is negative.
+		if strings.HasPrefix(s, "(") && strings.HasSuffix(s, ")") {
+			s = "-" + s[1:len(s)-1]
+		}
+		return parse(s)
+	}
+	m := client.NewMoney(0, currency)
+	if s := clean(debit); s != "" {
+		d, err := parse(s)
+		if err != nil {
+			return m, err
+		}
+		m.Amount += d.Amount
+	}
+	if s := clean(credit); s != "" {
+		c, err := parse(s)
+		if err != nil {
+			return m, err
+		}
+		m.Amount -= c.Amount
+	}
+	if _, ok := client.MinorUnits(currency); !ok {
+		return m, fmt.Errorf("unknown currency %q", currency)
+	}
+	return m, nil
+}
+
+// decimal returns the amount with a decimal point, and comma grouping separators, e.g. "1,234.56" of
+// "1.234,56" with a decimal comma.
+func (l ledger) decimal(amount string) string {
+	if !l.decimalComma {
+		return amount
+	}
+	return strings.NewReplacer(".", ",", ",", ".").Replace(amount)
+}
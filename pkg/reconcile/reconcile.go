@@ -0,0 +1,481 @@
+// Copyright 2022 c-fraser
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package reconcile reconciles the transactions of the virtual cards with a ledger, e.g. a bank
+// statement, or ERP, export, and reports the matched, and unmatched, items.
+//
+// An entry of the ledger is matched with a transaction by reference (the ReferenceID, or ID, of the
+// transaction), else by the best of the transactions within the date window whose amount, or
+// merchant, is similar. The amounts are compared as absolute values, since ledgers differ in the
+// sign of spend, in the billing currency, or in the merchant currency of foreign transactions. The
+// sign of spend (debits) in the ledger is inferred, so a credit entry (e.g. a refund) only matches a
+// credit transaction, and a debit entry a debit transaction.
+package reconcile
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/c-fraser/extendz/pkg/client"
+)
+
+// Status is the reconciliation status of an Item.
+type Status string
+
+const (
+	// Matched is a transaction, and entry, whose amounts are equal.
+	Matched Status = "matched"
+	// Partial is a transaction, and entry, whose amounts are equal only as authorized, since the
+	// transaction hasn't cleared, or cleared for a different amount.
+	Partial Status = "partial"
+	// AmountMismatch is a transaction, and entry, whose amounts differ.
+	AmountMismatch Status = "amount-mismatch"
+	// Unmatched is a transaction, or entry, without a counterpart.
+	Unmatched Status = "unmatched"
+)
+
+// Statuses returns the Status values.
+func Statuses() []Status {
+	return []Status{Matched, Partial, AmountMismatch, Unmatched}
+}
+
+// Item is a reconciled transaction and/or entry.
+type Item struct {
+	Status Status `json:"status"`
+	// Transaction is the transaction of the Item, nil if it's an unmatched entry.
+	Transaction *client.Transaction `json:"transaction,omitempty"`
+	// Entry is the entry of the Item, nil if it's an unmatched transaction.
+	Entry *Entry `json:"entry,omitempty"`
+	// Difference is the amount of the entry less the amount of the transaction, in the currency of
+	// the entry, of an AmountMismatch.
+	Difference *client.Money `json:"difference,omitempty"`
+	// Note explains the Status.
+	Note string `json:"note,omitempty"`
+}
+
+// Report is the reconciliation of the transactions with the ledger.
+type Report struct {
+	// Summary is the number of items of each Status.
+	Summary map[Status]int `json:"summary"`
+	Items   []Item         `json:"items"`
+}
+
+// config is the configuration of Reconcile.
+type config struct {
+	window      time.Duration
+	tolerance   int64
+	fxTolerance float64
+	// debitSign is the sign (1 or -1) of the amounts of the debit entries of the ledger.
+	debitSign int64
+}
+
+// Option configures Reconcile.
+type Option func(c *config)
+
+// WithWindow configures the maximum time between the date of an entry, and its transaction (when
+// it cleared, or was authorized). The default is 3 days.
+func WithWindow(window time.Duration) Option {
+	return func(c *config) {
+		c.window = window
+	}
+}
+
+// WithTolerance configures the difference, in minor units, between the amounts of a transaction,
+// and its entry, which are equal. The default is 0.
+func WithTolerance(minor int64) Option {
+	return func(c *config) {
+		c.tolerance = minor
+	}
+}
+
+// WithFXTolerance configures the fraction (e.g. 0.01) of the amount of a foreign transaction by
+// which the amount of its entry may differ, in the billing currency, and still be equal, since the
+// ledger may exchange at its own rate. The default is 0.01.
+func WithFXTolerance(fraction float64) Option {
+	return func(c *config) {
+		c.fxTolerance = fraction
+	}
+}
+
+// Reconcile reconciles the (approved) transactions with the ledger entries.
+//
+// The items are the matched transactions, in order of the entries, then the unmatched entries,
+// then the unmatched transactions.
+func Reconcile(transactions []client.Transaction, entries []Entry, options ...Option) *Report {
+	c := config{window: 72 * time.Hour, fxTolerance: 0.01}
+	for _, option := range options {
+		option(&c)
+	}
+	var approved []client.Transaction
+	for _, tx := range transactions {
+		switch tx.Status {
+		case client.TransactionStatusDeclined, client.TransactionStatusAvsFail, client.TransactionStatusAuthReversal:
+			continue
+		}
+		approved = append(approved, tx)
+	}
+
+	matches := make(map[int]int) // the index of the transaction of each matched entry
+	matched := make(map[int]bool)
+	byReference := make(map[string]int)
+	for i, tx := range approved {
+		if tx.ReferenceID != "" {
+			byReference[tx.ReferenceID] = i
+		}
+		byReference[tx.ID] = i
+	}
+	for e, entry := range entries {
+		if i, ok := byReference[entry.Reference]; ok && entry.Reference != "" && !matched[i] {
+			matches[e] = i
+			matched[i] = true
+		}
+	}
+	c.debitSign = debitSign(entries, approved, matches)
+
+	// The candidate pairs of the entries, and transactions, without a reference match, matched by
+	// descending score.
+	type candidate struct {
+		entry, transaction int
+		score              float64
+	}
+	var candidates []candidate
+	for e, entry := range entries {
+		if _, ok := matches[e]; ok {
+			continue
+		}
+		for i, tx := range approved {
+			if matched[i] {
+				continue
+			}
+			if s := c.score(entry, tx); s > 0 {
+				candidates = append(candidates, candidate{e, i, s})
+			}
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].score > candidates[j].score })
+	for _, cand := range candidates {
+		if _, ok := matches[cand.entry]; ok || matched[cand.transaction] {
+			continue
+		}
+		matches[cand.entry] = cand.transaction
+		matched[cand.transaction] = true
+	}
+
+	report := &Report{Summary: make(map[Status]int), Items: []Item{}}
+	var unmatched []Item
+	for e := range entries {
+		entry := &entries[e]
+		i, ok := matches[e]
+		if !ok {
+			unmatched = append(unmatched, Item{Status: Unmatched, Entry: entry, Note: "no transaction matches the entry"})
+			continue
+		}
+		report.Items = append(report.Items, c.compare(entry, &approved[i]))
+	}
+	report.Items = append(report.Items, unmatched...)
+	for i := range approved {
+		if !matched[i] {
+			report.Items = append(report.Items, Item{Status: Unmatched, Transaction: &approved[i], Note: "no entry matches the transaction"})
+		}
+	}
+	for _, item := range report.Items {
+		report.Summary[item.Status]++
+	}
+	return report
+}
+
+// debitSign returns the sign (1 or -1) of the amounts of the debit entries, per the entries matched
+// by reference, else the sign of most entries, since most entries of a ledger of card transactions
+// are spend.
+func debitSign(entries []Entry, transactions []client.Transaction, matches map[int]int) int64 {
+	var votes int64
+	for e, i := range matches {
+		if transactions[i].Type == client.TransactionTypeCredit {
+			votes -= sign(entries[e].Amount.Amount)
+		} else {
+			votes += sign(entries[e].Amount.Amount)
+		}
+	}
+	if votes == 0 {
+		for _, entry := range entries {
+			votes += sign(entry.Amount.Amount)
+		}
+	}
+	if votes < 0 {
+		return -1
+	}
+	return 1
+}
+
+// opposite returns whether the entry is a credit, and the transaction a debit, or vice versa. An
+// entry without an amount is neither.
+func (c config) opposite(entry Entry, tx client.Transaction) bool {
+	if entry.Amount.Amount == 0 {
+		return false
+	}
+	credit := sign(entry.Amount.Amount) != c.debitSign
+	return credit != (tx.Type == client.TransactionTypeCredit)
+}
+
+// amounts are the amounts of a transaction in the currency of an entry.
+type amounts struct {
+	// cleared is the clearing amount, zero if the transaction hasn't cleared.
+	cleared int64
+	// authorized is the authorization amount.
+	authorized int64
+	// foreign is whether the amounts are exchanged, from the merchant currency.
+	foreign bool
+	// ok is whether the transaction has amounts in the currency.
+	ok bool
+}
+
+// amountsOf returns the amounts of the transaction in the currency. A cleared transaction without a
+// clearing amount cleared for its authorization amount.
+func amountsOf(tx client.Transaction, currency string) amounts {
+	foreign := !tx.AuthExchangeRate.IsIdentity() ||
+		(tx.AuthMerchantCurrency != "" && !strings.EqualFold(tx.AuthMerchantCurrency, tx.AuthBillingCurrency))
+	var a amounts
+	switch {
+	case strings.EqualFold(tx.AuthBillingCurrency, currency) || strings.EqualFold(tx.ClearingBillingCurrency, currency):
+		a = amounts{
+			cleared:    abs(int64(tx.ClearingBillingAmountCents)),
+			authorized: abs(int64(tx.AuthBillingAmountCents)),
+			foreign:    foreign,
+			ok:         true,
+		}
+	case strings.EqualFold(tx.AuthMerchantCurrency, currency) || strings.EqualFold(tx.ClearingMerchantCurrency, currency):
+		a = amounts{
+			cleared:    abs(int64(tx.ClearingMerchantAmountCents)),
+			authorized: abs(int64(tx.AuthMerchantAmountCents)),
+			ok:         true,
+		}
+	default:
+		return amounts{}
+	}
+	if a.cleared == 0 && (tx.Status == client.TransactionStatusCleared || !tx.ClearedAt.IsZero()) {
+		a.cleared = a.authorized
+	}
+	return a
+}
+
+// settled returns the amount the transaction settled for, its clearing amount, else its
+// authorization amount.
+func (a amounts) settled() int64 {
+	if a.cleared != 0 {
+		return a.cleared
+	}
+	return a.authorized
+}
+
+// score returns the score of matching the entry with the transaction, 0 if they don't match.
+func (c config) score(entry Entry, tx client.Transaction) float64 {
+	days := math.Abs(entry.Date.Sub(date(tx)).Hours()) / 24
+	window := c.window.Hours() / 24
+	if days > window || c.opposite(entry, tx) {
+		return 0
+	}
+	a := amountsOf(tx, entry.Amount.Currency)
+	if !a.ok {
+		return 0
+	}
+	amount := abs(entry.Amount.Amount)
+	var s float64
+	switch {
+	case c.equal(amount, a.settled()):
+		s = 2
+	case c.equal(amount, a.authorized):
+		s = 1.5
+	case a.foreign && c.withinFX(amount, a.settled()):
+		s = 1.2
+	}
+	merchant := similarity(entry.Description, tx.MerchantName)
+	if s == 0 && merchant < 0.5 {
+		return 0
+	}
+	s += merchant
+	if window > 0 {
+		s += 0.5 * (1 - days/window)
+	}
+	return s
+}
+
+// compare returns the Item of the entry matched with the transaction.
+func (c config) compare(entry *Entry, tx *client.Transaction) Item {
+	item := Item{Entry: entry, Transaction: tx}
+	a := amountsOf(*tx, entry.Amount.Currency)
+	amount := abs(entry.Amount.Amount)
+	money := func(minor int64) client.Money { return client.NewMoney(minor, entry.Amount.Currency) }
+	switch {
+	case !a.ok:
+		item.Status = AmountMismatch
+		item.Note = fmt.Sprintf("the transaction has no amount in %s", entry.Amount.Currency)
+	case c.opposite(*entry, *tx):
+		item.Status = AmountMismatch
+		item.Note = "the entry is a credit, and the transaction a debit, or vice versa"
+	case c.equal(amount, a.settled()) && a.cleared == 0:
+		item.Status = Partial
+		item.Note = fmt.Sprintf("matches the authorization of %s, but the transaction hasn't cleared", money(a.authorized))
+	case c.equal(amount, a.settled()):
+		item.Status = Matched
+	case c.equal(amount, a.authorized):
+		item.Status = Partial
+		item.Note = fmt.Sprintf("matches the authorization of %s, but the transaction cleared for %s",
+			money(a.authorized), money(a.cleared))
+	case a.foreign && c.withinFX(amount, a.settled()):
+		item.Status = Matched
+		item.Note = fmt.Sprintf("differs from %s by less than the FX tolerance", money(a.settled()))
+	default:
+		item.Status = AmountMismatch
+		difference := money(amount - a.settled())
+		item.Difference = &difference
+		item.Note = fmt.Sprintf("the transaction settled for %s", money(a.settled()))
+	}
+	return item
+}
+
+// equal returns whether the amounts are equal, within the tolerance.
+func (c config) equal(a, b int64) bool {
+	return abs(a-b) <= c.tolerance
+}
+
+// withinFX returns whether the amount is within the FX tolerance of the (foreign) amount.
+func (c config) withinFX(amount, foreign int64) bool {
+	return foreign != 0 && math.Abs(float64(amount-foreign)) <= c.fxTolerance*float64(foreign)
+}
+
+// date returns the date of the transaction, when it cleared, else when it was authorized.
+func date(tx client.Transaction) time.Time {
+	if !tx.ClearedAt.IsZero() {
+		return tx.ClearedAt.Time
+	}
+	return tx.AuthedAt.Time
+}
+
+// similarity returns the similarity, between 0 and 1, of the merchant names, the fraction of the
+// words of the shorter name in the other name.
+func similarity(a, b string) float64 {
+	words := func(s string) map[string]bool {
+		set := make(map[string]bool)
+		for _, w := range strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+		}) {
+			if len(w) > 1 {
+				set[w] = true
+			}
+		}
+		return set
+	}
+	x, y := words(a), words(b)
+	if len(x) > len(y) {
+		x, y = y, x
+	}
+	if len(x) == 0 {
+		return 0
+	}
+	common := 0
+	for w := range x {
+		if y[w] {
+			common++
+		}
+	}
+	return float64(common) / float64(len(x))
+}
+
+// sign returns the sign (-1, 0 or 1) of the amount.
+func sign(amount int64) int64 {
+	switch {
+	case amount < 0:
+		return -1
+	case amount > 0:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// abs returns the absolute value of the amount.
+func abs(amount int64) int64 {
+	if amount < 0 {
+		return -amount
+	}
+	return amount
+}
+
+// Header returns the header of the CSV of the Report.
+func (r *Report) Header() []string {
+	return []string{
+		"status",
+		"transaction_id",
+		"transaction_date",
+		"transaction_amount",
+		"merchant",
+		"entry_line",
+		"entry_date",
+		"entry_amount",
+		"entry_description",
+		"entry_reference",
+		"difference",
+		"note",
+	}
+}
+
+// Rows returns the rows of the CSV of the Report, a row per Item.
+func (r *Report) Rows() [][]string {
+	rows := make([][]string, len(r.Items))
+	for i, item := range r.Items {
+		row := make([]string, len(r.Header()))
+		row[0] = string(item.Status)
+		if tx := item.Transaction; tx != nil {
+			amount := tx.AuthBillingAmount()
+			if tx.ClearingBillingAmountCents != 0 {
+				amount = tx.ClearingBillingAmount()
+			}
+			row[1] = tx.ID
+			row[2] = date(*tx).Format("2006-01-02")
+			row[3] = amount.String()
+			row[4] = tx.MerchantName
+		}
+		if e := item.Entry; e != nil {
+			row[5] = fmt.Sprint(e.Line)
+			row[6] = e.Date.Format("2006-01-02")
+			row[7] = e.Amount.String()
+			row[8] = e.Description
+			row[9] = e.Reference
+		}
+		if item.Difference != nil {
+			row[10] = item.Difference.String()
+		}
+		row[11] = item.Note
+		rows[i] = row
+	}
+	return rows
+}
+
+// WriteCSV writes the Report as CSV, with the Header.
+func (r *Report) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(r.Header()); err != nil {
+		return err
+	}
+	if err := cw.WriteAll(r.Rows()); err != nil {
+		return err
+	}
+	return cw.Error()
+}
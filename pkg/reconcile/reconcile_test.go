@@ -0,0 +1,190 @@
+// Copyright 2022 c-fraser
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reconcile
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/c-fraser/extendz/pkg/client"
+)
+
+const testLedger = `Posted Date,Payee,Debit,Credit,Currency,Reference
+01/02/2024,AWS,"1,000.00",,,ref_1
+2024-01-03,Diner Downtown,25.00,,,
+2024-01-04,Hotel Paris,92.00,,EUR,
+2024-01-05,Airline,540.00,,,
+2024-01-05,Office Supplies,40.00,,,
+2024-01-06,Taxi,12.00,,,
+2024-01-20,Unknown Vendor,99.00,,,
+2024-01-07,Refund,,15.00,,
+`
+
+func TestReadLedger(t *testing.T) {
+	entries, err := ReadLedger(strings.NewReader(testLedger), Columns{}, "USD")
+	if err != nil {
+		t.Fatalf("Failed to read ledger: %v", err)
+	}
+	if len(entries) != 8 {
+		t.Fatalf("Unexpected entries: %v", entries)
+	}
+	first := entries[0]
+	if first.Line != 2 || first.Amount != client.NewMoney(100000, "USD") || first.Reference != "ref_1" ||
+		!first.Date.Equal(time.Date(2024, time.January, 2, 0, 0, 0, 0, time.UTC)) || first.Description != "AWS" {
+		t.Errorf("Unexpected entry: %+v", first)
+	}
+	if e := entries[2]; e.Amount != client.NewMoney(9200, "EUR") {
+		t.Errorf("Unexpected entry: %+v", e)
+	}
+	if e := entries[7]; e.Amount != client.NewMoney(-1500, "USD") {
+		t.Errorf("Unexpected entry: %+v", e)
+	}
+
+	entries, err = ReadLedger(strings.NewReader("when,amt,ccy\n2024-01-02,(12.50),GBP\n"), Columns{Date: "when", Amount: "amt"}, "USD")
+	if err != nil || len(entries) != 1 || entries[0].Amount != client.NewMoney(-1250, "GBP") {
+		t.Errorf("Unexpected entries: %v, %v", entries, err)
+	}
+	entries, err = ReadLedger(strings.NewReader("date,amount\n02.01.2024,\"1.234,56\"\n02.01.2024,\"12,34\"\n"), Columns{}, "EUR", WithDecimalComma())
+	if err != nil || len(entries) != 2 || entries[0].Amount != client.NewMoney(123456, "EUR") || entries[1].Amount != client.NewMoney(1234, "EUR") {
+		t.Errorf("Unexpected entries: %v, %v", entries, err)
+	}
+	if _, err = ReadLedger(strings.NewReader("date,amount\n02.01.2024,\"1.23,45\"\n"), Columns{}, "EUR", WithDecimalComma()); err == nil {
+		t.Error("Expected invalid ledger with a decimal comma")
+	}
+	for _, ledger := range []string{
+		"description,amount\nA,1.00\n",
+		"date,description\n2024-01-01,A\n",
+		"date,amount\nyesterday,1.00\n",
+		"date,amount\n2024-01-01,one\n",
+		"date,amount\n02.01.2024,\"12,34\"\n",
+		"date,amount\n02.01.2024,\"1,23,456.00\"\n",
+	} {
+		if _, err := ReadLedger(strings.NewReader(ledger), Columns{}, "USD"); err == nil {
+			t.Errorf("Expected invalid ledger: %s", ledger)
+		}
+	}
+}
+
+func TestReconcile(t *testing.T) {
+	entries, err := ReadLedger(strings.NewReader(testLedger), Columns{}, "USD")
+	if err != nil {
+		t.Fatalf("Failed to read ledger: %v", err)
+	}
+	at := func(day int) client.Timestamp {
+		return client.NewTimestamp(time.Date(2024, time.January, day, 15, 0, 0, 0, time.UTC))
+	}
+	usd := func(tx client.Transaction) client.Transaction {
+		tx.AuthBillingCurrency, tx.ClearingBillingCurrency = "USD", "USD"
+		tx.AuthMerchantCurrency, tx.ClearingMerchantCurrency = "USD", "USD"
+		return tx
+	}
+	transactions := []client.Transaction{
+		// Matched by reference, despite the date.
+		usd(client.Transaction{ID: "tx_aws", ReferenceID: "ref_1", MerchantName: "Amazon Web Services", Status: client.TransactionStatusCleared, AuthBillingAmountCents: 100000, ClearingBillingAmountCents: 100000, AuthedAt: at(10), ClearedAt: at(11)}),
+		// Authorized with a tip, and cleared for more.
+		usd(client.Transaction{ID: "tx_diner", MerchantName: "DINER DOWNTOWN #12", Status: client.TransactionStatusCleared, AuthBillingAmountCents: 2500, ClearingBillingAmountCents: 3000, AuthedAt: at(2), ClearedAt: at(3)}),
+		// Foreign, reconciled in the merchant currency.
+		{ID: "tx_hotel", MerchantName: "Hotel Paris", Status: client.TransactionStatusCleared, AuthBillingAmountCents: 10000, AuthBillingCurrency: "USD", AuthMerchantAmountCents: 9200, AuthMerchantCurrency: "EUR", AuthExchangeRate: "1.087", AuthedAt: at(3)},
+		// Foreign, reconciled in the billing currency at a slightly different rate.
+		{ID: "tx_air", MerchantName: "Air France", Status: client.TransactionStatusCleared, AuthBillingAmountCents: 54300, AuthBillingCurrency: "USD", AuthMerchantAmountCents: 50000, AuthMerchantCurrency: "EUR", AuthExchangeRate: "1.086", AuthedAt: at(5)},
+		// Pending.
+		usd(client.Transaction{ID: "tx_office", MerchantName: "Office Supplies Inc", Status: client.TransactionStatusPending, AuthBillingAmountCents: 4000, AuthedAt: at(5)}),
+		// A different amount.
+		usd(client.Transaction{ID: "tx_taxi", MerchantName: "Taxi", Status: client.TransactionStatusCleared, AuthBillingAmountCents: 1400, ClearingBillingAmountCents: 1400, AuthedAt: at(6)}),
+		// A refund.
+		usd(client.Transaction{ID: "tx_refund", MerchantName: "Diner Downtown", Type: client.TransactionTypeCredit, Status: client.TransactionStatusCleared, AuthBillingAmountCents: 1500, ClearingBillingAmountCents: 1500, AuthedAt: at(7)}),
+		usd(client.Transaction{ID: "tx_missing", MerchantName: "Coffee", Status: client.TransactionStatusCleared, AuthBillingAmountCents: 500, AuthedAt: at(8)}),
+		usd(client.Transaction{ID: "tx_declined", MerchantName: "Unknown Vendor", Status: client.TransactionStatusDeclined, AuthBillingAmountCents: 9900, AuthedAt: at(20)}),
+	}
+	report := Reconcile(transactions, entries)
+	var actual []string
+	for _, item := range report.Items {
+		s := string(item.Status)
+		if item.Transaction != nil {
+			s += " " + item.Transaction.ID
+		}
+		if item.Entry != nil {
+			s += " " + item.Entry.Description
+		}
+		actual = append(actual, s)
+	}
+	expected := []string{
+		"matched tx_aws AWS",
+		"partial tx_diner Diner Downtown",
+		"matched tx_hotel Hotel Paris",
+		"matched tx_air Airline",
+		"partial tx_office Office Supplies",
+		"amount-mismatch tx_taxi Taxi",
+		"matched tx_refund Refund",
+		"unmatched Unknown Vendor",
+		"unmatched tx_missing",
+	}
+	if strings.Join(actual, ", ") != strings.Join(expected, ", ") {
+		t.Fatalf("Unexpected items: %v", actual)
+	}
+	if d := report.Items[5].Difference; d == nil || *d != client.NewMoney(-200, "USD") {
+		t.Errorf("Unexpected difference: %v", d)
+	}
+	if report.Summary[Matched] != 4 || report.Summary[Unmatched] != 2 {
+		t.Errorf("Unexpected summary: %v", report.Summary)
+	}
+
+	var out bytes.Buffer
+	if err := report.WriteCSV(&out); err != nil {
+		t.Fatalf("Failed to write CSV: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 10 || !strings.HasPrefix(lines[6], "amount-mismatch,tx_taxi,2024-01-06,14.00 USD,Taxi,7,2024-01-06,12.00 USD,Taxi,,-2.00 USD,") {
+		t.Errorf("Unexpected CSV: %s", out.String())
+	}
+}
+
+func TestReconcileCredits(t *testing.T) {
+	// The ledger's spend is negative, and the refund of the purchase is positive.
+	entries, err := ReadLedger(strings.NewReader(`date,description,amount
+2024-01-02,Shop,-20.00
+2024-01-03,Shop,20.00
+2024-01-04,Cafe,-35.00
+`), Columns{}, "USD")
+	if err != nil {
+		t.Fatalf("Failed to read ledger: %v", err)
+	}
+	at := func(day, hour int) client.Timestamp {
+		return client.NewTimestamp(time.Date(2024, time.January, day, hour, 0, 0, 0, time.UTC))
+	}
+	transactions := []client.Transaction{
+		// The refund is nearer the date of the purchase entry than the purchase is.
+		{ID: "tx_refund", MerchantName: "Shop", Type: client.TransactionTypeCredit, Status: client.TransactionStatusCleared, AuthBillingAmountCents: 2000, AuthBillingCurrency: "USD", AuthedAt: at(2, 1)},
+		{ID: "tx_purchase", MerchantName: "Shop", Type: client.TransactionTypeDebit, Status: client.TransactionStatusCleared, AuthBillingAmountCents: 2000, AuthBillingCurrency: "USD", AuthedAt: at(3, 23)},
+		{ID: "tx_cafe", MerchantName: "Cafe", Type: client.TransactionTypeDebit, Status: client.TransactionStatusCleared, AuthBillingAmountCents: 3500, AuthBillingCurrency: "USD", AuthedAt: at(4, 15)},
+	}
+	report := Reconcile(transactions, entries)
+	var actual []string
+	for _, item := range report.Items {
+		s := string(item.Status)
+		if item.Transaction != nil {
+			s += " " + item.Transaction.ID
+		}
+		if item.Entry != nil {
+			s += " " + item.Entry.Amount.Decimal()
+		}
+		actual = append(actual, s)
+	}
+	if s := strings.Join(actual, ", "); s != "matched tx_purchase -20.00, matched tx_refund 20.00, matched tx_cafe -35.00" {
+		t.Errorf("Unexpected items: %s", s)
+	}
+}
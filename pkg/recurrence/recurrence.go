@@ -0,0 +1,188 @@
+// Copyright 2022 c-fraser
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package recurrence expands the client.Recurrence of a recurring virtual card into the times its
+// balance is reset, to preview the upcoming resets and the future budget of the virtual card.
+//
+// The resets occur at the start of the day, in the time zone of the virtual card. The
+// client.Recurrence.ByWeekDay is the ISO 8601 day of the week, starting from 0 (Monday).
+package recurrence
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/c-fraser/extendz/pkg/client"
+)
+
+// maxResets is the maximum number of resets expanded to count the remaining resets of a
+// Recurrence terminated by date.
+const maxResets = 100_000
+
+// Schedule is the reset schedule of a client.Recurrence.
+type Schedule struct {
+	// Recurrence is the recurrence of the virtual card.
+	Recurrence client.Recurrence
+	// Currency is the currency of the Recurrence.BalanceCents.
+	Currency string
+	// Location is the time zone the resets occur in.
+	Location *time.Location
+}
+
+// Preview is the upcoming resets of a Schedule.
+type Preview struct {
+	// Resets is the upcoming reset times, up to the limit of the preview.
+	Resets []time.Time `json:"resets"`
+	// Remaining is the number of remaining resets, or -1 if the Recurrence is unbounded.
+	Remaining int `json:"remaining"`
+	// Budget is the total balance of the remaining resets, or of the Resets if the Recurrence is
+	// unbounded.
+	Budget client.Money `json:"budget"`
+}
+
+// ForVirtualCard returns the Schedule of the recurring virtual card, or an error if the virtual
+// card doesn't recur.
+func ForVirtualCard(vc client.VirtualCard) (Schedule, error) {
+	if !vc.Recurs {
+		return Schedule{}, fmt.Errorf("virtual card %s doesn't recur", vc.ID)
+	}
+	return Schedule{Recurrence: vc.Recurrence, Currency: vc.Currency, Location: vc.Location()}, nil
+}
+
+// Preview returns the Preview of the resets from (the start of the day of) the time, listing up to
+// limit Resets.
+func (s Schedule) Preview(from time.Time, limit int) (Preview, error) {
+	var p Preview
+	resets, bounded, err := s.expand(from, limit)
+	if err != nil {
+		return p, err
+	}
+	p.Resets = resets
+	if !bounded {
+		p.Remaining = -1
+		p.Budget = client.NewMoney(int64(s.Recurrence.BalanceCents)*int64(len(resets)), s.Currency)
+		return p, nil
+	}
+	all, _, err := s.expand(from, maxResets)
+	if err != nil {
+		return p, err
+	}
+	p.Remaining = len(all)
+	p.Budget = client.NewMoney(int64(s.Recurrence.BalanceCents)*int64(len(all)), s.Currency)
+	return p, nil
+}
+
+// Resets returns up to limit reset times from (the start of the day of) the time.
+func (s Schedule) Resets(from time.Time, limit int) ([]time.Time, error) {
+	resets, _, err := s.expand(from, limit)
+	return resets, err
+}
+
+// expand returns up to limit reset times from the time, and whether the Recurrence is bounded.
+func (s Schedule) expand(from time.Time, limit int) ([]time.Time, bool, error) {
+	r := s.Recurrence
+	if !r.Period.IsKnown() {
+		return nil, false, fmt.Errorf("unknown recurrence period %q", r.Period)
+	}
+	loc := s.Location
+	if loc == nil {
+		loc = time.UTC
+	}
+	count, until := -1, time.Time{}
+	switch r.Terminator {
+	case client.RecurrenceTerminatorNone, "":
+	case client.RecurrenceTerminatorCount:
+		count = max(r.Count-r.CurrentCount, 0)
+	case client.RecurrenceTerminatorDate:
+		until = r.Until.In(loc)
+	case client.RecurrenceTerminatorCountOrDate:
+		count = max(r.Count-r.CurrentCount, 0)
+		until = r.Until.In(loc)
+	default:
+		return nil, false, fmt.Errorf("unknown recurrence terminator %q", r.Terminator)
+	}
+	if (r.Terminator == client.RecurrenceTerminatorDate || r.Terminator == client.RecurrenceTerminatorCountOrDate) && until.IsZero() {
+		return nil, false, fmt.Errorf("recurrence terminator %s requires an until date", r.Terminator)
+	}
+	start := day(from.In(loc))
+	anchor := start
+	if !r.NextRecurrenceAt.IsZero() {
+		anchor = day(r.NextRecurrenceAt.In(loc))
+	}
+	interval := max(r.Interval, 1)
+	var resets []time.Time
+	for n := 0; len(resets) < limit && (count < 0 || n < count); n++ {
+		t := s.reset(anchor, n*interval)
+		if !until.IsZero() && t.After(until) {
+			break
+		}
+		if t.Before(start) {
+			continue
+		}
+		resets = append(resets, t)
+	}
+	return resets, count >= 0 || !until.IsZero(), nil
+}
+
+// reset returns the reset time, offset by the number of periods from the first reset on (or after)
+// the anchor.
+func (s Schedule) reset(anchor time.Time, periods int) time.Time {
+	r := s.Recurrence
+	loc := anchor.Location()
+	switch r.Period {
+	case client.RecurrencePeriodWeekly:
+		weekday := time.Weekday((r.ByWeekDay + 1) % 7)
+		first := anchor.AddDate(0, 0, (int(weekday)-int(anchor.Weekday())+7)%7)
+		return first.AddDate(0, 0, 7*periods)
+	case client.RecurrencePeriodMonthly:
+		d := r.ByMonthDay
+		if d <= 0 {
+			d = anchor.Day()
+		}
+		months := periods
+		if clamp(anchor.Year(), anchor.Month(), d) < anchor.Day() {
+			months++
+		}
+		month := time.Date(anchor.Year(), anchor.Month()+time.Month(months), 1, 0, 0, 0, 0, loc)
+		return time.Date(month.Year(), month.Month(), clamp(month.Year(), month.Month(), d), 0, 0, 0, 0, loc)
+	case client.RecurrencePeriodYearly:
+		d := r.ByYearDay
+		if d <= 0 {
+			d = anchor.YearDay()
+		}
+		years := periods
+		if min(d, daysIn(anchor.Year())) < anchor.YearDay() {
+			years++
+		}
+		year := anchor.Year() + years
+		return time.Date(year, time.January, min(d, daysIn(year)), 0, 0, 0, 0, loc)
+	default:
+		return anchor.AddDate(0, 0, periods)
+	}
+}
+
+// day returns the start of the day of the time.
+func day(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
+
+// clamp returns the day of the month, or the last day of the month if the month is shorter.
+func clamp(year int, month time.Month, d int) int {
+	return min(d, time.Date(year, month+1, 0, 0, 0, 0, 0, time.UTC).Day())
+}
+
+// daysIn returns the number of days in the year.
+func daysIn(year int) int {
+	return time.Date(year, time.December, 31, 0, 0, 0, 0, time.UTC).YearDay()
+}
@@ -0,0 +1,139 @@
+// Copyright 2022 c-fraser
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package recurrence
+
+import (
+	"testing"
+	"time"
+
+	"github.com/c-fraser/extendz/pkg/client"
+)
+
+func TestPreview(t *testing.T) {
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatalf("Failed to load location: %v", err)
+	}
+	from := time.Date(2024, time.January, 3, 12, 0, 0, 0, loc)
+	until, err := client.ParseTimestamp("2024-06-30")
+	if err != nil {
+		t.Fatalf("Failed to parse until: %v", err)
+	}
+	for name, test := range map[string]struct {
+		recurrence client.Recurrence
+		resets     []string
+		remaining  int
+	}{
+		"weekly": {
+			recurrence: client.Recurrence{
+				Period:       client.RecurrencePeriodWeekly,
+				Interval:     2,
+				ByWeekDay:    0,
+				Terminator:   client.RecurrenceTerminatorCount,
+				Count:        5,
+				CurrentCount: 2,
+			},
+			resets:    []string{"2024-01-08", "2024-01-22", "2024-02-05"},
+			remaining: 3,
+		},
+		"monthly": {
+			recurrence: client.Recurrence{
+				Period:     client.RecurrencePeriodMonthly,
+				ByMonthDay: 31,
+				Terminator: client.RecurrenceTerminatorDate,
+				Until:      until,
+			},
+			resets:    []string{"2024-01-31", "2024-02-29", "2024-03-31"},
+			remaining: 6,
+		},
+		"yearly": {
+			recurrence: client.Recurrence{
+				Period:     client.RecurrencePeriodYearly,
+				ByYearDay:  1,
+				Terminator: client.RecurrenceTerminatorNone,
+			},
+			resets:    []string{"2025-01-01", "2026-01-01", "2027-01-01"},
+			remaining: -1,
+		},
+		"daily": {
+			recurrence: client.Recurrence{
+				Period:           client.RecurrencePeriodDaily,
+				Interval:         3,
+				Terminator:       client.RecurrenceTerminatorCountOrDate,
+				Count:            10,
+				Until:            until,
+				NextRecurrenceAt: client.NewTimestamp(time.Date(2024, time.January, 5, 5, 0, 0, 0, time.UTC)),
+			},
+			resets:    []string{"2024-01-05", "2024-01-08", "2024-01-11"},
+			remaining: 10,
+		},
+	} {
+		test.recurrence.BalanceCents = 10000
+		s := Schedule{Recurrence: test.recurrence, Currency: "USD", Location: loc}
+		p, err := s.Preview(from, 3)
+		if err != nil {
+			t.Errorf("Failed to preview %s recurrence: %v", name, err)
+			continue
+		}
+		var resets []string
+		for _, r := range p.Resets {
+			if r.Location() != loc || r.Hour() != 0 {
+				t.Errorf("Unexpected %s reset time: %v", name, r)
+			}
+			resets = append(resets, r.Format("2006-01-02"))
+		}
+		if len(resets) != len(test.resets) {
+			t.Errorf("Unexpected %s resets: %v", name, resets)
+			continue
+		}
+		for i := range resets {
+			if resets[i] != test.resets[i] {
+				t.Errorf("Unexpected %s resets: %v", name, resets)
+				break
+			}
+		}
+		if p.Remaining != test.remaining {
+			t.Errorf("Unexpected %s remaining resets: %d", name, p.Remaining)
+		}
+		budget := len(p.Resets)
+		if p.Remaining >= 0 {
+			budget = p.Remaining
+		}
+		if expected := client.NewMoney(int64(10000*budget), "USD"); p.Budget != expected {
+			t.Errorf("Unexpected %s budget: %v", name, p.Budget)
+		}
+	}
+}
+
+func TestForVirtualCard(t *testing.T) {
+	if _, err := ForVirtualCard(client.VirtualCard{ID: "vc_1234"}); err == nil {
+		t.Errorf("Unexpected schedule of non-recurring virtual card")
+	}
+	s, err := ForVirtualCard(client.VirtualCard{
+		Recurs:     true,
+		Currency:   "USD",
+		Timezone:   "America/Chicago",
+		Recurrence: client.Recurrence{Period: "HOURLY"},
+	})
+	if err != nil {
+		t.Fatalf("Failed to get schedule: %v", err)
+	}
+	if s.Location.String() != "America/Chicago" {
+		t.Errorf("Unexpected schedule location: %v", s.Location)
+	}
+	if _, err := s.Resets(time.Now(), 1); err == nil {
+		t.Errorf("Unexpected resets of unknown period")
+	}
+}
@@ -0,0 +1,186 @@
+// Copyright 2022 c-fraser
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package telemetry instruments the Extend API client with OpenTelemetry traces and metrics.
+//
+// The instrumentation is a client.Middleware, so it costs nothing unless the client is configured
+// with it. It should precede client.Retry in the middleware chain to observe the retry count.
+package telemetry
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/c-fraser/extendz/pkg/client"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/noop"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// name is the instrumentation scope name.
+const name = "github.com/c-fraser/extendz/pkg/telemetry"
+
+const (
+	// OperationKey is the attribute key of the client operation, e.g. "CreateVirtualCard".
+	OperationKey = attribute.Key("extend.operation")
+	// CardIDKey is the attribute key of the virtual card ID the operation acts on.
+	CardIDKey = attribute.Key("extend.virtual_card.id")
+	// RetryCountKey is the attribute key of the number of times the operation was retried.
+	RetryCountKey = attribute.Key("extend.retry.count")
+)
+
+// config is the configuration of the instrumentation.
+type config struct {
+	tracerProvider trace.TracerProvider
+	meterProvider  metric.MeterProvider
+}
+
+// Option configures the instrumentation.
+type Option func(c *config)
+
+// WithTracerProvider configures the instrumentation to create spans using the provider, instead of
+// the global trace.TracerProvider.
+func WithTracerProvider(provider trace.TracerProvider) Option {
+	return func(c *config) {
+		c.tracerProvider = provider
+	}
+}
+
+// WithMeterProvider configures the instrumentation to record metrics using the provider, instead of
+// the global metric.MeterProvider.
+func WithMeterProvider(provider metric.MeterProvider) Option {
+	return func(c *config) {
+		c.meterProvider = provider
+	}
+}
+
+// instruments are the metric instruments recorded for each client.Call.
+type instruments struct {
+	calls      metric.Int64Counter
+	errors     metric.Int64Counter
+	rateLimits metric.Int64Counter
+	retries    metric.Int64Counter
+	duration   metric.Float64Histogram
+}
+
+// Middleware returns a client.Middleware which creates a span for, and records metrics about, each
+// client.Call, including the token renewals made by the client.
+//
+// The span is named after the client operation and annotated with the HTTP method and status code,
+// the virtual card ID, and the retry count.
+func Middleware(options ...Option) client.Middleware {
+	c := &config{
+		tracerProvider: otel.GetTracerProvider(),
+		meterProvider:  otel.GetMeterProvider(),
+	}
+	for _, option := range options {
+		option(c)
+	}
+	tracer := c.tracerProvider.Tracer(name)
+	i := newInstruments(c.meterProvider.Meter(name))
+	return func(next client.Handler) client.Handler {
+		return func(ctx context.Context, call *client.Call) (*client.Result, error) {
+			attributes := []attribute.KeyValue{OperationKey.String(call.Operation)}
+			ctx, span := tracer.Start(
+				ctx,
+				call.Operation,
+				trace.WithSpanKind(trace.SpanKindClient),
+				trace.WithAttributes(OperationKey.String(call.Operation), semconv.HTTPRequestMethodKey.String(call.Method)))
+			defer span.End()
+			if call.CardID != "" {
+				span.SetAttributes(CardIDKey.String(call.CardID))
+			}
+			start := time.Now()
+			result, err := next(ctx, call)
+			elapsed := time.Since(start)
+			failed := err != nil
+			if result != nil {
+				failed = failed || result.StatusCode >= http.StatusBadRequest
+				span.SetAttributes(
+					semconv.HTTPResponseStatusCode(result.StatusCode),
+					RetryCountKey.Int(result.Attempts-1))
+				i.retries.Add(ctx, int64(result.Attempts-1), metric.WithAttributes(attributes...))
+				i.rateLimits.Add(ctx, int64(result.RateLimits), metric.WithAttributes(attributes...))
+				attributes = append(attributes, semconv.HTTPResponseStatusCode(result.StatusCode))
+			}
+			if err != nil {
+				span.RecordError(err)
+			}
+			if failed {
+				span.SetStatus(codes.Error, errorDescription(result, err))
+				i.errors.Add(ctx, 1, metric.WithAttributes(attributes...))
+			}
+			i.calls.Add(ctx, 1, metric.WithAttributes(attributes...))
+			i.duration.Record(ctx, elapsed.Seconds(), metric.WithAttributes(attributes...))
+			return result, err
+		}
+	}
+}
+
+// newInstruments creates the instruments using the meter, or no-op instruments if the meter fails
+// to create them (after the error is reported to the global OpenTelemetry error handler).
+func newInstruments(meter metric.Meter) *instruments {
+	i, err := createInstruments(meter)
+	if err != nil {
+		otel.Handle(err)
+		i, _ = createInstruments(noop.Meter{})
+	}
+	return i
+}
+
+// createInstruments creates the instruments using the meter.
+func createInstruments(meter metric.Meter) (*instruments, error) {
+	i := &instruments{}
+	var err, e error
+	i.calls, e = meter.Int64Counter(
+		"extendz.client.calls",
+		metric.WithDescription("The number of Extend API calls."),
+		metric.WithUnit("{call}"))
+	err = errors.Join(err, e)
+	i.errors, e = meter.Int64Counter(
+		"extendz.client.errors",
+		metric.WithDescription("The number of failed Extend API calls."),
+		metric.WithUnit("{call}"))
+	err = errors.Join(err, e)
+	i.rateLimits, e = meter.Int64Counter(
+		"extendz.client.rate_limits",
+		metric.WithDescription("The number of Extend API calls which were rate limited."),
+		metric.WithUnit("{call}"))
+	err = errors.Join(err, e)
+	i.retries, e = meter.Int64Counter(
+		"extendz.client.retries",
+		metric.WithDescription("The number of Extend API call retries."),
+		metric.WithUnit("{retry}"))
+	err = errors.Join(err, e)
+	i.duration, e = meter.Float64Histogram(
+		"extendz.client.duration",
+		metric.WithDescription("The duration of Extend API calls."),
+		metric.WithUnit("s"))
+	err = errors.Join(err, e)
+	return i, err
+}
+
+// errorDescription returns the span status description for the failed client.Call.
+func errorDescription(result *client.Result, err error) string {
+	if err != nil {
+		return err.Error()
+	}
+	return http.StatusText(result.StatusCode)
+}
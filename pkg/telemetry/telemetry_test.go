@@ -0,0 +1,144 @@
+// Copyright 2022 c-fraser
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package telemetry
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/c-fraser/extendz/pkg/client"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+)
+
+const testVirtualCardId = "vc_1234"
+
+func TestMiddleware(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/signin":
+			_, _ = w.Write([]byte(`{"token": "token", "refreshToken": "token"}`))
+		case "/virtualcards/" + testVirtualCardId:
+			if requests.Add(1) == 1 {
+				w.WriteHeader(http.StatusTooManyRequests)
+				return
+			}
+			_, _ = w.Write([]byte(`{"virtualCard": {"id": "` + testVirtualCardId + `"}}`))
+		default:
+			w.WriteHeader(http.StatusOK)
+		}
+	}))
+	defer server.Close()
+
+	exporter := tracetest.NewInMemoryExporter()
+	tracerProvider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	reader := sdkmetric.NewManualReader()
+	meterProvider := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+
+	c, err := client.NewClient(
+		server.URL,
+		"_@gmail.com",
+		"P4$sW0rD",
+		client.WithMiddleware(
+			Middleware(WithTracerProvider(tracerProvider), WithMeterProvider(meterProvider)),
+			client.Retry(2, time.Millisecond)))
+	if err != nil {
+		t.Fatalf("Failed to initialize client: %v", err)
+	}
+	_, err = c.GetVirtualCard(testVirtualCardId)
+	if err != nil {
+		t.Errorf("Failed to get virtual card: %v", err)
+	}
+	c.Close()
+
+	spans := exporter.GetSpans()
+	if len(spans) != 3 {
+		t.Fatalf("Unexpected spans: %v", spans)
+	}
+	for i, name := range []string{"SignIn", "GetVirtualCard", "SignOut"} {
+		if spans[i].Name != name {
+			t.Errorf("Unexpected span name: %s", spans[i].Name)
+		}
+	}
+	span := spans[1]
+	expected := map[attribute.Key]attribute.Value{
+		OperationKey:                      attribute.StringValue("GetVirtualCard"),
+		CardIDKey:                         attribute.StringValue(testVirtualCardId),
+		RetryCountKey:                     attribute.IntValue(1),
+		semconv.HTTPRequestMethodKey:      attribute.StringValue(http.MethodGet),
+		semconv.HTTPResponseStatusCodeKey: attribute.IntValue(http.StatusOK),
+	}
+	for _, kv := range span.Attributes {
+		if value, ok := expected[kv.Key]; ok {
+			if value != kv.Value {
+				t.Errorf("Unexpected span attribute %s: %v", kv.Key, kv.Value.Emit())
+			}
+			delete(expected, kv.Key)
+		}
+	}
+	if len(expected) > 0 {
+		t.Errorf("Missing span attributes: %v", expected)
+	}
+	if span.Status.Code == codes.Error {
+		t.Errorf("Unexpected span status: %v", span.Status)
+	}
+
+	var metrics metricdata.ResourceMetrics
+	err = reader.Collect(context.Background(), &metrics)
+	if err != nil {
+		t.Fatalf("Failed to collect metrics: %v", err)
+	}
+	sums := map[string]int64{}
+	var durations uint64
+	for _, scope := range metrics.ScopeMetrics {
+		for _, m := range scope.Metrics {
+			switch data := m.Data.(type) {
+			case metricdata.Sum[int64]:
+				for _, point := range data.DataPoints {
+					sums[m.Name] += point.Value
+				}
+			case metricdata.Histogram[float64]:
+				for _, point := range data.DataPoints {
+					durations += point.Count
+				}
+			}
+		}
+	}
+	if sums["extendz.client.calls"] != 3 {
+		t.Errorf("Unexpected calls: %d", sums["extendz.client.calls"])
+	}
+	if sums["extendz.client.errors"] != 0 {
+		t.Errorf("Unexpected errors: %d", sums["extendz.client.errors"])
+	}
+	if sums["extendz.client.rate_limits"] != 1 {
+		t.Errorf("Unexpected rate limits: %d", sums["extendz.client.rate_limits"])
+	}
+	if sums["extendz.client.retries"] != 1 {
+		t.Errorf("Unexpected retries: %d", sums["extendz.client.retries"])
+	}
+	if durations != 3 {
+		t.Errorf("Unexpected durations: %d", durations)
+	}
+}
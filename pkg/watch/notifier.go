@@ -0,0 +1,149 @@
+// Copyright 2022 c-fraser
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package watch
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/smtp"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The environment variables of the command of a Command notifier.
+const (
+	EnvAlertKind    = "EXTENDZ_ALERT_KIND"
+	EnvAlertCardID  = "EXTENDZ_ALERT_CARD_ID"
+	EnvAlertMessage = "EXTENDZ_ALERT_MESSAGE"
+)
+
+// Notifier is notified of each Alert.
+type Notifier interface {
+	Notify(ctx context.Context, alert Alert) error
+}
+
+// NotifierFunc is a function which is a Notifier.
+type NotifierFunc func(ctx context.Context, alert Alert) error
+
+// Notify calls the function.
+func (f NotifierFunc) Notify(ctx context.Context, alert Alert) error {
+	return f(ctx, alert)
+}
+
+// Notifiers returns a Notifier which notifies each of the notifiers, even if another fails.
+func Notifiers(notifiers ...Notifier) Notifier {
+	return NotifierFunc(func(ctx context.Context, alert Alert) error {
+		var errs []error
+		for _, n := range notifiers {
+			if err := n.Notify(ctx, alert); err != nil {
+				errs = append(errs, err)
+			}
+		}
+		return errors.Join(errs...)
+	})
+}
+
+// Writer returns a Notifier which writes each Alert as a line of JSON to the writer, e.g. stdout.
+func Writer(w io.Writer) Notifier {
+	var mu sync.Mutex
+	return NotifierFunc(func(_ context.Context, alert Alert) error {
+		mu.Lock()
+		defer mu.Unlock()
+		return json.NewEncoder(w).Encode(alert)
+	})
+}
+
+// Webhook returns a Notifier which POSTs each Alert as JSON to the URL, and fails unless the
+// response status is 2xx.
+func Webhook(url string) Notifier {
+	httpClient := &http.Client{Timeout: 30 * time.Second}
+	return NotifierFunc(func(ctx context.Context, alert Alert) error {
+		data, err := json.Marshal(alert)
+		if err != nil {
+			return err
+		}
+		request, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(data))
+		if err != nil {
+			return err
+		}
+		request.Header.Set("Content-Type", "application/json")
+		response, err := httpClient.Do(request)
+		if err != nil {
+			return err
+		}
+		defer response.Body.Close()
+		_, _ = io.Copy(io.Discard, response.Body)
+		if response.StatusCode < 200 || response.StatusCode > 299 {
+			return fmt.Errorf("webhook %s responded %s", url, response.Status)
+		}
+		return nil
+	})
+}
+
+// SMTP returns a Notifier which emails each Alert, from the address to the addresses, via the
+// (unauthenticated) SMTP server at the addr (host:port), e.g. a local relay.
+func SMTP(addr, from string, to ...string) Notifier {
+	return NotifierFunc(func(_ context.Context, alert Alert) error {
+		var msg strings.Builder
+		fmt.Fprintf(&msg, "From: %s\r\n", from)
+		fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(to, ", "))
+		fmt.Fprintf(&msg, "Subject: extendz %s alert: %s\r\n", alert.Kind, alert.CardName)
+		fmt.Fprintf(&msg, "Date: %s\r\n", alert.At.Format(time.RFC1123Z))
+		msg.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+		fmt.Fprintf(&msg, "%s\r\n", alert)
+		return smtp.SendMail(addr, nil, from, to, []byte(msg.String()))
+	})
+}
+
+// Command returns a Notifier which runs the shell command for each Alert, with the Alert as JSON
+// on stdin, and its kind, card ID and message in the EXTENDZ_ALERT_* environment variables.
+func Command(command string) Notifier {
+	return NotifierFunc(func(ctx context.Context, alert Alert) error {
+		data, err := json.Marshal(alert)
+		if err != nil {
+			return err
+		}
+		var cmd *exec.Cmd
+		if runtime.GOOS == "windows" {
+			cmd = exec.CommandContext(ctx, "cmd", "/C", command)
+		} else {
+			cmd = exec.CommandContext(ctx, "sh", "-c", command)
+		}
+		cmd.Env = append(
+			os.Environ(),
+			EnvAlertKind+"="+string(alert.Kind),
+			EnvAlertCardID+"="+alert.CardID,
+			EnvAlertMessage+"="+alert.Message)
+		cmd.Stdin = bytes.NewReader(data)
+		var stderr bytes.Buffer
+		cmd.Stderr = &stderr
+		if err := cmd.Run(); err != nil {
+			if s := strings.TrimSpace(stderr.String()); s != "" {
+				return fmt.Errorf("command failed: %w: %s", err, s)
+			}
+			return fmt.Errorf("command failed: %w", err)
+		}
+		return nil
+	})
+}
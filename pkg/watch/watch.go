@@ -0,0 +1,383 @@
+// Copyright 2022 c-fraser
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package watch periodically scans the virtual cards, and their declined transactions, for
+// conditions which need attention, and notifies a Notifier of an Alert for each.
+//
+// A condition of a virtual card (e.g. its low balance) is alerted once, when it's first detected,
+// and again only after it has cleared, so a long-running Watcher doesn't repeat alerts each scan.
+package watch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/c-fraser/extendz/pkg/client"
+)
+
+// Kind is the kind of condition of an Alert.
+type Kind string
+
+const (
+	// Expiring is a virtual card whose ValidTo, or ActiveUntil, is within the expiry window.
+	Expiring Kind = "expiring"
+	// LowBalance is a virtual card whose balance is below the low balance fraction of its limit.
+	LowBalance Kind = "low-balance"
+	// MissedRecurrence is a recurring virtual card whose NextRecurrenceAt passed (by more than the
+	// grace period) without the recurrence.
+	MissedRecurrence Kind = "missed-recurrence"
+	// Declined is a declined transaction of a virtual card.
+	Declined Kind = "declined"
+)
+
+// Kinds returns the Kind values.
+func Kinds() []Kind {
+	return []Kind{Expiring, LowBalance, MissedRecurrence, Declined}
+}
+
+// Alert is a condition of a virtual card which needs attention.
+type Alert struct {
+	Kind     Kind   `json:"kind"`
+	CardID   string `json:"cardId"`
+	CardName string `json:"cardName"`
+	// TransactionID is the ID of the declined transaction of a Declined alert.
+	TransactionID string    `json:"transactionId,omitempty"`
+	Message       string    `json:"message"`
+	At            time.Time `json:"at"`
+}
+
+// String returns the Alert as a line of text.
+func (a Alert) String() string {
+	return fmt.Sprintf("[%s] %s (%s): %s", a.Kind, a.CardName, a.CardID, a.Message)
+}
+
+// API is the Extend API operations used to Scan, e.g. the client.Client.
+type API interface {
+	client.VirtualCardLister
+	client.TransactionLister
+}
+
+// Watcher scans the virtual cards for alerts.
+type Watcher struct {
+	api      API
+	notifier Notifier
+	// interval is the time between scans.
+	interval time.Duration
+	// expiry is how long before the ValidTo, or ActiveUntil, of a virtual card it's Expiring.
+	expiry time.Duration
+	// lowBalance is the fraction of its limit below which the balance of a virtual card is low.
+	lowBalance float64
+	// grace is how long after the NextRecurrenceAt of a virtual card the recurrence is missed.
+	grace time.Duration
+	// lookback is how long before the first scan declined transactions are alerted.
+	lookback time.Duration
+	// kinds are the enabled kinds of alerts.
+	kinds  map[Kind]bool
+	logger *slog.Logger
+	// now returns the current time.
+	now func() time.Time
+	// alerted are the keys of the alerted conditions which haven't cleared.
+	alerted map[string]bool
+	// declines are the alerted declined transactions, by ID, to ignore when they're got again.
+	declines map[string]time.Time
+	// unsent are the notifications of declined transactions which failed, to retry in the next scan,
+	// since the transactions may not be got again.
+	unsent []notification
+	// scanned is the time of the last scan, zero before the first scan.
+	scanned time.Time
+}
+
+// Option configures a Watcher.
+type Option func(w *Watcher)
+
+// WithInterval configures the time between the scans of Run. The default is 5 minutes.
+func WithInterval(interval time.Duration) Option {
+	return func(w *Watcher) {
+		w.interval = interval
+	}
+}
+
+// WithExpiryWindow configures how long before the ValidTo, or ActiveUntil, of a virtual card it's
+// alerted as Expiring. The default is 7 days.
+func WithExpiryWindow(window time.Duration) Option {
+	return func(w *Watcher) {
+		w.expiry = window
+	}
+}
+
+// WithLowBalance configures the fraction (e.g. 0.1) of its limit below which the balance of a
+// virtual card is alerted as LowBalance. The default is 0.1.
+func WithLowBalance(fraction float64) Option {
+	return func(w *Watcher) {
+		w.lowBalance = fraction
+	}
+}
+
+// WithRecurrenceGrace configures how long after the NextRecurrenceAt of a recurring virtual card
+// it's alerted as MissedRecurrence. The default is 1 hour.
+func WithRecurrenceGrace(grace time.Duration) Option {
+	return func(w *Watcher) {
+		w.grace = grace
+	}
+}
+
+// WithLookback configures how long before the first scan the declined transactions are alerted.
+// The default is 24 hours.
+func WithLookback(lookback time.Duration) Option {
+	return func(w *Watcher) {
+		w.lookback = lookback
+	}
+}
+
+// WithKinds configures the kinds of alerts, instead of every Kind.
+func WithKinds(kinds ...Kind) Option {
+	return func(w *Watcher) {
+		w.kinds = make(map[Kind]bool, len(kinds))
+		for _, kind := range kinds {
+			w.kinds[kind] = true
+		}
+	}
+}
+
+// WithLogger configures the logger of the scan, and notification, errors of Run.
+func WithLogger(logger *slog.Logger) Option {
+	return func(w *Watcher) {
+		w.logger = logger
+	}
+}
+
+// New returns a Watcher which notifies the notifier of the alerts of the virtual cards of the api.
+func New(api API, notifier Notifier, options ...Option) *Watcher {
+	w := &Watcher{
+		api:        api,
+		notifier:   notifier,
+		interval:   5 * time.Minute,
+		expiry:     7 * 24 * time.Hour,
+		lowBalance: 0.1,
+		grace:      time.Hour,
+		lookback:   24 * time.Hour,
+		kinds:      make(map[Kind]bool),
+		logger:     slog.New(slog.NewTextHandler(io.Discard, nil)),
+		now:        time.Now,
+		alerted:    make(map[string]bool),
+		declines:   make(map[string]time.Time),
+	}
+	for _, kind := range Kinds() {
+		w.kinds[kind] = true
+	}
+	for _, option := range options {
+		option(w)
+	}
+	return w
+}
+
+// Run scans the virtual cards every interval, until the ctx is done. The errors of a scan are
+// logged, rather than returned, so Run survives transient failures.
+func (w *Watcher) Run(ctx context.Context) error {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+	for {
+		if _, err := w.Scan(ctx); err != nil {
+			w.logger.Error("Failed to scan the virtual cards", slog.Any("error", err))
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Scan the (active) virtual cards once, notify the notifier of each new Alert, and return them.
+//
+// An Alert is only considered alerted once the notifier succeeds, so the alerts which failed to be
+// notified are notified again by the next scan.
+func (w *Watcher) Scan(ctx context.Context) ([]Alert, error) {
+	now := w.now()
+	cards, err := client.AllVirtualCards(w.api, client.VirtualCardPageableRequest{
+		Statuses: []client.VirtualCardStatus{client.VirtualCardStatusActive},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get virtual cards: %w", err)
+	}
+	after := now.Add(-w.lookback)
+	if !w.scanned.IsZero() {
+		after = w.scanned.Add(-w.interval)
+	}
+	notifications := w.unsent
+	alerted := make(map[string]bool)
+	var errs []error
+	for _, vc := range cards {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		for _, c := range w.conditions(vc, now) {
+			if w.alerted[c.key] {
+				alerted[c.key] = true
+			} else {
+				notifications = append(notifications, notification{alert: c.alert, key: c.key})
+			}
+		}
+		if w.kinds[Declined] {
+			declined, err := w.declined(vc, after, now)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("failed to get transactions of %s: %w", vc.ID, err))
+			}
+			notifications = append(notifications, declined...)
+		}
+	}
+	w.alerted = alerted
+	for id, at := range w.declines {
+		if at.Before(after) {
+			delete(w.declines, id)
+		}
+	}
+	w.scanned = now
+	w.unsent = nil
+	alerts := make([]Alert, 0, len(notifications))
+	for _, n := range notifications {
+		alerts = append(alerts, n.alert)
+		if err := w.notifier.Notify(ctx, n.alert); err != nil {
+			errs = append(errs, fmt.Errorf("failed to notify %s: %w", n.alert, err))
+			if n.key == "" {
+				w.unsent = append(w.unsent, n)
+			}
+			continue
+		}
+		if n.key != "" {
+			w.alerted[n.key] = true
+		} else {
+			w.declines[n.alert.TransactionID] = n.authedAt
+		}
+	}
+	return alerts, errors.Join(errs...)
+}
+
+// notification is an Alert to notify, and what's alerted once it's notified.
+type notification struct {
+	alert Alert
+	// key is the key of the condition of the Alert, empty if the Alert is of a declined transaction.
+	key string
+	// authedAt is the time of the declined transaction of the Alert.
+	authedAt time.Time
+}
+
+// condition is the Alert of a condition, and the key which identifies the condition.
+type condition struct {
+	key   string
+	alert Alert
+}
+
+// conditions returns the conditions of the virtual card.
+func (w *Watcher) conditions(vc client.VirtualCard, now time.Time) []condition {
+	var conditions []condition
+	alert := func(kind Kind, key, format string, args ...any) {
+		if w.kinds[kind] {
+			conditions = append(conditions, condition{
+				key: string(kind) + "/" + vc.ID + "/" + key,
+				alert: Alert{
+					Kind:     kind,
+					CardID:   vc.ID,
+					CardName: vc.DisplayName,
+					Message:  fmt.Sprintf(format, args...),
+					At:       now,
+				},
+			})
+		}
+	}
+	for _, end := range []struct {
+		name string
+		at   client.Timestamp
+	}{{"validTo", vc.ValidTo}, {"activeUntil", vc.ActiveUntil}} {
+		if end.at.IsZero() {
+			continue
+		}
+		if left := end.at.Sub(now); left >= 0 && left <= w.expiry {
+			alert(Expiring, end.at.String(), "expires in %s (%s %s)", remaining(left), end.name, end.at)
+		}
+	}
+	if vc.LimitCents > 0 && float64(vc.BalanceCents) < w.lowBalance*float64(vc.LimitCents) {
+		alert(LowBalance, "", "balance %s is below %.0f%% of the limit %s",
+			vc.Balance(), w.lowBalance*100, vc.Limit())
+	}
+	if next := vc.Recurrence.NextRecurrenceAt; vc.Recurs && !next.IsZero() && now.Sub(next.Time) > w.grace {
+		alert(MissedRecurrence, next.String(), "the recurrence due at %s hasn't occurred", next)
+	}
+	return conditions
+}
+
+// declined returns the notifications of the declined transactions of the virtual card after the
+// time, which haven't been alerted, nor are unsent.
+func (w *Watcher) declined(vc client.VirtualCard, after, now time.Time) ([]notification, error) {
+	transactions, err := client.AllVirtualCardTransactions(w.api, vc.ID, client.VirtualCardTransactionsRequest{
+		After:    after,
+		Statuses: []client.TransactionStatus{client.TransactionStatusDeclined},
+	})
+	if err != nil {
+		return nil, err
+	}
+	var notifications []notification
+	for _, tx := range transactions {
+		if _, ok := w.declines[tx.ID]; ok || w.isUnsent(tx.ID) || tx.Status != client.TransactionStatusDeclined {
+			continue
+		}
+		reasons := make([]string, len(tx.DeclineReasons))
+		for i, r := range tx.DeclineReasons {
+			reasons[i] = r.Description
+			if reasons[i] == "" {
+				reasons[i] = r.Code
+			}
+		}
+		message := fmt.Sprintf("%s at %s was declined",
+			client.NewMoney(int64(tx.AuthBillingAmountCents), tx.AuthBillingCurrency), tx.MerchantName)
+		if len(reasons) > 0 {
+			message += ": " + strings.Join(reasons, ", ")
+		}
+		notifications = append(notifications, notification{
+			alert: Alert{
+				Kind:          Declined,
+				CardID:        vc.ID,
+				CardName:      vc.DisplayName,
+				TransactionID: tx.ID,
+				Message:       message,
+				At:            now,
+			},
+			authedAt: tx.AuthedAt.Time,
+		})
+	}
+	return notifications, nil
+}
+
+// isUnsent returns whether the notification of the declined transaction is unsent.
+func (w *Watcher) isUnsent(id string) bool {
+	for _, n := range w.unsent {
+		if n.alert.TransactionID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// remaining returns the duration rounded to days, or hours if less than a day.
+func remaining(d time.Duration) string {
+	if d >= 24*time.Hour {
+		return fmt.Sprintf("%dd", int(d/(24*time.Hour)))
+	}
+	return d.Round(time.Minute).String()
+}
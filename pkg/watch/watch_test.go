@@ -0,0 +1,243 @@
+// Copyright 2022 c-fraser
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package watch
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/c-fraser/extendz/pkg/client"
+)
+
+type api struct {
+	cards        []client.VirtualCard
+	transactions map[string][]client.Transaction
+}
+
+func (a *api) GetUserVirtualCards(*client.VirtualCardPageableRequest) (*client.VirtualCardsResponse, error) {
+	return &client.VirtualCardsResponse{
+		Pagination:   client.Pagination{NumberOfPages: 1},
+		VirtualCards: a.cards,
+	}, nil
+}
+
+func (a *api) GetVirtualCardTransactions(id string, request *client.VirtualCardTransactionsRequest) (*client.TransactionsResponse, error) {
+	var response client.TransactionsResponse
+	for _, tx := range a.transactions[id] {
+		if tx.AuthedAt.After(request.After) {
+			response.Transactions = append(response.Transactions, tx)
+		}
+	}
+	return &response, nil
+}
+
+func TestScan(t *testing.T) {
+	now := time.Date(2024, time.January, 10, 0, 0, 0, 0, time.UTC)
+	a := &api{
+		cards: []client.VirtualCard{
+			{
+				ID:           "vc_1",
+				DisplayName:  "Expiring",
+				Currency:     "USD",
+				LimitCents:   1000,
+				BalanceCents: 1000,
+				ValidTo:      client.NewTimestamp(now.Add(48 * time.Hour)),
+			},
+			{
+				ID:           "vc_2",
+				DisplayName:  "Low",
+				Currency:     "USD",
+				LimitCents:   1000,
+				BalanceCents: 50,
+				Recurs:       true,
+				Recurrence:   client.Recurrence{NextRecurrenceAt: client.NewTimestamp(now.Add(-2 * time.Hour))},
+			},
+			{
+				ID:           "vc_3",
+				DisplayName:  "Fine",
+				Currency:     "USD",
+				LimitCents:   1000,
+				BalanceCents: 500,
+				ValidTo:      client.NewTimestamp(now.Add(30 * 24 * time.Hour)),
+			},
+		},
+		transactions: map[string][]client.Transaction{
+			"vc_3": {
+				{
+					ID:                     "tx_1",
+					Status:                 client.TransactionStatusDeclined,
+					AuthBillingAmountCents: 2500,
+					AuthBillingCurrency:    "USD",
+					MerchantName:           "ACME",
+					DeclineReasons:         []client.DeclineReason{{Code: "INSUFFICIENT_FUNDS"}},
+					AuthedAt:               client.NewTimestamp(now.Add(-time.Hour)),
+				},
+			},
+		},
+	}
+	var notified []Alert
+	w := New(a, NotifierFunc(func(_ context.Context, alert Alert) error {
+		notified = append(notified, alert)
+		return nil
+	}))
+	w.now = func() time.Time { return now }
+
+	alerts, err := w.Scan(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to scan: %v", err)
+	}
+	var kinds []string
+	for _, alert := range alerts {
+		kinds = append(kinds, alert.CardID+" "+string(alert.Kind))
+	}
+	if s := strings.Join(kinds, ", "); s != "vc_1 expiring, vc_2 low-balance, vc_2 missed-recurrence, vc_3 declined" {
+		t.Fatalf("Unexpected alerts: %s", s)
+	}
+	if len(notified) != len(alerts) {
+		t.Errorf("Unexpected notified alerts: %v", notified)
+	}
+	if m := alerts[3].Message; m != "25.00 USD at ACME was declined: INSUFFICIENT_FUNDS" {
+		t.Errorf("Unexpected message: %s", m)
+	}
+
+	// The conditions, and declines, are alerted once, until the low balance clears and recurs.
+	now = now.Add(5 * time.Minute)
+	if alerts, _ := w.Scan(context.Background()); len(alerts) != 0 {
+		t.Errorf("Unexpected repeated alerts: %v", alerts)
+	}
+	a.cards[1].BalanceCents = 1000
+	if alerts, _ := w.Scan(context.Background()); len(alerts) != 0 {
+		t.Errorf("Unexpected alerts: %v", alerts)
+	}
+	a.cards[1].BalanceCents = 10
+	if alerts, _ := w.Scan(context.Background()); len(alerts) != 1 || alerts[0].Kind != LowBalance {
+		t.Errorf("Unexpected alerts: %v", alerts)
+	}
+
+	w = New(a, Notifiers(), WithKinds(Declined), WithLookback(30*time.Minute))
+	w.now = func() time.Time { return now }
+	if alerts, _ := w.Scan(context.Background()); len(alerts) != 0 {
+		t.Errorf("Unexpected alerts outside the lookback: %v", alerts)
+	}
+}
+
+func TestScanRetriesFailedNotifications(t *testing.T) {
+	now := time.Date(2024, time.January, 10, 0, 0, 0, 0, time.UTC)
+	a := &api{
+		cards: []client.VirtualCard{
+			{ID: "vc_1", DisplayName: "Low", Currency: "USD", LimitCents: 1000, BalanceCents: 50},
+		},
+		transactions: map[string][]client.Transaction{
+			"vc_1": {
+				{
+					ID:                  "tx_1",
+					Status:              client.TransactionStatusDeclined,
+					AuthBillingCurrency: "USD",
+					AuthedAt:            client.NewTimestamp(now.Add(-time.Hour)),
+				},
+			},
+		},
+	}
+	fail := true
+	var notified []Alert
+	w := New(a, NotifierFunc(func(_ context.Context, alert Alert) error {
+		if fail {
+			return errors.New("unavailable")
+		}
+		notified = append(notified, alert)
+		return nil
+	}))
+	w.now = func() time.Time { return now }
+
+	if alerts, err := w.Scan(context.Background()); err == nil || len(alerts) != 2 {
+		t.Fatalf("Unexpected scan: %v, %v", alerts, err)
+	}
+
+	// The alerts are notified by the next scan, even though the declined transaction is no longer
+	// got, then not again.
+	fail = false
+	now = now.Add(time.Hour)
+	if _, err := w.Scan(context.Background()); err != nil {
+		t.Fatalf("Failed to scan: %v", err)
+	}
+	var kinds []string
+	for _, alert := range notified {
+		kinds = append(kinds, string(alert.Kind))
+	}
+	if s := strings.Join(kinds, ", "); s != "declined, low-balance" {
+		t.Errorf("Unexpected notified alerts: %s", s)
+	}
+	if alerts, _ := w.Scan(context.Background()); len(alerts) != 0 {
+		t.Errorf("Unexpected repeated alerts: %v", alerts)
+	}
+}
+
+func TestNotifiers(t *testing.T) {
+	alert := Alert{Kind: LowBalance, CardID: "vc_1", CardName: "Card", Message: "balance is low"}
+
+	var out bytes.Buffer
+	if err := Writer(&out).Notify(context.Background(), alert); err != nil {
+		t.Fatalf("Failed to write alert: %v", err)
+	}
+	var written Alert
+	if err := json.Unmarshal(out.Bytes(), &written); err != nil || written.CardID != "vc_1" {
+		t.Errorf("Unexpected written alert: %s", out.String())
+	}
+
+	var posted Alert
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/fail" {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		if err := json.NewDecoder(r.Body).Decode(&posted); err != nil {
+			t.Errorf("Failed to decode alert: %v", err)
+		}
+	}))
+	defer server.Close()
+	if err := Webhook(server.URL).Notify(context.Background(), alert); err != nil || posted.Kind != LowBalance {
+		t.Errorf("Unexpected webhook: %v, %v", err, posted)
+	}
+	if err := Webhook(server.URL+"/fail").Notify(context.Background(), alert); err == nil {
+		t.Errorf("Expected the webhook to fail")
+	}
+
+	if runtime.GOOS == "windows" {
+		return
+	}
+	path := filepath.Join(t.TempDir(), "alert")
+	command := Command(`printf '%s ' "$EXTENDZ_ALERT_KIND" > ` + path + ` && cat >> ` + path)
+	if err := command.Notify(context.Background(), alert); err != nil {
+		t.Fatalf("Failed to run command: %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil || !strings.HasPrefix(string(data), `low-balance {"kind":"low-balance"`) {
+		t.Errorf("Unexpected command output: %s", data)
+	}
+	if err := Command("echo oops >&2; exit 1").Notify(context.Background(), alert); err == nil ||
+		!strings.Contains(err.Error(), "oops") {
+		t.Errorf("Unexpected command error: %v", err)
+	}
+}